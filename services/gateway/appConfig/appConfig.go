@@ -2,8 +2,11 @@ package appConfig
 
 import (
 	"encoding/base64"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"strings"
 
 	"github.com/jinzhu/configor"
 	"github.com/sirupsen/logrus"
@@ -15,6 +18,103 @@ type Upstreams struct {
 	Authoring  string
 	Publishing string
 	Editor     string
+	// Options configures the instances of each upstream service, keyed by the service name
+	Options map[string]UpstreamOptions
+}
+
+// UpstreamOptions configures how requests are balanced between the instances of an upstream service
+type UpstreamOptions struct {
+	// Targets are the URLs of the service instances, used instead of the upstream URL's host
+	Targets []string
+	// Resolve periodically resolves the upstream URL's host, and uses each address as an instance
+	Resolve         bool
+	ResolveInterval string
+	// Balancer is either `round-robin` (default) or `least-connections`
+	Balancer           string
+	HealthCheck        HealthCheck
+	PassiveHealthCheck PassiveHealthCheck
+	CircuitBreaker     CircuitBreaker
+	Timeouts           Timeouts
+	Retry              Retry
+	Body               Body
+	TLS                TLS
+}
+
+// Body configures how request and response bodies are forwarded
+type Body struct {
+	// Streaming forwards bodies without buffering them in the gateway, which disables retries
+	Streaming bool
+	// MaxRequestBytes and MaxResponseBytes limit the body sizes, responding with 413 when exceeded (unlimited when 0)
+	MaxRequestBytes  int64
+	MaxResponseBytes int64
+}
+
+// TLS configures the connections to the instances of an upstream over https.
+// It also applies to health checks, status probes and JWKS endpoints served by the upstream, unless jwks_tls is set
+type TLS struct {
+	// CA is a PEM bundle of certificate authorities trusted in addition to the system ones
+	CA EnvInlineOrPath
+	// ClientCert and ClientKey are the PEM client certificate and key presented to the instances
+	ClientCert EnvInlineOrPath
+	ClientKey  EnvInlineOrPath
+	// ServerName verifies the instances' certificates, defaults to the upstream host when instances are resolved
+	ServerName string
+	// MinVersion is either `1.0`, `1.1`, `1.2` (default) or `1.3`
+	MinVersion string
+}
+
+// Timeouts configures the time limits of forwarded requests, which are unlimited when empty
+type Timeouts struct {
+	// Connect limits establishing the connection to an instance
+	Connect string
+	// Read limits waiting for the response headers of an instance
+	Read string
+	// Total limits the whole request, including retries
+	Total string
+}
+
+// Retry configures retrying failed requests. Network errors are always retried, up to the attempts limit
+type Retry struct {
+	// Attempts is the maximum number of attempts, including the first one (default 3, 1 disables retries)
+	Attempts int
+	// Methods are the retried methods, only GET, HEAD and OPTIONS by default
+	Methods []string
+	// StatusCodes are response codes which are retried in addition to network errors
+	StatusCodes []int
+	// Backoff is the delay before the first retry, doubled before each of the next ones
+	Backoff string
+}
+
+// CircuitBreaker configures failing fast with 503 while an upstream is degraded
+type CircuitBreaker struct {
+	Enabled bool
+	// ErrorRatio trips the breaker when the ratio of network errors or 5xx responses exceeds it
+	ErrorRatio float64
+	// LatencyThreshold trips the breaker when the latency at LatencyQuantile (default 50) exceeds it
+	LatencyThreshold string
+	LatencyQuantile  float64
+	// Expression replaces the conditions above with an oxy circuit breaker expression
+	Expression string
+	// FallbackDuration is the time the breaker stays open, before letting probe requests through (default 10s)
+	FallbackDuration string
+	// RecoveryDuration is the time over which traffic is gradually restored after the breaker is half-opened (default 10s)
+	RecoveryDuration string
+	CheckPeriod      string
+}
+
+// HealthCheck configures active health checks of upstream instances, enabled when Interval is set
+type HealthCheck struct {
+	Path               string
+	Interval           string
+	Timeout            string
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+// PassiveHealthCheck configures ejection of upstream instances which fail to serve requests
+type PassiveHealthCheck struct {
+	MaxFailures      int
+	EjectionDuration string
 }
 
 // V1Hosts is the list of v1 hosts
@@ -32,11 +132,37 @@ type V2Route struct {
 	Service         string
 	UserInfo        bool
 	RewriteKeyPath  bool
+	// CircuitBreaker optionally fails the route fast, in addition to the breaker of its upstream
+	CircuitBreaker CircuitBreaker
+	// Timeouts, Retry and Body override the options of the route's upstream
+	Timeouts Timeouts
+	Retry    Retry
+	Body     Body
+}
+
+// Watch configures the server-sent events stream of repository revisions
+type Watch struct {
+	// HeartbeatInterval is the interval of comments sent to keep idle connections open, defaults to 30s
+	HeartbeatInterval string
+	// MaxConnectionsPerSubject limits the open streams of each subject, unlimited when 0
+	MaxConnectionsPerSubject int
+}
+
+// Batch configures the batch values endpoint
+type Batch struct {
+	// MaxItems limits the key paths of a batch request, defaults to 100
+	MaxItems int
+	// Concurrency limits the requests of a batch made to the api at once, defaults to 10
+	Concurrency int
+	// MaxBytes limits the body of a batch request, responding with 413 when exceeded. Defaults to 1MiB
+	MaxBytes int64
 }
 
 // Server section holds the server related configuration
 type Server struct {
 	Ports []int `mapstructure:"ports"`
+	// GRPCPort serves the gRPC service for values and contexts, disabled when 0
+	GRPCPort int `mapstructure:"grpcPort"`
 }
 
 // EnvInlineOrPath is struct to contain value inline or path to file with content
@@ -66,12 +192,20 @@ type AuthProvider struct {
 	ClientID  string    `json:"client_id" yaml:"client_id"`
 	JWKSURL   string    `json:"jwks_uri" yaml:"jwks_uri"`
 	LoginInfo AuthLogin `json:"login_info" yaml:"login_info"`
+	// SubjectExtractionRules is the policy storage object of the provider's own subject extraction rules, in security/subject_extraction_rules/.
+	// Tokens of providers without rules use the global subject extraction rules
+	SubjectExtractionRules string `json:"subject_extraction_rules" yaml:"subject_extraction_rules"`
+	// JWKSTLS configures fetching the provider's JWKS endpoint, overriding the jwks_tls of all providers
+	JWKSTLS TLS `json:"jwks_tls" yaml:"jwks_tls"`
 }
 
 // Auth - struct with config related to authentication
 type Auth struct {
 	Providers map[string]AuthProvider
 	BasicAuth BasicAuth `json:"basic_auth"`
+	// JWKSTLS configures fetching the JWKS endpoints of all providers.
+	// Without it, endpoints served by an upstream use the upstream's TLS options
+	JWKSTLS TLS `json:"jwks_tls" yaml:"jwks_tls"`
 }
 
 // Security section holds security related configuration
@@ -80,6 +214,65 @@ type Security struct {
 	PolicyStorage  PolicyStorage
 	Cors           Cors
 	Auth           Auth
+	// FilterListings removes the keys the subject isn't allowed to read from manifests, search, suggestions and dependents responses
+	FilterListings bool
+	Attributes     Attributes
+	Enrichment     Enrichment
+	BreakGlass     BreakGlass
+}
+
+// BreakGlass configures temporary elevated access to roles, which subjects may request with a justification
+type BreakGlass struct {
+	Enabled bool
+	// MaxDuration limits the duration of break-glass access, defaults to 1h
+	MaxDuration string
+}
+
+// Enrichment configures looking up additional groups and attributes of subjects in a directory, enabled when URL or MappingObject is set
+type Enrichment struct {
+	// URL of the directory, which is queried with the `user` and `group` of the subject
+	URL string
+	// MappingObject is a JSON or CSV object in the policy storage, in security/enrichment/, which maps users to their groups and attributes
+	MappingObject string
+	// Timeout of directory requests, defaults to 5s
+	Timeout string
+	// CacheTTL is the duration directory results are cached for, defaults to 5m
+	CacheTTL string
+	// FallbackToToken uses the subject extracted from the token when the directory fails, instead of rejecting the request
+	FallbackToToken bool
+}
+
+// Attributes configures the request attributes passed to the authorization policies
+type Attributes struct {
+	// Headers are the request headers passed to the policies, other headers are omitted
+	Headers []string
+	// ForwardedFor takes the source IP from the X-Forwarded-For header, for gateways behind a trusted proxy
+	ForwardedFor bool
+	// TrustedProxies are the IPs or CIDRs of the proxies in front of the gateway, whose X-Forwarded-For entries are skipped.
+	// When empty, only the direct peer is trusted
+	TrustedProxies []string
+}
+
+// TrustedNetworks parses the trusted proxies, single IPs are converted to networks of a single address
+func (a *Attributes) TrustedNetworks() ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(a.TrustedProxies))
+	for _, proxy := range a.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP or a CIDR", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
 }
 
 // Cors stores data for CORS support
@@ -99,6 +292,10 @@ type PolicyStorage struct {
 	MinioSecretKey  string
 	MinioUseSSL     bool
 	NatsEndpoint    string
+	// PollInterval enables polling the storage for new revisions (e.g. "30s"), as a fallback for NATS
+	PollInterval string
+	// SnapshotDir is a local directory for last known good copies of policies, used when the storage is unreachable
+	SnapshotDir string
 }
 
 // Configuration is the root element of configuration for gateway
@@ -108,38 +305,71 @@ type Configuration struct {
 	V2Routes       []V2Route
 	Server         Server
 	Security       Security
+	Watch          Watch
+	Batch          Batch
 	ConfigFilePath string
+
+	files []string
 }
 
+const (
+	settingsFilePath      = "./settings/settings.json"
+	defaultConfigFilePath = "/config/gateway.json"
+)
+
 // InitConfig initializes the configuration
 func InitConfig() *Configuration {
+	conf, err := LoadConfig()
+	if conf == nil {
+		logrus.WithError(err).Panic("Settings file not found:")
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Configuration error")
+	}
+	return conf
+}
+
+// LoadConfig loads the configuration from the settings file, the config file and the environment.
+// The configuration is returned along with the error if it was only partially loaded
+func LoadConfig() (*Configuration, error) {
+	return LoadConfigFrom("")
+}
+
+// LoadConfigFrom loads the configuration like LoadConfig, using configFilePath instead of the configured config file path if not empty
+func LoadConfigFrom(configFilePath string) (*Configuration, error) {
 	conf := &Configuration{}
 
 	tweekConfigor := configor.New(&configor.Config{ENVPrefix: "TWEEKGATEWAY"})
-	const settingsFilePath = "./settings/settings.json"
-	if _, err := os.Stat(settingsFilePath); !os.IsNotExist(err) {
-		if err = tweekConfigor.Load(conf, settingsFilePath); err != nil {
-			logrus.WithError(err).Error("Settings error")
-		}
-	} else {
-		logrus.WithField("error", err).Panic("Settings file not found:")
+	if _, err := os.Stat(settingsFilePath); os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := tweekConfigor.Load(conf, settingsFilePath); err != nil {
+		return conf, fmt.Errorf("Settings error: %v", err)
 	}
+	conf.files = []string{settingsFilePath}
 
 	// Loading config file if exists
-	var configFilePath = conf.ConfigFilePath
+	if len(configFilePath) == 0 {
+		configFilePath = conf.ConfigFilePath
+	}
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		configFilePath = defaultConfigFilePath
+	}
 	if _, err := os.Stat(configFilePath); !os.IsNotExist(err) {
 		if err = tweekConfigor.Load(conf, configFilePath); err != nil {
-			logrus.WithError(err).Error("Configuration error")
-		}
-	} else if _, err := os.Stat("/config/gateway.json"); !os.IsNotExist(err) {
-		if err = tweekConfigor.Load(conf, "/config/gateway.json"); err != nil {
-			logrus.WithError(err).Error("Configuration error")
+			return conf, err
 		}
+		conf.files = append(conf.files, configFilePath)
 	} else {
 		logrus.WithError(err).Error("Config file not found")
 	}
 
-	return conf
+	return conf, nil
+}
+
+// Files returns the paths of the files the configuration was loaded from
+func (c *Configuration) Files() []string {
+	return c.files
 }
 
 // HandleEnvInlineOrPath returns value of base64 inline environment variable or content of file which path is stored in environmental value
@@ -0,0 +1,72 @@
+package appConfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// LoadTLSConfig creates the client TLS configuration, reading the CA bundle and the client certificate.
+// It returns nil if no TLS option is set
+func LoadTLSConfig(cfg *TLS) (*tls.Config, error) {
+	if *cfg == (TLS{}) {
+		return nil, nil
+	}
+
+	config := &tls.Config{ServerName: cfg.ServerName, MinVersion: tls.VersionTLS12}
+
+	if len(cfg.MinVersion) > 0 {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown minVersion %q", cfg.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if isSet(&cfg.CA) {
+		bundle, err := HandleEnvInlineOrPath(&cfg.CA)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ca: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("ca contains no PEM certificate")
+		}
+		config.RootCAs = pool
+	}
+
+	if isSet(&cfg.ClientCert) != isSet(&cfg.ClientKey) {
+		return nil, fmt.Errorf("clientCert and clientKey must be used together")
+	}
+	if isSet(&cfg.ClientCert) {
+		certPEM, err := HandleEnvInlineOrPath(&cfg.ClientCert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read clientCert: %v", err)
+		}
+		keyPEM, err := HandleEnvInlineOrPath(&cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read clientKey: %v", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func isSet(value *EnvInlineOrPath) bool {
+	return len(value.Inline) > 0 || len(value.Path) > 0
+}
@@ -0,0 +1,146 @@
+package appConfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newCertificate returns a self-signed PEM certificate and its PEM key
+func newCertificate(t *testing.T) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tweek.test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func inline(value []byte) EnvInlineOrPath {
+	return EnvInlineOrPath{Inline: base64.StdEncoding.EncodeToString(value)}
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	certPEM, keyPEM := newCertificate(t)
+	_, otherKeyPEM := newCertificate(t)
+
+	tests := []struct {
+		name    string
+		cfg     TLS
+		wantNil bool
+		wantErr string
+		check   func(t *testing.T, config *tls.Config)
+	}{
+		{
+			name:    "No options",
+			wantNil: true,
+		},
+		{
+			name: "Defaults to TLS 1.2",
+			cfg:  TLS{ServerName: "api.tweek.test"},
+			check: func(t *testing.T, config *tls.Config) {
+				if config.MinVersion != tls.VersionTLS12 || config.ServerName != "api.tweek.test" {
+					t.Errorf("MinVersion = %x, ServerName = %q, want TLS 1.2 and api.tweek.test", config.MinVersion, config.ServerName)
+				}
+			},
+		},
+		{
+			name: "Minimal version",
+			cfg:  TLS{MinVersion: "1.3"},
+			check: func(t *testing.T, config *tls.Config) {
+				if config.MinVersion != tls.VersionTLS13 {
+					t.Errorf("MinVersion = %x, want TLS 1.3", config.MinVersion)
+				}
+			},
+		},
+		{
+			name:    "Unknown minimal version",
+			cfg:     TLS{MinVersion: "1.4"},
+			wantErr: `unknown minVersion "1.4"`,
+		},
+		{
+			name: "CA bundle",
+			cfg:  TLS{CA: inline(certPEM)},
+			check: func(t *testing.T, config *tls.Config) {
+				if config.RootCAs == nil {
+					t.Error("RootCAs = nil, want the system pool with the bundle")
+				}
+			},
+		},
+		{
+			name:    "CA without certificates",
+			cfg:     TLS{CA: inline([]byte("not a certificate"))},
+			wantErr: "ca contains no PEM certificate",
+		},
+		{
+			name:    "Missing CA file",
+			cfg:     TLS{CA: EnvInlineOrPath{Path: "./testdata/missing.pem"}},
+			wantErr: "unable to read ca: open ./testdata/missing.pem: no such file or directory",
+		},
+		{
+			name: "Client certificate",
+			cfg:  TLS{ClientCert: inline(certPEM), ClientKey: inline(keyPEM)},
+			check: func(t *testing.T, config *tls.Config) {
+				if len(config.Certificates) != 1 {
+					t.Errorf("Certificates = %v, want the client certificate", len(config.Certificates))
+				}
+			},
+		},
+		{
+			name:    "Client certificate without key",
+			cfg:     TLS{ClientCert: inline(certPEM)},
+			wantErr: "clientCert and clientKey must be used together",
+		},
+		{
+			name:    "Client key of another certificate",
+			cfg:     TLS{ClientCert: inline(certPEM), ClientKey: inline(otherKeyPEM)},
+			wantErr: "invalid client certificate: tls: private key does not match public key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := LoadTLSConfig(&tt.cfg)
+			if got := errorString(err); got != tt.wantErr {
+				t.Fatalf("LoadTLSConfig() error = %q, want %q", got, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (config == nil) != tt.wantNil {
+				t.Fatalf("LoadTLSConfig() = %v, want nil %v", config, tt.wantNil)
+			}
+			if tt.check != nil {
+				tt.check(t, config)
+			}
+		})
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,443 @@
+package appConfig
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"tweek-gateway/utils"
+)
+
+// KnownServices are the upstream services V2 routes can be forwarded to
+var KnownServices = []string{"api", "authoring"}
+
+var upstreamServices = []string{"api", "authoring", "publishing", "editor"}
+
+// maxRetryAttempts is the attempts limit of oxy's buffer
+const maxRetryAttempts = 10
+
+var balancers = []string{"round-robin", "least-connections"}
+
+var validMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// ValidationErrors holds all the problems found in a configuration
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e *ValidationErrors) add(format string, args ...interface{}) {
+	*e = append(*e, fmt.Errorf(format, args...))
+}
+
+// Validate checks the configuration, and returns all the problems found in it
+func Validate(conf *Configuration) ValidationErrors {
+	errs := ValidationErrors{}
+
+	validateServer(&conf.Server, &errs)
+	validateUpstreams(&conf.Upstreams, &errs)
+	validateV2Routes(conf.V2Routes, &errs)
+	validateCors(&conf.Security.Cors, &errs)
+	validateAttributes(&conf.Security.Attributes, &errs)
+	validateEnrichment(&conf.Security.Enrichment, &errs)
+	validateDuration("security.breakGlass.maxDuration", conf.Security.BreakGlass.MaxDuration, &errs)
+	validateSecretKey(&conf.Security.TweekSecretKey, &errs)
+	validateTLS("security.auth.jwks_tls", &conf.Security.Auth.JWKSTLS, &errs)
+	validateProviders(conf.Security.Auth.Providers, &errs)
+	validatePolicyStorage(&conf.Security.PolicyStorage, &errs)
+	validateWatch(&conf.Watch, &errs)
+	validateBatch(&conf.Batch, &errs)
+
+	return errs
+}
+
+func validateServer(server *Server, errs *ValidationErrors) {
+	if len(server.Ports) == 0 {
+		errs.add("server.ports: at least one port is required")
+	}
+	for _, port := range server.Ports {
+		if port <= 0 || port > 65535 {
+			errs.add("server.ports: invalid port %d", port)
+		}
+	}
+	if server.GRPCPort < 0 || server.GRPCPort > 65535 {
+		errs.add("server.grpcPort: invalid port %d", server.GRPCPort)
+	}
+	for _, port := range server.Ports {
+		if server.GRPCPort > 0 && port == server.GRPCPort {
+			errs.add("server.grpcPort: port %d is already used by server.ports", port)
+		}
+	}
+}
+
+func validateUpstreams(upstreams *Upstreams, errs *ValidationErrors) {
+	all := []struct {
+		name     string
+		upstream string
+		required bool
+	}{
+		{"api", upstreams.API, true},
+		{"authoring", upstreams.Authoring, true},
+		{"publishing", upstreams.Publishing, false},
+		{"editor", upstreams.Editor, false},
+	}
+
+	for _, u := range all {
+		if len(u.upstream) == 0 {
+			if u.required {
+				errs.add("upstreams.%s: upstream is required", u.name)
+			}
+			continue
+		}
+		validateURL("upstreams."+u.name, u.upstream, errs)
+	}
+
+	names := make([]string, 0, len(upstreams.Options))
+	for name := range upstreams.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := "upstreams.options." + name
+		if !utils.ContainsString(upstreamServices, name) {
+			errs.add("%s: unknown service, expected one of %v", field, upstreamServices)
+			continue
+		}
+		validateUpstreamOptions(field, upstreams.Options[name], errs)
+	}
+}
+
+func validateUpstreamOptions(field string, options UpstreamOptions, errs *ValidationErrors) {
+	for i, target := range options.Targets {
+		validateURL(fmt.Sprintf("%s.targets[%d]", field, i), target, errs)
+	}
+	if options.Resolve && len(options.Targets) > 0 {
+		errs.add("%s: targets and resolve can't be used together", field)
+	}
+	if len(options.Balancer) > 0 && !utils.ContainsString(balancers, options.Balancer) {
+		errs.add("%s.balancer: unknown balancer %q, expected one of %v", field, options.Balancer, balancers)
+	}
+
+	validateDuration(field+".resolveInterval", options.ResolveInterval, errs)
+	validateDuration(field+".healthCheck.interval", options.HealthCheck.Interval, errs)
+	validateDuration(field+".healthCheck.timeout", options.HealthCheck.Timeout, errs)
+	validateDuration(field+".passiveHealthCheck.ejectionDuration", options.PassiveHealthCheck.EjectionDuration, errs)
+
+	if options.HealthCheck.UnhealthyThreshold < 0 || options.HealthCheck.HealthyThreshold < 0 {
+		errs.add("%s.healthCheck: thresholds must not be negative", field)
+	}
+	if options.PassiveHealthCheck.MaxFailures < 0 {
+		errs.add("%s.passiveHealthCheck.maxFailures: must not be negative", field)
+	}
+
+	validateCircuitBreaker(field+".circuitBreaker", options.CircuitBreaker, errs)
+	validateTimeouts(field+".timeouts", options.Timeouts, errs)
+	validateRetry(field+".retry", options.Retry, errs)
+	validateBody(field, options.Body, options.Retry, errs)
+
+	validateTLS(field+".tls", &options.TLS, errs)
+}
+
+func validateTLS(field string, cfg *TLS, errs *ValidationErrors) {
+	if _, err := LoadTLSConfig(cfg); err != nil {
+		errs.add("%s: %v", field, err)
+	}
+}
+
+func validateTimeouts(field string, timeouts Timeouts, errs *ValidationErrors) {
+	validateDuration(field+".connect", timeouts.Connect, errs)
+	validateDuration(field+".read", timeouts.Read, errs)
+	validateDuration(field+".total", timeouts.Total, errs)
+}
+
+func validateRetry(field string, retry Retry, errs *ValidationErrors) {
+	if retry.Attempts < 0 || retry.Attempts > maxRetryAttempts {
+		errs.add("%s.attempts: must be between 0 and %d", field, maxRetryAttempts)
+	}
+	for _, method := range retry.Methods {
+		if !utils.ContainsString(validMethods, strings.ToUpper(method)) {
+			errs.add("%s.methods: invalid method %q", field, method)
+		}
+	}
+	for _, code := range retry.StatusCodes {
+		if code < 100 || code > 599 {
+			errs.add("%s.statusCodes: invalid status code %d", field, code)
+		}
+	}
+	validateDuration(field+".backoff", retry.Backoff, errs)
+}
+
+func validateBody(field string, body Body, retry Retry, errs *ValidationErrors) {
+	if body.MaxRequestBytes < 0 {
+		errs.add("%s.body.maxRequestBytes: must not be negative", field)
+	}
+	if body.MaxResponseBytes < 0 {
+		errs.add("%s.body.maxResponseBytes: must not be negative", field)
+	}
+	if body.Streaming && retry.Attempts > 1 {
+		errs.add("%s: streamed requests can't be retried, remove retry or body.streaming", field)
+	}
+}
+
+func validateCircuitBreaker(field string, breaker CircuitBreaker, errs *ValidationErrors) {
+	if !breaker.Enabled {
+		return
+	}
+
+	if breaker.ErrorRatio < 0 || breaker.ErrorRatio > 1 {
+		errs.add("%s.errorRatio: must be between 0 and 1", field)
+	}
+	if breaker.LatencyQuantile < 0 || breaker.LatencyQuantile > 100 {
+		errs.add("%s.latencyQuantile: must be between 0 and 100", field)
+	}
+	if breaker.ErrorRatio == 0 && len(breaker.LatencyThreshold) == 0 && len(breaker.Expression) == 0 {
+		errs.add("%s: either errorRatio, latencyThreshold or expression is required", field)
+	}
+
+	validateDuration(field+".latencyThreshold", breaker.LatencyThreshold, errs)
+	validateDuration(field+".fallbackDuration", breaker.FallbackDuration, errs)
+	validateDuration(field+".recoveryDuration", breaker.RecoveryDuration, errs)
+	validateDuration(field+".checkPeriod", breaker.CheckPeriod, errs)
+}
+
+func validateV2Routes(routes []V2Route, errs *ValidationErrors) {
+	type routeMethod struct{ prefix, method string }
+	seen := map[routeMethod]int{}
+
+	for i, route := range routes {
+		field := fmt.Sprintf("v2Routes[%d] (%s)", i, route.RoutePathPrefix)
+
+		if !strings.HasPrefix(route.RoutePathPrefix, "/") {
+			errs.add("%s: routePathPrefix must start with '/'", field)
+		}
+		if _, err := regexp.Compile(route.RouteRegexp); err != nil {
+			errs.add("%s: invalid routeRegexp: %v", field, err)
+		}
+		if !utils.ContainsString(KnownServices, route.Service) {
+			errs.add("%s: unknown service %q, expected one of %v", field, route.Service, KnownServices)
+		}
+		if len(route.Methods) == 0 {
+			errs.add("%s: at least one method is required", field)
+		}
+		validateCircuitBreaker(field+".circuitBreaker", route.CircuitBreaker, errs)
+		validateTimeouts(field+".timeouts", route.Timeouts, errs)
+		validateRetry(field+".retry", route.Retry, errs)
+		validateBody(field, route.Body, route.Retry, errs)
+
+		for _, method := range route.Methods {
+			method = strings.ToUpper(method)
+			if !utils.ContainsString(validMethods, method) {
+				errs.add("%s: invalid method %q", field, method)
+				continue
+			}
+			key := routeMethod{route.RoutePathPrefix, method}
+			if previous, ok := seen[key]; ok {
+				errs.add("%s: %s conflicts with v2Routes[%d], which has the same path prefix and method", field, method, previous)
+				continue
+			}
+			seen[key] = i
+		}
+	}
+}
+
+// credentialHeaders hold secrets, which shouldn't be passed to the policies
+var credentialHeaders = []string{"Authorization", "X-Client-Secret", "Cookie"}
+
+func validateAttributes(attributes *Attributes, errs *ValidationErrors) {
+	for _, header := range attributes.Headers {
+		name := http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if len(name) == 0 {
+			errs.add("security.attributes.headers: header name is required")
+		} else if utils.ContainsString(credentialHeaders, name) {
+			errs.add("security.attributes.headers: %s holds credentials, and can't be passed to policies", name)
+		}
+	}
+	if _, err := attributes.TrustedNetworks(); err != nil {
+		errs.add("security.attributes.trustedProxies: %v", err)
+	}
+	if len(attributes.TrustedProxies) > 0 && !attributes.ForwardedFor {
+		errs.add("security.attributes.trustedProxies: requires forwardedFor")
+	}
+}
+
+func validateEnrichment(enrichment *Enrichment, errs *ValidationErrors) {
+	if len(enrichment.URL) > 0 && len(enrichment.MappingObject) > 0 {
+		errs.add("security.enrichment: url and mappingObject can't be used together")
+	}
+	if len(enrichment.URL) > 0 {
+		validateURL("security.enrichment.url", enrichment.URL, errs)
+	}
+	if object := enrichment.MappingObject; len(object) > 0 && !validPublishedObject(object, enrichmentFolder, ".json", ".csv") {
+		errs.add("security.enrichment.mappingObject: %q must be a .json or .csv object in %s", object, enrichmentFolder)
+	}
+	validateDuration("security.enrichment.timeout", enrichment.Timeout, errs)
+	validateDuration("security.enrichment.cacheTTL", enrichment.CacheTTL, errs)
+}
+
+func validateCors(cors *Cors, errs *ValidationErrors) {
+	if !cors.Enabled {
+		return
+	}
+
+	if cors.MaxAge < 0 {
+		errs.add("security.cors.maxAge: must not be negative")
+	}
+	for _, origin := range cors.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if strings.Count(origin, "*") > 1 {
+			errs.add("security.cors.allowedOrigins: %q may contain at most one wildcard", origin)
+			continue
+		}
+		if u, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1)); err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			errs.add("security.cors.allowedOrigins: %q is not a valid origin", origin)
+		}
+	}
+	for _, method := range cors.AllowedMethods {
+		if !utils.ContainsString(validMethods, strings.ToUpper(method)) {
+			errs.add("security.cors.allowedMethods: invalid method %q", method)
+		}
+	}
+}
+
+func validateSecretKey(key *EnvInlineOrPath, errs *ValidationErrors) {
+	if len(key.Inline) == 0 && len(key.Path) == 0 {
+		errs.add("security.tweekSecretKey: either path or inline value is required")
+		return
+	}
+
+	value, err := HandleEnvInlineOrPath(key)
+	if err != nil {
+		errs.add("security.tweekSecretKey: unable to read key: %v", err)
+		return
+	}
+	if block, _ := pem.Decode(value); block == nil {
+		errs.add("security.tweekSecretKey: no PEM block found")
+	}
+}
+
+func validateProviders(providers map[string]AuthProvider, errs *ValidationErrors) {
+	keys := make([]string, 0, len(providers))
+	for key := range providers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	issuers := map[string]string{}
+	for _, key := range keys {
+		provider := providers[key]
+		field := "security.auth.providers." + key
+
+		if len(provider.Issuer) == 0 {
+			errs.add("%s: issuer is required", field)
+		} else if other, ok := issuers[provider.Issuer]; ok {
+			errs.add("%s: issuer %q is already used by provider %s", field, provider.Issuer, other)
+		} else {
+			issuers[provider.Issuer] = key
+		}
+
+		if len(provider.JWKSURL) == 0 {
+			errs.add("%s: jwks_uri is required", field)
+		} else {
+			validateURL(field+".jwks_uri", provider.JWKSURL, errs)
+		}
+		validateTLS(field+".jwks_tls", &provider.JWKSTLS, errs)
+
+		if len(provider.Name) == 0 {
+			errs.add("%s: name is required", field)
+		}
+		if len(provider.LoginInfo.LoginType) == 0 {
+			errs.add("%s: login_info.login_type is required", field)
+		}
+		if rules := provider.SubjectExtractionRules; len(rules) > 0 && !validPublishedObject(rules, providerRulesFolder, ".rego") {
+			errs.add("%s: subject_extraction_rules %q must be a .rego object in %s", field, rules, providerRulesFolder)
+		}
+	}
+}
+
+// providerRulesFolder and enrichmentFolder hold the objects, which are published from the repository as is
+const (
+	providerRulesFolder = "security/subject_extraction_rules/"
+	enrichmentFolder    = "security/enrichment/"
+)
+
+// validPublishedObject returns true if name is an object of the folder, with one of the extensions
+func validPublishedObject(name, folder string, extensions ...string) bool {
+	if !strings.HasPrefix(name, folder) {
+		return false
+	}
+	validExtension := false
+	for _, extension := range extensions {
+		validExtension = validExtension || strings.HasSuffix(name, extension)
+	}
+	if !validExtension {
+		return false
+	}
+	for _, segment := range strings.Split(strings.TrimPrefix(name, folder), "/") {
+		if segment == ".." || segment == "." || len(segment) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func validatePolicyStorage(storage *PolicyStorage, errs *ValidationErrors) {
+	validateDuration("security.policyStorage.pollInterval", storage.PollInterval, errs)
+	if len(storage.NatsEndpoint) == 0 && len(storage.PollInterval) == 0 {
+		errs.add("security.policyStorage: either natsEndpoint or pollInterval is required to receive policy updates")
+	}
+}
+
+func validateWatch(watch *Watch, errs *ValidationErrors) {
+	validateDuration("watch.heartbeatInterval", watch.HeartbeatInterval, errs)
+	if watch.MaxConnectionsPerSubject < 0 {
+		errs.add("watch.maxConnectionsPerSubject: must not be negative")
+	}
+}
+
+func validateBatch(batch *Batch, errs *ValidationErrors) {
+	if batch.MaxItems < 0 {
+		errs.add("batch.maxItems: must not be negative")
+	}
+	if batch.Concurrency < 0 {
+		errs.add("batch.concurrency: must not be negative")
+	}
+	if batch.MaxBytes < 0 {
+		errs.add("batch.maxBytes: must not be negative")
+	}
+}
+
+func validateDuration(field, value string, errs *ValidationErrors) {
+	if len(value) == 0 {
+		return
+	}
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		errs.add("%s: %q is not a positive duration", field, value)
+	}
+}
+
+func validateURL(field, value string, errs *ValidationErrors) {
+	u, err := url.Parse(value)
+	if err != nil {
+		errs.add("%s: invalid URL %q: %v", field, value, err)
+		return
+	}
+	if len(u.Scheme) == 0 || len(u.Host) == 0 {
+		errs.add("%s: URL %q must be absolute", field, value)
+	}
+}
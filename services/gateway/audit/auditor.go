@@ -1,5 +1,7 @@
 package audit
 
+import "time"
+
 // Auditor is the interface which defines auditing
 type Auditor interface {
 	// Allowed sends indication that the action was allowed
@@ -10,4 +12,12 @@ type Auditor interface {
 	AuthorizerError(subject, object, action string, err error)
 	// TokenError sends indication that user supplied invalid token
 	TokenError(err error)
+	// Filtered sends indication that parts of an allowed response were removed, as the subject isn't allowed to read them
+	Filtered(subject, object, action string, count int)
+	// BreakGlassGranted sends indication that the subject was granted temporary elevated access to a role
+	BreakGlassGranted(subject, role, justification string, expiresAt time.Time)
+	// BreakGlassRequest sends indication that a request was made under the break-glass roles of the subject
+	BreakGlassRequest(subject, method, path string, roles []string)
+	// WithBreakGlass returns an Auditor which marks its entries as made under the break-glass roles of the subject
+	WithBreakGlass(roles []string) Auditor
 }
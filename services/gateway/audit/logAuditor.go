@@ -2,6 +2,7 @@ package audit
 
 import (
 	"io"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -35,3 +36,19 @@ func (a *logAuditor) AuthorizerError(subject, object, action string, err error)
 func (a *logAuditor) TokenError(err error) {
 	a.log.WithError(err).Error("TOKEN ERROR")
 }
+
+func (a *logAuditor) Filtered(subject, object, action string, count int) {
+	a.log.WithFields(logrus.Fields{"subject": subject, "object": object, "action": action, "filtered": count}).Info("ACCESS FILTERED")
+}
+
+func (a *logAuditor) BreakGlassGranted(subject, role, justification string, expiresAt time.Time) {
+	a.log.WithFields(logrus.Fields{"subject": subject, "role": role, "justification": justification, "expiresAt": expiresAt, "breakGlass": true}).Warn("BREAK GLASS GRANTED")
+}
+
+func (a *logAuditor) WithBreakGlass(roles []string) Auditor {
+	return &logAuditor{log: a.log.WithFields(logrus.Fields{"roles": roles, "breakGlass": true})}
+}
+
+func (a *logAuditor) BreakGlassRequest(subject, method, path string, roles []string) {
+	a.log.WithFields(logrus.Fields{"subject": subject, "method": method, "path": path, "roles": roles, "breakGlass": true}).Warn("BREAK GLASS REQUEST")
+}
@@ -1,17 +1,30 @@
 package authorization
 
+# input contexts hold all the requested identity ids of each identity type
+
 context_items_mismatch(from_input,from_data) = true {
-    a = from_input[i]
+    a = from_input[i][_]
     b = from_data[i]
     not match_wildcards(a, b)
 }
 
+context_items_unmatched(from_input,from_data) = true {
+    values = from_input[i]
+    b = from_data[i]
+    not any_match_wildcards(values, b)
+}
+
+any_match_wildcards(values,b) = true {
+    match_wildcards(values[_], b)
+}
+
 context_items_count_mismatch(from_input,from_data) = true {
     a = { item | from_input[item] }
     b = { item | from_data[item] }
     a != b
 }
 
+# every identity id is matched, so allowing policies permit all of them
 match_contexts(from_input,from_data) = true {
     not context_items_mismatch(from_input, from_data)
     not context_items_count_mismatch(from_input, from_data)
@@ -20,6 +33,15 @@ match_contexts(from_input,from_data) = true {
     idx = "*"
 }
 
+# some identity id of each type is matched, so denying policies apply if any of them is denied
+match_any_contexts(from_input,from_data) = true {
+    not context_items_unmatched(from_input, from_data)
+    not context_items_count_mismatch(from_input, from_data)
+} else = true {
+    from_data[idx]
+    idx = "*"
+}
+
 match_wildcards(a,b) = true {
     a = b
 } else = true {
@@ -37,27 +59,231 @@ match_with_prefix(a,b) = true {
     a = b
 }
 
+# subjects may belong to several groups, and policies match if any of them does.
+# inputs without groups have only the primary group
+input_groups = groups {
+    groups = input.groups
+} else = [input.group] {
+    true
+}
+
+match_groups(from_data) = true {
+    match_wildcards(input_groups[_], from_data)
+}
+
+# reads of a key path are also matched by the policies of the whole repository, for backwards compatibility
+match_object(object,action,from_data,p) = true {
+    match_with_prefix(object, from_data)
+} else = true {
+    action = "read"
+    startswith(object, "repo/keys/")
+    from_data = "repo"
+    includes_keys(p)
+}
+
+# allowing policies of the repository exclude reads of its key paths with "includeKeys": false,
+# scoping the subject to the key paths it is allowed to read. denying policies of the repository always include them
+includes_keys(p) = true {
+    p.effect = "deny"
+} else = true {
+    object.get(p, "includeKeys", true) = true
+}
+
+# roles are named sets of grants, which may inherit the grants of other roles.
+# bindings of users and groups to roles are expanded into policies of the bound subject
+role_graph[name] = inherits {
+    role = data.roles[name]
+    inherits = object.get(role, "inherits", [])
+}
+
+bound_roles[role] {
+    binding = data.bindings[_]
+    match_wildcards(input.user, object.get(binding, "user", "*"))
+    match_groups(object.get(binding, "group", "*"))
+    role = graph.reachable(role_graph, {binding.role})[_]
+}
+
+# roles granted temporarily by break-glass requests
+bound_roles[role] {
+    granted = {granted_role | granted_role = input.break_glass_roles[_]}
+    role = graph.reachable(role_graph, granted)[_]
+}
+
+policies[p] {
+    p = data.policies[_]
+}
+
+policies[p] {
+    grant = data.roles[bound_roles[_]].grants[_]
+    defaults = {"contexts": {}, "effect": "allow"}
+    p = object.union(object.union(defaults, grant), {"user": "*", "group": "*"})
+}
+
+# policy objects and contexts may have placeholders, which are resolved against the subject:
+# ${user}, ${group} (each of the subject's groups), ${claim.<name>} and ${attribute.<name>} of string claims and attributes.
+# values with wildcards or placeholders aren't substituted. allowing policies with unresolved placeholders don't match,
+# while in denying policies they match any value, so denials fail closed on missing claims and attributes.
+# in contexts, ${user} is resolved to "self", as the subject's own identity ids are
+placeholder_value(value) = true {
+    is_string(value)
+    not contains(value, "*")
+    not contains(value, "${")
+}
+
+claim_placeholders = {name: value | value = input.claims[claim]; placeholder_value(value); name = sprintf("${claim.%s}", [claim])}
+
+attribute_placeholders = {name: value | value = input.attributes[attribute]; placeholder_value(value); name = sprintf("${attribute.%s}", [attribute])}
+
+user_placeholder = {"${user}": input.user} {
+    placeholder_value(input.user)
+} else = {} {
+    true
+}
+
+group_placeholder(group) = {"${group}": group} {
+    placeholder_value(group)
+} else = {} {
+    true
+}
+
+placeholders[values] {
+    group = input_groups[_]
+    values = object.union(object.union(object.union(claim_placeholders, attribute_placeholders), user_placeholder), group_placeholder(group))
+}
+
+resolve(template,values) = template {
+    not contains(template, "${")
+} else = resolved {
+    resolved = strings.replace_n(values, template)
+    not contains(resolved, "${")
+}
+
+resolve_contexts(from_data,values) = resolved {
+    context_values = object.union(values, {"${user}": "self"})
+    resolved = {identity_type: value | template = from_data[identity_type]; value = resolve(template, context_values)}
+    count(resolved) = count(from_data)
+}
+
+deny_resolve(template,values) = resolved {
+    resolved = resolve(template, values)
+} else = wildcard {
+    partial = strings.replace_n(values, template)
+    wildcard = concat("", [split(partial, "${")[0], "*"])
+}
+
+deny_resolve_contexts(from_data,values) = resolved {
+    context_values = object.union(values, {"${user}": "self"})
+    resolved = {identity_type: value | template = from_data[identity_type]; value = deny_resolve_context(template, context_values)}
+}
+
+deny_resolve_context(template,values) = resolved {
+    resolved = resolve(template, values)
+} else = "*" {
+    true
+}
+
+# policies and role grants may be bounded in time by "notBefore" and "expiresAt" RFC3339 timestamps,
+# where expiresAt is excluded
+match_validity(p) = true {
+    not before_validity(p)
+    not after_validity(p)
+}
+
+before_validity(p) = true {
+    p.notBefore
+    not valid_since(p.notBefore)
+}
+
+after_validity(p) = true {
+    p.expiresAt
+    not valid_until(p.expiresAt)
+}
+
+valid_since(timestamp) = true {
+    input.time >= time.parse_rfc3339_ns(timestamp)
+}
+
+valid_until(timestamp) = true {
+    input.time < time.parse_rfc3339_ns(timestamp)
+}
+
+# policies may be limited by conditions on the request attributes, all of which must be met:
+# "source_ips" - CIDRs of the allowed source IPs
+# "hours" - a time window {"from": 9, "to": 18, "timezone": "Europe/London", "weekdays": ["Monday"]},
+#           where "to" is excluded, and windows ending before they start span midnight
+match_conditions(p) = true {
+    not p.conditions
+} else = true {
+    not source_ips_mismatch(p.conditions)
+    not hours_mismatch(p.conditions)
+}
+
+source_ips_mismatch(conditions) = true {
+    conditions.source_ips
+    not match_cidrs(conditions.source_ips, input.source_ip)
+}
+
+match_cidrs(cidrs,ip) = true {
+    net.cidr_contains(cidrs[_], ip)
+}
+
+hours_mismatch(conditions) = true {
+    conditions.hours
+    not match_time_window(conditions.hours, input.time)
+}
+
+match_time_window(window,ns) = true {
+    t = [ns, object.get(window, "timezone", "UTC")]
+    [hour, _, _] = time.clock(t)
+    match_hours(hour, object.get(window, "from", 0), object.get(window, "to", 24))
+    match_weekdays(object.get(window, "weekdays", []), time.weekday(t))
+}
+
+match_hours(hour,from,to) = true {
+    from <= to
+    hour >= from
+    hour < to
+} else = true {
+    from > to
+    hour >= from
+} else = true {
+    from > to
+    hour < to
+}
+
+match_weekdays(weekdays,day) = true {
+    count(weekdays) = 0
+} else = true {
+    weekdays[_] = day
+}
+
 default allow = false
 
 allow = true {
-    p = data.policies[_]
+    p = policies[_]
     match_wildcards(input.user, p.user)
-    match_wildcards(input.group, p.group)
+    match_groups(p.group)
     match_wildcards(input.action, p.action)
-    match_with_prefix(input.object, p.object)
+    values = placeholders[_]
+    match_object(input.object, input.action, resolve(p.object, values), p)
     p.effect = "allow"
-    match_contexts(input.contexts, p.contexts)
+    match_contexts(input.contexts, resolve_contexts(p.contexts, values))
+    match_conditions(p)
+    match_validity(p)
 }
 
 default deny = false
 deny = true {
-    p = data.policies[_]
+    p = policies[_]
     match_wildcards(input.user, p.user)
-    match_wildcards(input.group, p.group)
+    match_groups(p.group)
     match_wildcards(input.action, p.action)
-    match_with_prefix(input.object, p.object)
+    values = placeholders[_]
+    match_object(input.object, input.action, deny_resolve(p.object, values), p)
     p.effect = "deny"
-    match_contexts(input.contexts, p.contexts)
+    match_any_contexts(input.contexts, deny_resolve_contexts(p.contexts, values))
+    match_conditions(p)
+    match_validity(p)
 }
 
 default authorize = false
@@ -0,0 +1,199 @@
+package circuitBreaker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/metrics"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+	"github.com/vulcand/oxy/cbreaker"
+)
+
+// Breaker states
+const (
+	Closed   = "closed"
+	HalfOpen = "half-open"
+	Open     = "open"
+)
+
+var states = []string{Closed, HalfOpen, Open}
+
+type nextKeyType string
+
+const nextKey nextKeyType = "CircuitBreakerNext"
+
+// Breaker fails requests fast while the handlers it wraps are degraded.
+// A single breaker can wrap several handlers, which share its state
+type Breaker struct {
+	name  string
+	cb    *cbreaker.CircuitBreaker
+	state int32
+}
+
+// New creates a breaker from the configuration, or returns nil if it's not enabled
+func New(name string, cfg appConfig.CircuitBreaker) (*Breaker, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	expression, err := Expression(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid circuit breaker %s: %v", name, err)
+	}
+
+	// oxy logs every request rejected by the breaker as a warning, the transitions are logged here instead
+	logger := logrus.New()
+	logger.Formatter = logrus.StandardLogger().Formatter
+	logger.SetLevel(logrus.ErrorLevel)
+
+	b := &Breaker{name: name}
+	options := []cbreaker.CircuitBreakerOption{
+		cbreaker.Logger(logger),
+		cbreaker.Fallback(http.HandlerFunc(b.fallback)),
+		cbreaker.OnTripped(sideEffect(func() { b.setState(Open) })),
+		cbreaker.OnStandby(sideEffect(func() { b.setState(Closed) })),
+	}
+
+	durations := []struct {
+		value  string
+		option func(time.Duration) cbreaker.CircuitBreakerOption
+	}{
+		{cfg.FallbackDuration, cbreaker.FallbackDuration},
+		{cfg.RecoveryDuration, cbreaker.RecoveryDuration},
+		{cfg.CheckPeriod, cbreaker.CheckPeriod},
+	}
+	for _, d := range durations {
+		if len(d.value) == 0 {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid circuit breaker %s: %v", name, err)
+		}
+		options = append(options, d.option(duration))
+	}
+
+	b.cb, err = cbreaker.New(http.HandlerFunc(serveNext), expression, options...)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid circuit breaker %s: %v", name, err)
+	}
+
+	metrics.CircuitBreakerState.WithLabelValues(name).Set(0)
+	return b, nil
+}
+
+// Expression builds the oxy expression which trips the breaker
+func Expression(cfg appConfig.CircuitBreaker) (string, error) {
+	if len(cfg.Expression) > 0 {
+		return cfg.Expression, nil
+	}
+
+	conditions := []string{}
+	if cfg.ErrorRatio > 0 {
+		conditions = append(conditions,
+			fmt.Sprintf("NetworkErrorRatio() > %v", cfg.ErrorRatio),
+			fmt.Sprintf("ResponseCodeRatio(500, 600, 0, 600) > %v", cfg.ErrorRatio),
+		)
+	}
+	if len(cfg.LatencyThreshold) > 0 {
+		threshold, err := time.ParseDuration(cfg.LatencyThreshold)
+		if err != nil {
+			return "", err
+		}
+		quantile := cfg.LatencyQuantile
+		if quantile == 0 {
+			quantile = 50
+		}
+		conditions = append(conditions, fmt.Sprintf("LatencyAtQuantileMS(%.1f) > %d", quantile, threshold.Milliseconds()))
+	}
+
+	if len(conditions) == 0 {
+		return "", fmt.Errorf("either errorRatio, latencyThreshold or expression is required")
+	}
+	return strings.Join(conditions, " || "), nil
+}
+
+// Wrap returns a handler which passes requests to next through the breaker. A nil breaker returns next
+func (b *Breaker) Wrap(next http.Handler) http.Handler {
+	if b == nil {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		b.cb.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), nextKey, b.probe(next))))
+	})
+}
+
+// Middleware returns a middleware which passes requests to the next handlers through the breaker
+func (b *Breaker) Middleware() negroni.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		b.Wrap(next).ServeHTTP(rw, r)
+	}
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() string {
+	if b == nil {
+		return Closed
+	}
+	return states[atomic.LoadInt32(&b.state)]
+}
+
+// probe marks the breaker as half-open when a request is let through while it's open
+func (b *Breaker) probe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&b.state) == stateIndex(Open) {
+			b.setState(HalfOpen)
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (b *Breaker) setState(state string) {
+	index := stateIndex(state)
+	if atomic.SwapInt32(&b.state, index) == index {
+		return
+	}
+
+	metrics.CircuitBreakerTransitions.WithLabelValues(b.name, state).Inc()
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(index))
+	logrus.WithField("breaker", b.name).WithField("state", state).Warn("Circuit breaker state changed")
+}
+
+func (b *Breaker) fallback(rw http.ResponseWriter, r *http.Request) {
+	body, _ := json.Marshal(map[string]string{
+		"error":   http.StatusText(http.StatusServiceUnavailable),
+		"message": fmt.Sprintf("%s is unavailable, circuit breaker is open", b.name),
+	})
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusServiceUnavailable)
+	rw.Write(body)
+}
+
+func serveNext(rw http.ResponseWriter, r *http.Request) {
+	r.Context().Value(nextKey).(http.Handler).ServeHTTP(rw, r)
+}
+
+func stateIndex(state string) int32 {
+	for i, s := range states {
+		if s == state {
+			return int32(i)
+		}
+	}
+	return 0
+}
+
+type sideEffect func()
+
+func (s sideEffect) Exec() error {
+	s()
+	return nil
+}
@@ -0,0 +1,125 @@
+package circuitBreaker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tweek-gateway/appConfig"
+)
+
+func TestExpression(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     appConfig.CircuitBreaker
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Error ratio",
+			cfg:  appConfig.CircuitBreaker{ErrorRatio: 0.5},
+			want: "NetworkErrorRatio() > 0.5 || ResponseCodeRatio(500, 600, 0, 600) > 0.5",
+		},
+		{
+			name: "Latency",
+			cfg:  appConfig.CircuitBreaker{LatencyThreshold: "1.5s", LatencyQuantile: 95},
+			want: "LatencyAtQuantileMS(95.0) > 1500",
+		},
+		{
+			name: "Expression",
+			cfg:  appConfig.CircuitBreaker{ErrorRatio: 0.5, Expression: "NetworkErrorRatio() > 0.1"},
+			want: "NetworkErrorRatio() > 0.1",
+		},
+		{
+			name:    "No conditions",
+			cfg:     appConfig.CircuitBreaker{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expression(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expression() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Expression() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_Disabled(t *testing.T) {
+	breaker, err := New("disabled", appConfig.CircuitBreaker{ErrorRatio: 0.5})
+	if err != nil || breaker != nil {
+		t.Fatalf("New() = %v, %v, want nil breaker", breaker, err)
+	}
+
+	next := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})
+	if breaker.Wrap(next) == nil || breaker.State() != Closed {
+		t.Error("A nil breaker should pass requests through")
+	}
+}
+
+func TestBreaker_Transitions(t *testing.T) {
+	breaker, err := New("test", appConfig.CircuitBreaker{
+		Enabled:          true,
+		ErrorRatio:       0.5,
+		CheckPeriod:      "1ms",
+		FallbackDuration: "50ms",
+		RecoveryDuration: "50ms",
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	status := http.StatusInternalServerError
+	handler := breaker.Wrap(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(status)
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/v2/keys", nil))
+		return recorder
+	}
+
+	for i := 0; i < 10; i++ {
+		serve()
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	recorder := serve()
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Status code = %v, want %v after errors", recorder.Code, http.StatusServiceUnavailable)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body["error"] != "Service Unavailable" {
+		t.Errorf("Fallback body = %s, want JSON error", recorder.Body.String())
+	}
+	waitForState(t, breaker, Open)
+
+	status = http.StatusOK
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 100 && breaker.State() != HalfOpen; i++ {
+		serve()
+	}
+	waitForState(t, breaker, HalfOpen)
+
+	time.Sleep(60 * time.Millisecond)
+	if recorder := serve(); recorder.Code != http.StatusOK {
+		t.Errorf("Status code = %v, want %v after recovery", recorder.Code, http.StatusOK)
+	}
+	waitForState(t, breaker, Closed)
+}
+
+func waitForState(t *testing.T, breaker *Breaker, state string) {
+	t.Helper()
+	for i := 0; i < 100 && breaker.State() != state; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if got := breaker.State(); got != state {
+		t.Fatalf("State() = %v, want %v", got, state)
+	}
+}
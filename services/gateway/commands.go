@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/policyTest"
+)
+
+// command is a subcommand of the gateway executable, returning the process exit code
+type command func(args []string) int
+
+var commands = map[string]command{
+	"validate-config": validateConfigCommand,
+	"policy":          policyCommand,
+}
+
+var policyCommands = map[string]command{
+	"test": policyTestCommand,
+}
+
+func runCommand(name string, args []string) int {
+	return dispatch(commands, name, args)
+}
+
+func dispatch(commands map[string]command, name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\nAvailable commands:\n", name)
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %s\n", name)
+		}
+		return 2
+	}
+	return cmd(args)
+}
+
+func validateConfigCommand(args []string) int {
+	flags := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	configFilePath := flags.String("config", "", "path of the gateway config file, instead of the configured one")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	configuration, err := appConfig.LoadConfigFrom(*configFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load configuration: %v\n", err)
+		return 1
+	}
+
+	errs := appConfig.Validate(configuration)
+	if len(errs) == 0 {
+		fmt.Printf("Configuration is valid (%v)\n", configuration.Files())
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "Configuration is invalid, found %d problem(s):\n", len(errs))
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "  - %v\n", err)
+	}
+	return 1
+}
+
+func policyCommand(args []string) int {
+	if len(args) == 0 {
+		return dispatch(policyCommands, "", nil)
+	}
+	return dispatch(policyCommands, args[0], args[1:])
+}
+
+// pathsFlag collects a flag which may be given multiple times, or as a comma separated list
+type pathsFlag []string
+
+func (p *pathsFlag) String() string { return strings.Join(*p, ",") }
+
+func (p *pathsFlag) Set(value string) error {
+	*p = append(*p, strings.Split(value, ",")...)
+	return nil
+}
+
+func policyTestCommand(args []string) int {
+	flags := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	authorizationPath := flags.String("authorization", "authorization.rego", "path of the authorization rules")
+	policyPath := flags.String("policy", "", "path of the policy.json to test")
+	rulesPath := flags.String("subject-rules", "", "path of the subject_extraction_rules.rego, required for cases with claims of external issuers")
+	casesPath := flags.String("cases", "", "path of a JSON file with sample requests and their expected decisions")
+	verbose := flags.Bool("v", false, "print passing tests as well")
+	var testPaths pathsFlag
+	flags.Var(&testPaths, "tests", "paths of rego unit tests (files or directories), may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if len(*policyPath) == 0 || (len(testPaths) == 0 && len(*casesPath) == 0) {
+		fmt.Fprintln(os.Stderr, "-policy and at least one of -tests or -cases are required")
+		flags.Usage()
+		return 2
+	}
+
+	suite, err := policyTest.NewSuite(*authorizationPath, *policyPath, *rulesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load policies: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	passed, failed := 0, 0
+
+	if len(testPaths) > 0 {
+		results, err := suite.RunRegoTests(ctx, testPaths...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to run rego tests: %v\n", err)
+			return 1
+		}
+
+		fmt.Println("Rego tests:")
+		for _, result := range results {
+			if result.Pass() {
+				passed++
+				if *verbose {
+					fmt.Printf("  PASS %s.%s\n", result.Package, result.Name)
+				}
+				continue
+			}
+			failed++
+			fmt.Printf("  FAIL %s.%s (%s)\n", result.Package, result.Name, result.Location)
+			if result.Error != nil {
+				fmt.Printf("       error: %v\n", result.Error)
+			} else if result.FailedAt != nil {
+				fmt.Printf("       failed at: %v\n", result.FailedAt)
+			}
+		}
+	}
+
+	if len(*casesPath) > 0 {
+		cases, err := policyTest.LoadCases(*casesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to load cases: %v\n", err)
+			return 1
+		}
+
+		fmt.Println("Sample requests:")
+		for _, c := range cases {
+			result := suite.Evaluate(ctx, c)
+			if result.Pass() {
+				passed++
+				if !*verbose {
+					continue
+				}
+				fmt.Printf("  PASS %s: %s %s\n", c.Name, c.Method, c.Path)
+			} else {
+				failed++
+				fmt.Printf("  FAIL %s: %s %s\n", c.Name, c.Method, c.Path)
+			}
+			fmt.Printf("       expected: %s, actual: %s\n", result.Expected, result.Actual)
+			if result.Subject != nil {
+				fmt.Printf("       subject: %s, action: %s, object: %s, contexts: %v\n", result.Subject, result.Action, result.Object.Item, result.Object.Contexts)
+			}
+			if result.Err != nil {
+				fmt.Printf("       error: %v\n", result.Err)
+			}
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
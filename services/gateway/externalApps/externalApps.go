@@ -8,9 +8,10 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"runtime"
 	"time"
 	"tweek-gateway/appConfig"
+	"tweek-gateway/revisionWatcher"
+	"tweek-gateway/snapshot"
 
 	minio "github.com/minio/minio-go"
 	nats "github.com/nats-io/nats.go"
@@ -33,11 +34,12 @@ type SecretKey struct {
 }
 
 type externalAppsRepo struct {
-	externalApps     map[string]ExternalApp
-	natsSubscription *nats.Subscription
-	minioClient      *minio.Client
+	externalApps map[string]ExternalApp
+	minioClient  *minio.Client
 }
 
+const externalAppsObject = "external_apps.json"
+
 var repo externalAppsRepo
 
 // ValidateCredentials - checks appID and secretKey are valid
@@ -79,7 +81,7 @@ func compareKeys(appKey SecretKey, secretKey string) bool {
 	return hash == appKey.Hash
 }
 
-func verifyMinioReadiness(mc *minio.Client, bucket string) {
+func verifyMinioReadiness(mc *minio.Client, bucket string) error {
 	for i := 0; ; i++ {
 		found, err := mc.BucketExists(bucket)
 		if err == nil && !found {
@@ -90,19 +92,19 @@ func verifyMinioReadiness(mc *minio.Client, bucket string) {
 		}
 		if err == nil {
 			logrus.Infoln("Minio bucket is ready")
-			break
-		} else {
-			if i > 10 {
-				logrus.WithError(err).Panic("Minio bucket not ready")
-			}
-			logrus.WithError(err).Infoln("retrying getting Minio bucket")
-			time.Sleep(2 * time.Second)
+			return nil
+		}
+		if i > 10 {
+			logrus.WithError(err).Error("Minio bucket not ready")
+			return err
 		}
+		logrus.WithError(err).Infoln("retrying getting Minio bucket")
+		time.Sleep(2 * time.Second)
 	}
 }
 
 // Init - function to init external apps
-func Init(cfg *appConfig.PolicyStorage) {
+func Init(cfg *appConfig.PolicyStorage, watcher *revisionWatcher.Watcher, snapshots *snapshot.Store) {
 	logrus.Info("Initializing external apps...")
 	repo = externalAppsRepo{}
 
@@ -112,45 +114,63 @@ func Init(cfg *appConfig.PolicyStorage) {
 	}
 	repo.minioClient = client
 
-	nc, err := nats.Connect(cfg.NatsEndpoint)
+	err = verifyMinioReadiness(client, cfg.MinioBucketName)
+	if err == nil {
+		err = loadApps(cfg, snapshots)
+	}
 	if err != nil {
-		logrus.WithError(err).Panic("External apps init error")
+		if snapshotErr := loadAppsFromSnapshot(snapshots); snapshotErr != nil {
+			logrus.WithError(err).Panic("External apps init error")
+		}
+		snapshots.SetDegraded(externalAppsObject, err)
+		snapshots.Recover(externalAppsObject, func() error { return loadApps(cfg, snapshots) })
 	}
 
-	verifyMinioReadiness(client, cfg.MinioBucketName)
-
-	subscription, err := nc.Subscribe("version", refreshApps(cfg))
-	repo.natsSubscription = subscription
-	runtime.SetFinalizer(&repo, finalizer)
-
-	refreshApps(cfg)(&nats.Msg{})
+	watcher.Subscribe(refreshApps(cfg, snapshots))
 }
 
-func refreshApps(cfg *appConfig.PolicyStorage) nats.MsgHandler {
+func refreshApps(cfg *appConfig.PolicyStorage, snapshots *snapshot.Store) nats.MsgHandler {
 	return func(msg *nats.Msg) {
 		logrus.Info("Refreshing external apps...")
-		reader, err := repo.minioClient.GetObject(cfg.MinioBucketName, "external_apps.json", minio.GetObjectOptions{})
-		if err != nil {
-			logrus.WithError(err).Panic("Get external apps from minio failed")
-		}
-		defer reader.Close()
-		buf, err := ioutil.ReadAll(reader)
-		if err != nil {
-			logrus.WithError(err).Panic("Read external apps object failed")
+		if err := loadApps(cfg, snapshots); err != nil {
+			logrus.WithError(err).Error("Refresh external apps failed")
+			return
 		}
-		var extApps map[string]ExternalApp
-		err = json.Unmarshal(buf, &extApps)
-		if err != nil {
-			logrus.WithError(err).Panic("Refresh app failed: deserialize object")
-		}
-		repo.externalApps = extApps
+		snapshots.ClearDegraded(externalAppsObject)
 		logrus.Info("Done refreshing external apps.")
 	}
 }
 
-func finalizer(r *externalAppsRepo) {
-	if r.natsSubscription != nil && r.natsSubscription.IsValid() {
-		r.natsSubscription.Unsubscribe()
+func loadApps(cfg *appConfig.PolicyStorage, snapshots *snapshot.Store) error {
+	reader, err := repo.minioClient.GetObject(cfg.MinioBucketName, externalAppsObject, minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("Get external apps from minio failed: %v", err)
+	}
+	defer reader.Close()
+	buf, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("Read external apps object failed: %v", err)
+	}
+	if err = setApps(buf); err != nil {
+		return err
+	}
+	snapshots.Save(externalAppsObject, buf)
+	return nil
+}
+
+func loadAppsFromSnapshot(snapshots *snapshot.Store) error {
+	buf, err := snapshots.Load(externalAppsObject)
+	if err != nil {
+		return err
+	}
+	return setApps(buf)
+}
+
+func setApps(buf []byte) error {
+	var extApps map[string]ExternalApp
+	if err := json.Unmarshal(buf, &extApps); err != nil {
+		return fmt.Errorf("Refresh app failed: deserialize object: %v", err)
 	}
-	return
+	repo.externalApps = extApps
+	return nil
 }
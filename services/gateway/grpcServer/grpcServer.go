@@ -0,0 +1,196 @@
+package grpcServer
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tweek-gateway/grpcServer/tweekpb"
+	"tweek-gateway/security"
+	"tweek-gateway/utils"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// forwardedMetadata are the metadata keys passed as headers, which authenticate the request
+var forwardedMetadata = []string{"authorization", "x-client-id", "x-client-secret"}
+
+// server implements the gRPC service by serving the equivalent REST requests with the gateway's handler,
+// so calls go through the same authentication, authorization and routing to the api upstream
+type server struct {
+	tweekpb.UnimplementedTweekServer
+	handler http.Handler
+}
+
+// New creates a gRPC server for values and contexts, serving the calls with the gateway's handler
+func New(handler http.Handler) *grpc.Server {
+	s := grpc.NewServer()
+	tweekpb.RegisterTweekServer(s, &server{handler: handler})
+	return s
+}
+
+func (s *server) GetValues(ctx context.Context, req *tweekpb.GetValuesRequest) (*tweekpb.GetValuesResponse, error) {
+	keyPath := strings.Trim(req.KeyPath, "/")
+	if len(keyPath) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "key_path is required")
+	}
+
+	query := url.Values{}
+	for identityType, identityID := range req.Context {
+		query.Set(identityType, identityID)
+	}
+	for _, include := range req.Include {
+		query.Add("$include", include)
+	}
+	if req.Flatten {
+		query.Set("$flatten", "true")
+	}
+	if req.IgnoreKeyTypes {
+		query.Set("$ignoreKeyTypes", "true")
+	}
+
+	escaped, err := security.EscapeKeyPath(keyPath)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	body, err := s.serve(ctx, http.MethodGet, "/api/v2/values/"+escaped, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	values := &structpb.Value{}
+	if err := protojson.Unmarshal(body, values); err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid values response: %v", err)
+	}
+	return &tweekpb.GetValuesResponse{Values: values}, nil
+}
+
+func (s *server) GetContext(ctx context.Context, req *tweekpb.GetContextRequest) (*tweekpb.GetContextResponse, error) {
+	path, err := contextPath(req.IdentityType, req.IdentityId)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := s.serve(ctx, http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	properties := &structpb.Struct{}
+	if err := protojson.Unmarshal(body, properties); err != nil {
+		return nil, status.Errorf(codes.Internal, "invalid context response: %v", err)
+	}
+	return &tweekpb.GetContextResponse{Context: properties}, nil
+}
+
+func (s *server) UpdateContext(ctx context.Context, req *tweekpb.UpdateContextRequest) (*tweekpb.UpdateContextResponse, error) {
+	path, err := contextPath(req.IdentityType, req.IdentityId)
+	if err != nil {
+		return nil, err
+	}
+	if req.Context == nil {
+		return nil, status.Error(codes.InvalidArgument, "context is required")
+	}
+	data, err := protojson.Marshal(req.Context)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid context: %v", err)
+	}
+
+	if _, err := s.serve(ctx, http.MethodPost, path, nil, data); err != nil {
+		return nil, err
+	}
+	return &tweekpb.UpdateContextResponse{}, nil
+}
+
+func (s *server) DeleteContext(ctx context.Context, req *tweekpb.DeleteContextRequest) (*tweekpb.DeleteContextResponse, error) {
+	path, err := contextPath(req.IdentityType, req.IdentityId)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Property) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "property is required")
+	}
+
+	if _, err := s.serve(ctx, http.MethodDelete, path+"/"+url.PathEscape(req.Property), nil, nil); err != nil {
+		return nil, err
+	}
+	return &tweekpb.DeleteContextResponse{}, nil
+}
+
+// serve handles the REST request equivalent to a call, and returns the response body of successful requests
+func (s *server) serve(ctx context.Context, method, path string, query url.Values, body []byte) ([]byte, error) {
+	target := path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, "http://gateway"+target, bytes.NewReader(body))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid request: %v", err)
+	}
+	r.RequestURI = r.URL.RequestURI()
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, key := range forwardedMetadata {
+			for _, value := range md.Get(key) {
+				r.Header.Add(key, value)
+			}
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	rw := utils.NewResponseBuffer()
+	s.handler.ServeHTTP(rw, r)
+
+	if !rw.Success() {
+		return nil, status.Error(codeFromHTTP(rw.Code()), strings.TrimSpace(string(rw.Body())))
+	}
+	return rw.Body(), nil
+}
+
+func contextPath(identityType, identityID string) (string, error) {
+	if len(identityType) == 0 || len(identityID) == 0 {
+		return "", status.Error(codes.InvalidArgument, "identity_type and identity_id are required")
+	}
+	return "/api/v2/context/" + url.PathEscape(identityType) + "/" + url.PathEscape(identityID), nil
+}
+
+// codeFromHTTP maps the status codes of the gateway and the api to gRPC codes
+func codeFromHTTP(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if code >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
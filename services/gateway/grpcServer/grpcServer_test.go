@@ -0,0 +1,150 @@
+package grpcServer
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"tweek-gateway/grpcServer/tweekpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type request struct {
+	method        string
+	uri           string
+	body          string
+	authorization string
+}
+
+func TestServer(t *testing.T) {
+	var got request
+	handler := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = request{method: r.Method, uri: r.RequestURI, body: string(body), authorization: r.Header.Get("Authorization")}
+		switch {
+		case r.Header.Get("Authorization") == "":
+			http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+		case r.Method == http.MethodGet:
+			rw.Write([]byte(`{"country":"IL"}`))
+		}
+	})
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := New(handler)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer conn.Close()
+	client := tweekpb.NewTweekClient(conn)
+	authorized := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer token")
+
+	properties, _ := structpb.NewStruct(map[string]interface{}{"country": "IL"})
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		call     func(ctx context.Context) error
+		want     request
+		wantCode codes.Code
+	}{
+		{
+			name: "Get values",
+			ctx:  authorized,
+			call: func(ctx context.Context) error {
+				resp, err := client.GetValues(ctx, &tweekpb.GetValuesRequest{
+					KeyPath: "/path/_",
+					Context: map[string]string{"user": "alice"},
+					Include: []string{"path/key"},
+				})
+				if err == nil && resp.Values.GetStructValue().Fields["country"].GetStringValue() != "IL" {
+					t.Errorf("GetValues() = %v", resp.Values)
+				}
+				return err
+			},
+			want: request{method: "GET", uri: "/api/v2/values/path/_?%24include=path%2Fkey&user=alice", authorization: "Bearer token"},
+		},
+		{
+			name: "Get context",
+			ctx:  authorized,
+			call: func(ctx context.Context) error {
+				_, err := client.GetContext(ctx, &tweekpb.GetContextRequest{IdentityType: "user", IdentityId: "alice@tweek"})
+				return err
+			},
+			want: request{method: "GET", uri: "/api/v2/context/user/alice@tweek", authorization: "Bearer token"},
+		},
+		{
+			name: "Update context",
+			ctx:  authorized,
+			call: func(ctx context.Context) error {
+				_, err := client.UpdateContext(ctx, &tweekpb.UpdateContextRequest{IdentityType: "user", IdentityId: "alice", Context: properties})
+				return err
+			},
+			want: request{method: "POST", uri: "/api/v2/context/user/alice", body: `{"country":"IL"}`, authorization: "Bearer token"},
+		},
+		{
+			name: "Delete context property",
+			ctx:  authorized,
+			call: func(ctx context.Context) error {
+				_, err := client.DeleteContext(ctx, &tweekpb.DeleteContextRequest{IdentityType: "user", IdentityId: "alice", Property: "country"})
+				return err
+			},
+			want: request{method: "DELETE", uri: "/api/v2/context/user/alice/country", authorization: "Bearer token"},
+		},
+		{
+			name: "Unauthenticated",
+			ctx:  context.Background(),
+			call: func(ctx context.Context) error {
+				_, err := client.GetContext(ctx, &tweekpb.GetContextRequest{IdentityType: "user", IdentityId: "alice"})
+				return err
+			},
+			want:     request{method: "GET", uri: "/api/v2/context/user/alice"},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name: "Missing property",
+			ctx:  authorized,
+			call: func(ctx context.Context) error {
+				_, err := client.DeleteContext(ctx, &tweekpb.DeleteContextRequest{IdentityType: "user", IdentityId: "alice"})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "Key path with dot segments",
+			ctx:  authorized,
+			call: func(ctx context.Context) error {
+				_, err := client.GetValues(ctx, &tweekpb.GetValuesRequest{KeyPath: "allowed/../secret"})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = request{}
+			err := tt.call(tt.ctx)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("Call error = %v, want code %v", err, tt.wantCode)
+			}
+			if got != tt.want {
+				t.Errorf("Request = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
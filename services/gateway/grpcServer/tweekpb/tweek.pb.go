@@ -0,0 +1,549 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: tweek.proto
+
+package tweekpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetValuesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// key_path is a key, or a key path ending with `_` for all the keys under it
+	KeyPath string `protobuf:"bytes,1,opt,name=key_path,json=keyPath,proto3" json:"key_path,omitempty"`
+	// context maps identity types to identity ids
+	Context map[string]string `protobuf:"bytes,2,rep,name=context,proto3" json:"context,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// include limits the returned keys, like `$include`
+	Include []string `protobuf:"bytes,3,rep,name=include,proto3" json:"include,omitempty"`
+	// flatten returns a single level of key paths, like `$flatten`
+	Flatten bool `protobuf:"varint,4,opt,name=flatten,proto3" json:"flatten,omitempty"`
+	// ignore_key_types returns values as strings, like `$ignoreKeyTypes`
+	IgnoreKeyTypes bool `protobuf:"varint,5,opt,name=ignore_key_types,json=ignoreKeyTypes,proto3" json:"ignore_key_types,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *GetValuesRequest) Reset() {
+	*x = GetValuesRequest{}
+	mi := &file_tweek_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetValuesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetValuesRequest) ProtoMessage() {}
+
+func (x *GetValuesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tweek_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetValuesRequest.ProtoReflect.Descriptor instead.
+func (*GetValuesRequest) Descriptor() ([]byte, []int) {
+	return file_tweek_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetValuesRequest) GetKeyPath() string {
+	if x != nil {
+		return x.KeyPath
+	}
+	return ""
+}
+
+func (x *GetValuesRequest) GetContext() map[string]string {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+func (x *GetValuesRequest) GetInclude() []string {
+	if x != nil {
+		return x.Include
+	}
+	return nil
+}
+
+func (x *GetValuesRequest) GetFlatten() bool {
+	if x != nil {
+		return x.Flatten
+	}
+	return false
+}
+
+func (x *GetValuesRequest) GetIgnoreKeyTypes() bool {
+	if x != nil {
+		return x.IgnoreKeyTypes
+	}
+	return false
+}
+
+type GetValuesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        *structpb.Value        `protobuf:"bytes,1,opt,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetValuesResponse) Reset() {
+	*x = GetValuesResponse{}
+	mi := &file_tweek_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetValuesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetValuesResponse) ProtoMessage() {}
+
+func (x *GetValuesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tweek_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetValuesResponse.ProtoReflect.Descriptor instead.
+func (*GetValuesResponse) Descriptor() ([]byte, []int) {
+	return file_tweek_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetValuesResponse) GetValues() *structpb.Value {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type GetContextRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IdentityType  string                 `protobuf:"bytes,1,opt,name=identity_type,json=identityType,proto3" json:"identity_type,omitempty"`
+	IdentityId    string                 `protobuf:"bytes,2,opt,name=identity_id,json=identityId,proto3" json:"identity_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetContextRequest) Reset() {
+	*x = GetContextRequest{}
+	mi := &file_tweek_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetContextRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetContextRequest) ProtoMessage() {}
+
+func (x *GetContextRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tweek_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetContextRequest.ProtoReflect.Descriptor instead.
+func (*GetContextRequest) Descriptor() ([]byte, []int) {
+	return file_tweek_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetContextRequest) GetIdentityType() string {
+	if x != nil {
+		return x.IdentityType
+	}
+	return ""
+}
+
+func (x *GetContextRequest) GetIdentityId() string {
+	if x != nil {
+		return x.IdentityId
+	}
+	return ""
+}
+
+type GetContextResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Context       *structpb.Struct       `protobuf:"bytes,1,opt,name=context,proto3" json:"context,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetContextResponse) Reset() {
+	*x = GetContextResponse{}
+	mi := &file_tweek_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetContextResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetContextResponse) ProtoMessage() {}
+
+func (x *GetContextResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tweek_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetContextResponse.ProtoReflect.Descriptor instead.
+func (*GetContextResponse) Descriptor() ([]byte, []int) {
+	return file_tweek_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetContextResponse) GetContext() *structpb.Struct {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+type UpdateContextRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	IdentityType string                 `protobuf:"bytes,1,opt,name=identity_type,json=identityType,proto3" json:"identity_type,omitempty"`
+	IdentityId   string                 `protobuf:"bytes,2,opt,name=identity_id,json=identityId,proto3" json:"identity_id,omitempty"`
+	// context holds the properties to set
+	Context       *structpb.Struct `protobuf:"bytes,3,opt,name=context,proto3" json:"context,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateContextRequest) Reset() {
+	*x = UpdateContextRequest{}
+	mi := &file_tweek_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateContextRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateContextRequest) ProtoMessage() {}
+
+func (x *UpdateContextRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tweek_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateContextRequest.ProtoReflect.Descriptor instead.
+func (*UpdateContextRequest) Descriptor() ([]byte, []int) {
+	return file_tweek_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *UpdateContextRequest) GetIdentityType() string {
+	if x != nil {
+		return x.IdentityType
+	}
+	return ""
+}
+
+func (x *UpdateContextRequest) GetIdentityId() string {
+	if x != nil {
+		return x.IdentityId
+	}
+	return ""
+}
+
+func (x *UpdateContextRequest) GetContext() *structpb.Struct {
+	if x != nil {
+		return x.Context
+	}
+	return nil
+}
+
+type UpdateContextResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateContextResponse) Reset() {
+	*x = UpdateContextResponse{}
+	mi := &file_tweek_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateContextResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateContextResponse) ProtoMessage() {}
+
+func (x *UpdateContextResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tweek_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateContextResponse.ProtoReflect.Descriptor instead.
+func (*UpdateContextResponse) Descriptor() ([]byte, []int) {
+	return file_tweek_proto_rawDescGZIP(), []int{5}
+}
+
+type DeleteContextRequest struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	IdentityType string                 `protobuf:"bytes,1,opt,name=identity_type,json=identityType,proto3" json:"identity_type,omitempty"`
+	IdentityId   string                 `protobuf:"bytes,2,opt,name=identity_id,json=identityId,proto3" json:"identity_id,omitempty"`
+	// property is the property to delete, required
+	Property      string `protobuf:"bytes,3,opt,name=property,proto3" json:"property,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteContextRequest) Reset() {
+	*x = DeleteContextRequest{}
+	mi := &file_tweek_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteContextRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteContextRequest) ProtoMessage() {}
+
+func (x *DeleteContextRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tweek_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteContextRequest.ProtoReflect.Descriptor instead.
+func (*DeleteContextRequest) Descriptor() ([]byte, []int) {
+	return file_tweek_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteContextRequest) GetIdentityType() string {
+	if x != nil {
+		return x.IdentityType
+	}
+	return ""
+}
+
+func (x *DeleteContextRequest) GetIdentityId() string {
+	if x != nil {
+		return x.IdentityId
+	}
+	return ""
+}
+
+func (x *DeleteContextRequest) GetProperty() string {
+	if x != nil {
+		return x.Property
+	}
+	return ""
+}
+
+type DeleteContextResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteContextResponse) Reset() {
+	*x = DeleteContextResponse{}
+	mi := &file_tweek_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteContextResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteContextResponse) ProtoMessage() {}
+
+func (x *DeleteContextResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tweek_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteContextResponse.ProtoReflect.Descriptor instead.
+func (*DeleteContextResponse) Descriptor() ([]byte, []int) {
+	return file_tweek_proto_rawDescGZIP(), []int{7}
+}
+
+var File_tweek_proto protoreflect.FileDescriptor
+
+const file_tweek_proto_rawDesc = "" +
+	"\n" +
+	"\vtweek.proto\x12\x10tweek.gateway.v1\x1a\x1cgoogle/protobuf/struct.proto\"\x92\x02\n" +
+	"\x10GetValuesRequest\x12\x19\n" +
+	"\bkey_path\x18\x01 \x01(\tR\akeyPath\x12I\n" +
+	"\acontext\x18\x02 \x03(\v2/.tweek.gateway.v1.GetValuesRequest.ContextEntryR\acontext\x12\x18\n" +
+	"\ainclude\x18\x03 \x03(\tR\ainclude\x12\x18\n" +
+	"\aflatten\x18\x04 \x01(\bR\aflatten\x12(\n" +
+	"\x10ignore_key_types\x18\x05 \x01(\bR\x0eignoreKeyTypes\x1a:\n" +
+	"\fContextEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"C\n" +
+	"\x11GetValuesResponse\x12.\n" +
+	"\x06values\x18\x01 \x01(\v2\x16.google.protobuf.ValueR\x06values\"Y\n" +
+	"\x11GetContextRequest\x12#\n" +
+	"\ridentity_type\x18\x01 \x01(\tR\fidentityType\x12\x1f\n" +
+	"\videntity_id\x18\x02 \x01(\tR\n" +
+	"identityId\"G\n" +
+	"\x12GetContextResponse\x121\n" +
+	"\acontext\x18\x01 \x01(\v2\x17.google.protobuf.StructR\acontext\"\x8f\x01\n" +
+	"\x14UpdateContextRequest\x12#\n" +
+	"\ridentity_type\x18\x01 \x01(\tR\fidentityType\x12\x1f\n" +
+	"\videntity_id\x18\x02 \x01(\tR\n" +
+	"identityId\x121\n" +
+	"\acontext\x18\x03 \x01(\v2\x17.google.protobuf.StructR\acontext\"\x17\n" +
+	"\x15UpdateContextResponse\"x\n" +
+	"\x14DeleteContextRequest\x12#\n" +
+	"\ridentity_type\x18\x01 \x01(\tR\fidentityType\x12\x1f\n" +
+	"\videntity_id\x18\x02 \x01(\tR\n" +
+	"identityId\x12\x1a\n" +
+	"\bproperty\x18\x03 \x01(\tR\bproperty\"\x17\n" +
+	"\x15DeleteContextResponse2\xfa\x02\n" +
+	"\x05Tweek\x12T\n" +
+	"\tGetValues\x12\".tweek.gateway.v1.GetValuesRequest\x1a#.tweek.gateway.v1.GetValuesResponse\x12W\n" +
+	"\n" +
+	"GetContext\x12#.tweek.gateway.v1.GetContextRequest\x1a$.tweek.gateway.v1.GetContextResponse\x12`\n" +
+	"\rUpdateContext\x12&.tweek.gateway.v1.UpdateContextRequest\x1a'.tweek.gateway.v1.UpdateContextResponse\x12`\n" +
+	"\rDeleteContext\x12&.tweek.gateway.v1.DeleteContextRequest\x1a'.tweek.gateway.v1.DeleteContextResponseB\"Z tweek-gateway/grpcServer/tweekpbb\x06proto3"
+
+var (
+	file_tweek_proto_rawDescOnce sync.Once
+	file_tweek_proto_rawDescData []byte
+)
+
+func file_tweek_proto_rawDescGZIP() []byte {
+	file_tweek_proto_rawDescOnce.Do(func() {
+		file_tweek_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_tweek_proto_rawDesc), len(file_tweek_proto_rawDesc)))
+	})
+	return file_tweek_proto_rawDescData
+}
+
+var file_tweek_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_tweek_proto_goTypes = []any{
+	(*GetValuesRequest)(nil),      // 0: tweek.gateway.v1.GetValuesRequest
+	(*GetValuesResponse)(nil),     // 1: tweek.gateway.v1.GetValuesResponse
+	(*GetContextRequest)(nil),     // 2: tweek.gateway.v1.GetContextRequest
+	(*GetContextResponse)(nil),    // 3: tweek.gateway.v1.GetContextResponse
+	(*UpdateContextRequest)(nil),  // 4: tweek.gateway.v1.UpdateContextRequest
+	(*UpdateContextResponse)(nil), // 5: tweek.gateway.v1.UpdateContextResponse
+	(*DeleteContextRequest)(nil),  // 6: tweek.gateway.v1.DeleteContextRequest
+	(*DeleteContextResponse)(nil), // 7: tweek.gateway.v1.DeleteContextResponse
+	nil,                           // 8: tweek.gateway.v1.GetValuesRequest.ContextEntry
+	(*structpb.Value)(nil),        // 9: google.protobuf.Value
+	(*structpb.Struct)(nil),       // 10: google.protobuf.Struct
+}
+var file_tweek_proto_depIdxs = []int32{
+	8,  // 0: tweek.gateway.v1.GetValuesRequest.context:type_name -> tweek.gateway.v1.GetValuesRequest.ContextEntry
+	9,  // 1: tweek.gateway.v1.GetValuesResponse.values:type_name -> google.protobuf.Value
+	10, // 2: tweek.gateway.v1.GetContextResponse.context:type_name -> google.protobuf.Struct
+	10, // 3: tweek.gateway.v1.UpdateContextRequest.context:type_name -> google.protobuf.Struct
+	0,  // 4: tweek.gateway.v1.Tweek.GetValues:input_type -> tweek.gateway.v1.GetValuesRequest
+	2,  // 5: tweek.gateway.v1.Tweek.GetContext:input_type -> tweek.gateway.v1.GetContextRequest
+	4,  // 6: tweek.gateway.v1.Tweek.UpdateContext:input_type -> tweek.gateway.v1.UpdateContextRequest
+	6,  // 7: tweek.gateway.v1.Tweek.DeleteContext:input_type -> tweek.gateway.v1.DeleteContextRequest
+	1,  // 8: tweek.gateway.v1.Tweek.GetValues:output_type -> tweek.gateway.v1.GetValuesResponse
+	3,  // 9: tweek.gateway.v1.Tweek.GetContext:output_type -> tweek.gateway.v1.GetContextResponse
+	5,  // 10: tweek.gateway.v1.Tweek.UpdateContext:output_type -> tweek.gateway.v1.UpdateContextResponse
+	7,  // 11: tweek.gateway.v1.Tweek.DeleteContext:output_type -> tweek.gateway.v1.DeleteContextResponse
+	8,  // [8:12] is the sub-list for method output_type
+	4,  // [4:8] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_tweek_proto_init() }
+func file_tweek_proto_init() {
+	if File_tweek_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tweek_proto_rawDesc), len(file_tweek_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_tweek_proto_goTypes,
+		DependencyIndexes: file_tweek_proto_depIdxs,
+		MessageInfos:      file_tweek_proto_msgTypes,
+	}.Build()
+	File_tweek_proto = out.File
+	file_tweek_proto_goTypes = nil
+	file_tweek_proto_depIdxs = nil
+}
@@ -0,0 +1,241 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: tweek.proto
+
+package tweekpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Tweek_GetValues_FullMethodName     = "/tweek.gateway.v1.Tweek/GetValues"
+	Tweek_GetContext_FullMethodName    = "/tweek.gateway.v1.Tweek/GetContext"
+	Tweek_UpdateContext_FullMethodName = "/tweek.gateway.v1.Tweek/UpdateContext"
+	Tweek_DeleteContext_FullMethodName = "/tweek.gateway.v1.Tweek/DeleteContext"
+)
+
+// TweekClient is the client API for Tweek service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Tweek serves values and contexts like the `/api/v2/values` and `/api/v2/context` routes.
+// Requests are authenticated by the `authorization`, `x-client-id` and `x-client-secret` metadata
+type TweekClient interface {
+	GetValues(ctx context.Context, in *GetValuesRequest, opts ...grpc.CallOption) (*GetValuesResponse, error)
+	GetContext(ctx context.Context, in *GetContextRequest, opts ...grpc.CallOption) (*GetContextResponse, error)
+	UpdateContext(ctx context.Context, in *UpdateContextRequest, opts ...grpc.CallOption) (*UpdateContextResponse, error)
+	DeleteContext(ctx context.Context, in *DeleteContextRequest, opts ...grpc.CallOption) (*DeleteContextResponse, error)
+}
+
+type tweekClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTweekClient(cc grpc.ClientConnInterface) TweekClient {
+	return &tweekClient{cc}
+}
+
+func (c *tweekClient) GetValues(ctx context.Context, in *GetValuesRequest, opts ...grpc.CallOption) (*GetValuesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetValuesResponse)
+	err := c.cc.Invoke(ctx, Tweek_GetValues_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tweekClient) GetContext(ctx context.Context, in *GetContextRequest, opts ...grpc.CallOption) (*GetContextResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetContextResponse)
+	err := c.cc.Invoke(ctx, Tweek_GetContext_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tweekClient) UpdateContext(ctx context.Context, in *UpdateContextRequest, opts ...grpc.CallOption) (*UpdateContextResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateContextResponse)
+	err := c.cc.Invoke(ctx, Tweek_UpdateContext_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tweekClient) DeleteContext(ctx context.Context, in *DeleteContextRequest, opts ...grpc.CallOption) (*DeleteContextResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteContextResponse)
+	err := c.cc.Invoke(ctx, Tweek_DeleteContext_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TweekServer is the server API for Tweek service.
+// All implementations must embed UnimplementedTweekServer
+// for forward compatibility.
+//
+// Tweek serves values and contexts like the `/api/v2/values` and `/api/v2/context` routes.
+// Requests are authenticated by the `authorization`, `x-client-id` and `x-client-secret` metadata
+type TweekServer interface {
+	GetValues(context.Context, *GetValuesRequest) (*GetValuesResponse, error)
+	GetContext(context.Context, *GetContextRequest) (*GetContextResponse, error)
+	UpdateContext(context.Context, *UpdateContextRequest) (*UpdateContextResponse, error)
+	DeleteContext(context.Context, *DeleteContextRequest) (*DeleteContextResponse, error)
+	mustEmbedUnimplementedTweekServer()
+}
+
+// UnimplementedTweekServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTweekServer struct{}
+
+func (UnimplementedTweekServer) GetValues(context.Context, *GetValuesRequest) (*GetValuesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetValues not implemented")
+}
+func (UnimplementedTweekServer) GetContext(context.Context, *GetContextRequest) (*GetContextResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetContext not implemented")
+}
+func (UnimplementedTweekServer) UpdateContext(context.Context, *UpdateContextRequest) (*UpdateContextResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateContext not implemented")
+}
+func (UnimplementedTweekServer) DeleteContext(context.Context, *DeleteContextRequest) (*DeleteContextResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteContext not implemented")
+}
+func (UnimplementedTweekServer) mustEmbedUnimplementedTweekServer() {}
+func (UnimplementedTweekServer) testEmbeddedByValue()               {}
+
+// UnsafeTweekServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TweekServer will
+// result in compilation errors.
+type UnsafeTweekServer interface {
+	mustEmbedUnimplementedTweekServer()
+}
+
+func RegisterTweekServer(s grpc.ServiceRegistrar, srv TweekServer) {
+	// If the following call pancis, it indicates UnimplementedTweekServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Tweek_ServiceDesc, srv)
+}
+
+func _Tweek_GetValues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetValuesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TweekServer).GetValues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tweek_GetValues_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TweekServer).GetValues(ctx, req.(*GetValuesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tweek_GetContext_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetContextRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TweekServer).GetContext(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tweek_GetContext_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TweekServer).GetContext(ctx, req.(*GetContextRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tweek_UpdateContext_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateContextRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TweekServer).UpdateContext(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tweek_UpdateContext_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TweekServer).UpdateContext(ctx, req.(*UpdateContextRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tweek_DeleteContext_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteContextRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TweekServer).DeleteContext(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tweek_DeleteContext_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TweekServer).DeleteContext(ctx, req.(*DeleteContextRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Tweek_ServiceDesc is the grpc.ServiceDesc for Tweek service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tweek_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tweek.gateway.v1.Tweek",
+	HandlerType: (*TweekServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetValues",
+			Handler:    _Tweek_GetValues_Handler,
+		},
+		{
+			MethodName: "GetContext",
+			Handler:    _Tweek_GetContext_Handler,
+		},
+		{
+			MethodName: "UpdateContext",
+			Handler:    _Tweek_UpdateContext_Handler,
+		},
+		{
+			MethodName: "DeleteContext",
+			Handler:    _Tweek_DeleteContext_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "tweek.proto",
+}
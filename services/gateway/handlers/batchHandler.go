@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/audit"
+	"tweek-gateway/security"
+	"tweek-gateway/utils"
+)
+
+const (
+	defaultBatchMaxItems    = 100
+	defaultBatchConcurrency = 10
+	defaultBatchMaxBytes    = 1 << 20
+)
+
+// BatchRequest is the body of a batch values request
+type BatchRequest struct {
+	// Context is shared by all the items
+	Context map[string]string `json:"context"`
+	Items   []BatchItem       `json:"items"`
+}
+
+// BatchItem is a key path in a batch values request, with a context merged over the shared one
+type BatchItem struct {
+	KeyPath string            `json:"keyPath"`
+	Context map[string]string `json:"context,omitempty"`
+}
+
+// BatchResult is the outcome of an item of a batch values request
+type BatchResult struct {
+	KeyPath string          `json:"keyPath"`
+	Status  int             `json:"status"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// BatchResponse is the body of a batch values response, with a result for each of the requested items
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// NewBatchValuesHandler - handler function that gets the values of several key paths in one request.
+// Each item is authorized like a separate values request, and the allowed ones are forwarded to the api concurrently
+func NewBatchValuesHandler(authorizer security.Authorizer, auditor audit.Auditor, api http.Handler, config *appConfig.Batch) http.HandlerFunc {
+	maxItems := config.MaxItems
+	if maxItems == 0 {
+		maxItems = defaultBatchMaxItems
+	}
+	concurrency := config.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	maxBytes := config.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = defaultBatchMaxBytes
+	}
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var batch BatchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxBytes)).Decode(&batch); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(rw, fmt.Sprintf("Batch request exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(rw, fmt.Sprintf("Invalid batch request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(batch.Items) == 0 {
+			http.Error(rw, "Batch request has no items", http.StatusBadRequest)
+			return
+		}
+		if len(batch.Items) > maxItems {
+			http.Error(rw, fmt.Sprintf("Batch request has more than %d items", maxItems), http.StatusBadRequest)
+			return
+		}
+		for _, item := range batch.Items {
+			if len(strings.Trim(item.KeyPath, "/")) == 0 {
+				http.Error(rw, "Batch item keyPath is required", http.StatusBadRequest)
+				return
+			}
+		}
+
+		results := make([]BatchResult, len(batch.Items))
+		semaphore := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, item := range batch.Items {
+			wg.Add(1)
+			go func(i int, item BatchItem) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+				results[i] = getItem(r, authorizer, auditor, api, item, batch.Context)
+			}(i, item)
+		}
+		wg.Wait()
+
+		rw.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(rw)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(BatchResponse{Results: results})
+	}
+}
+
+// getItem authorizes an item as a values request, and gets its value from the api
+func getItem(r *http.Request, authorizer security.Authorizer, auditor audit.Auditor, api http.Handler, item BatchItem, shared map[string]string) BatchResult {
+	result := BatchResult{KeyPath: item.KeyPath}
+	keyPath, err := security.EscapeKeyPath(strings.Trim(item.KeyPath, "/"))
+	if err != nil {
+		result.Status, result.Error = http.StatusForbidden, err.Error()
+		return result
+	}
+	query := url.Values{}
+	for identityType, identityID := range shared {
+		query.Set(identityType, identityID)
+	}
+	for identityType, identityID := range item.Context {
+		query.Set(identityType, identityID)
+	}
+
+	itemRequest, err := http.NewRequestWithContext(r.Context(), http.MethodGet, "/api/v2/values/"+keyPath+"?"+query.Encode(), nil)
+	if err != nil {
+		result.Status, result.Error = http.StatusBadRequest, err.Error()
+		return result
+	}
+	itemRequest.RequestURI = itemRequest.URL.RequestURI()
+	itemRequest.RemoteAddr = r.RemoteAddr
+
+	if status := security.Authorize(authorizer, auditor, itemRequest); status != http.StatusOK {
+		result.Status, result.Error = status, http.StatusText(status)
+		return result
+	}
+
+	upstreamRequest := itemRequest.Clone(r.Context())
+	upstreamRequest.RequestURI = ""
+	upstreamRequest.URL.Path = "/api/v1/keys/" + strings.Trim(item.KeyPath, "/")
+	upstreamRequest.URL.RawPath = "/api/v1/keys/" + keyPath
+	isFolder := security.IsFolderValuesRequest(itemRequest)
+	if isFolder {
+		upstreamRequest.URL.RawQuery = security.FlattenValuesQuery(query).Encode()
+	}
+
+	rw := utils.NewResponseBuffer()
+	api.ServeHTTP(rw, upstreamRequest)
+
+	result.Status = rw.Code()
+	if !rw.Success() {
+		result.Error = strings.TrimSpace(string(rw.Body()))
+		return result
+	}
+	if !json.Valid(rw.Body()) {
+		result.Status, result.Error = http.StatusBadGateway, "Invalid value from api"
+		return result
+	}
+	result.Value = rw.Body()
+	if isFolder {
+		if result.Value, err = security.FilterValues(authorizer, auditor, itemRequest, rw.Body()); err != nil {
+			result.Status, result.Value, result.Error = http.StatusBadGateway, nil, err.Error()
+		}
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/audit"
+	"tweek-gateway/security"
+
+	"github.com/sirupsen/logrus"
+)
+
+type testAuthorizer struct{}
+
+func (a *testAuthorizer) Authorize(ctx context.Context, subject *security.Subject, object security.PolicyResource, action string) (bool, error) {
+	return action == "read" && (strings.HasPrefix(object.Item, "values/allowed/") || !strings.HasSuffix(object.Item, "secret")), nil
+}
+
+func TestNewBatchValuesHandler(t *testing.T) {
+	api := http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/keys/missing" {
+			http.Error(rw, "Not Found", http.StatusNotFound)
+			return
+		}
+		if r.URL.Path == "/api/v1/keys/folder/_" && r.URL.Query().Get("$flatten") == "true" {
+			rw.Write([]byte(`{"data":{"sub/key":1,"sub/secret":2},"errors":{}}`))
+			return
+		}
+		rw.Write([]byte(`"` + r.URL.Path + "?" + r.URL.RawQuery + `"`))
+	})
+	auditor, _ := audit.NewLogger(logrus.WithField("type", "AUDIT"))
+	handler := NewBatchValuesHandler(&testAuthorizer{}, auditor, api, &appConfig.Batch{MaxItems: 3, MaxBytes: 200})
+	user := security.NewUserInfo(&security.Subject{User: "alice", Group: "default"}, "issuer", nil, &url.URL{})
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		want     []BatchResult
+	}{
+		{
+			name:     "Partial success",
+			body:     `{"context":{"user":"alice","country":"IL"},"items":[{"keyPath":"a/b"},{"keyPath":"/c","context":{"country":"US"}},{"keyPath":"secret"}]}`,
+			wantCode: http.StatusOK,
+			want: []BatchResult{
+				{KeyPath: "a/b", Status: http.StatusOK, Value: json.RawMessage(`"/api/v1/keys/a/b?country=IL&user=alice"`)},
+				{KeyPath: "/c", Status: http.StatusOK, Value: json.RawMessage(`"/api/v1/keys/c?country=US&user=alice"`)},
+				{KeyPath: "secret", Status: http.StatusForbidden, Error: "Forbidden"},
+			},
+		},
+		{
+			name:     "Dot segments",
+			body:     `{"items":[{"keyPath":"allowed/../secret"},{"keyPath":"allowed/./key"},{"keyPath":"allowed//key"}]}`,
+			wantCode: http.StatusOK,
+			want: []BatchResult{
+				{KeyPath: "allowed/../secret", Status: http.StatusForbidden, Error: security.ErrInvalidKeyPath.Error()},
+				{KeyPath: "allowed/./key", Status: http.StatusForbidden, Error: security.ErrInvalidKeyPath.Error()},
+				{KeyPath: "allowed//key", Status: http.StatusForbidden, Error: security.ErrInvalidKeyPath.Error()},
+			},
+		},
+		{
+			name:     "Upstream error",
+			body:     `{"items":[{"keyPath":"missing"}]}`,
+			wantCode: http.StatusOK,
+			want:     []BatchResult{{KeyPath: "missing", Status: http.StatusNotFound, Error: "Not Found"}},
+		},
+		{
+			name:     "Filtered folder",
+			body:     `{"items":[{"keyPath":"folder/_"}]}`,
+			wantCode: http.StatusOK,
+			want:     []BatchResult{{KeyPath: "folder/_", Status: http.StatusOK, Value: json.RawMessage(`{"sub":{"key":1}}`)}},
+		},
+		{
+			name:     "Too many items",
+			body:     `{"items":[{"keyPath":"a"},{"keyPath":"b"},{"keyPath":"c"},{"keyPath":"d"}]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Body too large",
+			body:     `{"items":[{"keyPath":"` + strings.Repeat("a", 200) + `"}]}`,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "Missing key path",
+			body:     `{"items":[{"keyPath":"/"}]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Invalid body",
+			body:     `[]`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/v2/values/batch", strings.NewReader(tt.body))
+			r = r.WithContext(context.WithValue(r.Context(), security.UserInfoKey, user))
+			recorder := httptest.NewRecorder()
+			handler(recorder, r)
+
+			if recorder.Code != tt.wantCode {
+				t.Fatalf("Status = %v, want %v", recorder.Code, tt.wantCode)
+			}
+			if tt.want == nil {
+				return
+			}
+			var got BatchResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Results, tt.want) {
+				t.Errorf("Results = %s, want %v", recorder.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"tweek-gateway/upstream"
+)
+
+// upstreamRequestTimeout limits the requests to the upstream services made by the status and version handlers
+const upstreamRequestTimeout = 5 * time.Second
+
+var client = &http.Client{Timeout: upstreamRequestTimeout}
+
+// clientFor returns a client with the transport of the upstream, which applies its TLS options
+func clientFor(pool *upstream.Pool) *http.Client {
+	if pool == nil {
+		return client
+	}
+	return &http.Client{Timeout: upstreamRequestTimeout, Transport: pool.Transport()}
+}
@@ -5,18 +5,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"runtime"
 	"sync"
 
 	"github.com/sirupsen/logrus"
 
-	nats "github.com/nats-io/nats.go"
-
-	"tweek-gateway/appConfig"
+	"tweek-gateway/revisionWatcher"
+	"tweek-gateway/snapshot"
+	"tweek-gateway/upstream"
 )
 
-var repoRevision string
-
 func toMap(sm *sync.Map) map[string]interface{} {
 	m := map[string]interface{}{}
 	sm.Range(func(k interface{}, v interface{}) bool {
@@ -27,23 +24,39 @@ func toMap(sm *sync.Map) map[string]interface{} {
 }
 
 // NewStatusHandler - handler function that returns versions for all services
-func NewStatusHandler(config *appConfig.Upstreams) http.HandlerFunc {
+func NewStatusHandler(pools upstream.Pools, watcher *revisionWatcher.Watcher, snapshots *snapshot.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		services := map[string]string{
-			"api":        config.API,
-			"authoring":  config.Authoring,
-			"publishing": config.Publishing,
+			"api":        "",
+			"authoring":  "",
+			"publishing": "",
 		}
+		instances := map[string][]upstream.TargetStatus{}
+		breakers := map[string]string{}
+		isHealthy := true
+
+		for name, pool := range pools {
+			instances[name] = pool.Status()
+			if breaker := pool.Breaker(); breaker != nil {
+				breakers[name] = breaker.State()
+			}
+			if _, checked := services[name]; checked {
+				services[name] = pool.Endpoint().String()
+				if !pool.Healthy() {
+					isHealthy = false
+				}
+			}
+		}
+
 		var wg sync.WaitGroup
 		wg.Add(len(services))
 
 		result := map[string]interface{}{}
 		var serviceStatuses sync.Map
-		isHealthy := true
 
 		for serviceName, serviceHost := range services {
 			go func(name, host string) {
-				serviceStatus, serviceIsHealthy := checkServiceStatus(name, host)
+				serviceStatus, serviceIsHealthy := checkServiceStatus(clientFor(pools[name]), name, host)
 				serviceStatuses.Store(name, serviceStatus)
 				if !serviceIsHealthy {
 					isHealthy = false
@@ -54,7 +67,16 @@ func NewStatusHandler(config *appConfig.Upstreams) http.HandlerFunc {
 		wg.Wait()
 
 		result["services"] = toMap(&serviceStatuses)
-		result["repository revision"] = repoRevision
+		result["upstreams"] = instances
+		if len(breakers) > 0 {
+			result["circuit breakers"] = breakers
+		}
+		result["repository revision"] = watcher.Revision()
+		result["revision updates"] = watcher.Status()
+
+		if degraded := snapshots.Degraded(); len(degraded) > 0 {
+			result["degraded"] = degraded
+		}
 
 		if !isHealthy {
 			result["message"] = "not all services are healthy"
@@ -75,28 +97,8 @@ func NewStatusHandler(config *appConfig.Upstreams) http.HandlerFunc {
 	}
 }
 
-// SetupRevisionUpdater creates revision updater
-func SetupRevisionUpdater(natsEndpoint string) {
-	nc, err := nats.Connect(natsEndpoint)
-	if err != nil {
-		logrus.WithField("natsEndpoint", natsEndpoint).Panic("Failed to connect to nats")
-	}
-
-	sub, err := nc.Subscribe("version", func(msg *nats.Msg) {
-		repoRevision = string(msg.Data)
-	})
-	if err != nil {
-		logrus.WithField("natsEndpoint", natsEndpoint).Panic("Failed to subscribe to subject 'version'")
-	}
-	runtime.SetFinalizer(&repoRevision, func(interface{}) {
-		if sub != nil && sub.IsValid() {
-			sub.Unsubscribe()
-		}
-	})
-}
-
-func checkServiceStatus(serviceName string, serviceHost string) (interface{}, bool) {
-	resp, err := http.Get(fmt.Sprintf("%s/health", serviceHost))
+func checkServiceStatus(client *http.Client, serviceName string, serviceHost string) (interface{}, bool) {
+	resp, err := client.Get(fmt.Sprintf("%s/health", serviceHost))
 
 	if err != nil || resp == nil {
 		logrus.WithError(err).WithField("serviceName", serviceName).Error("Service health request failed")
@@ -49,7 +49,7 @@ func Test_checkServiceStatus(t *testing.T) {
 
 			gock.New(HOST).Get("/health").Reply(tt.args.responseCode).JSON(tt.args.responseBody)
 			defer gock.Off()
-			status, isHealthy := checkServiceStatus(tt.args.serviceName, HOST)
+			status, isHealthy := checkServiceStatus(client, tt.args.serviceName, HOST)
 			println(isHealthy)
 			val, err := json.Marshal(status)
 			if err == nil {
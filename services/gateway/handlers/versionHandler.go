@@ -7,7 +7,7 @@ import (
 	"net/http"
 	"sync"
 
-	"tweek-gateway/appConfig"
+	"tweek-gateway/upstream"
 )
 
 type serviceInfo struct {
@@ -16,14 +16,14 @@ type serviceInfo struct {
 }
 
 // NewVersionHandler - handler function that returns versions for all services
-func NewVersionHandler(config *appConfig.Upstreams, selfVersion string) http.HandlerFunc {
+func NewVersionHandler(pools upstream.Pools, selfVersion string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var wg sync.WaitGroup
 		versions := map[string]*serviceInfo{
-			"api":        getServiceInfo(config.API, &wg),
-			"authoring":  getServiceInfo(config.Authoring, &wg),
-			"publishing": getServiceInfo(config.Publishing, &wg),
-			"gateway":    &serviceInfo{selfVersion, "healthy"},
+			"gateway": &serviceInfo{selfVersion, "healthy"},
+		}
+		for _, name := range []string{"api", "authoring", "publishing"} {
+			versions[name] = getServiceInfo(pools[name], &wg)
 		}
 		wg.Wait()
 
@@ -37,25 +37,30 @@ func NewVersionHandler(config *appConfig.Upstreams, selfVersion string) http.Han
 	}
 }
 
-func getServiceInfo(serviceHost string, wg *sync.WaitGroup) *serviceInfo {
+func getServiceInfo(pool *upstream.Pool, wg *sync.WaitGroup) *serviceInfo {
 	svcInfo := &serviceInfo{}
+	client := clientFor(pool)
+	serviceHost := ""
+	if pool != nil {
+		serviceHost = pool.Endpoint().String()
+	}
 
 	wg.Add(1)
 	go func(host string) {
 		defer wg.Done()
-		svcInfo.Status = getServiceHealth(host)
+		svcInfo.Status = getServiceHealth(client, host)
 	}(serviceHost)
 
 	wg.Add(1)
 	go func(host string) {
 		defer wg.Done()
-		svcInfo.Version = getServiceVersion(host)
+		svcInfo.Version = getServiceVersion(client, host)
 	}(serviceHost)
 	return svcInfo
 }
 
-func getServiceVersion(serviceHost string) string {
-	resp, err := http.Get(fmt.Sprintf("%s/version", serviceHost))
+func getServiceVersion(client *http.Client, serviceHost string) string {
+	resp, err := client.Get(fmt.Sprintf("%s/version", serviceHost))
 	if err != nil || resp.StatusCode != http.StatusOK {
 		return "error"
 	}
@@ -64,8 +69,8 @@ func getServiceVersion(serviceHost string) string {
 	return string(body)
 }
 
-func getServiceHealth(serviceHost string) string {
-	resp, err := http.Get(fmt.Sprintf("%s/health", serviceHost))
+func getServiceHealth(client *http.Client, serviceHost string) string {
+	resp, err := client.Get(fmt.Sprintf("%s/health", serviceHost))
 	if err != nil || resp.StatusCode != http.StatusOK {
 		return "unhealthy"
 	}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/revisionStream"
+	"tweek-gateway/security"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultHeartbeatInterval = 30 * time.Second
+
+// NewWatchHandler - handler function that streams the repository revisions as server-sent events.
+// Events can be filtered by the `keyPath` query parameter, and resumed with the `Last-Event-ID` header
+func NewWatchHandler(broker *revisionStream.Broker, config *appConfig.Watch) http.HandlerFunc {
+	heartbeatInterval := defaultHeartbeatInterval
+	if len(config.HeartbeatInterval) > 0 {
+		interval, err := time.ParseDuration(config.HeartbeatInterval)
+		if err != nil || interval <= 0 {
+			panic(fmt.Sprintf("Invalid watch heartbeat interval %q", config.HeartbeatInterval))
+		}
+		heartbeatInterval = interval
+	}
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			http.Error(rw, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		subject := "anonymous"
+		if user, ok := r.Context().Value(security.UserInfoKey).(security.UserInfo); ok {
+			subject = user.Sub().String()
+		}
+		if !broker.Acquire(subject, config.MaxConnectionsPerSubject) {
+			http.Error(rw, "Too many watch connections", http.StatusTooManyRequests)
+			return
+		}
+		defer broker.Release(subject)
+
+		keyPath := r.URL.Query().Get("keyPath")
+		backlog, events, cancel := broker.Subscribe(r.Header.Get("Last-Event-ID"))
+		defer cancel()
+
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Header().Set("X-Accel-Buffering", "no")
+		rw.WriteHeader(http.StatusOK)
+
+		for _, event := range backlog {
+			if event, ok := event.Under(keyPath); ok {
+				writeEvent(rw, event)
+			}
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					// the subscriber lagged behind, the client resumes from the history when reconnecting
+					return
+				}
+				// only the keys under the key path are sent, since the subscriber may not read others
+				event, ok = event.Under(keyPath)
+				if !ok {
+					continue
+				}
+				if err := writeEvent(rw, event); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(rw, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(rw http.ResponseWriter, event revisionStream.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to serialize revision event")
+		return err
+	}
+	_, err = fmt.Fprintf(rw, "id: %s\nevent: revision\ndata: %s\n\n", event.Revision, data)
+	return err
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/revisionStream"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+type testSource struct {
+	handlers []nats.MsgHandler
+}
+
+func (s *testSource) Subscribe(handler nats.MsgHandler) { s.handlers = append(s.handlers, handler) }
+func (s *testSource) Revision() string                  { return "rev-1" }
+
+func TestNewWatchHandler(t *testing.T) {
+	source := &testSource{}
+	broker := revisionStream.New(source, func(revision string) ([]string, error) {
+		return map[string][]string{"rev-2": {"other/key"}, "rev-3": {"path/key"}, "rev-4": {"other/key", "path/sub/key", "pathology/key"}}[revision], nil
+	})
+	server := httptest.NewServer(NewWatchHandler(broker, &appConfig.Watch{MaxConnectionsPerSubject: 1}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?keyPath=path")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Content-Type = %v, want text/event-stream", contentType)
+	}
+
+	second, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	second.Body.Close()
+	if second.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Second connection status = %v, want %v", second.StatusCode, http.StatusTooManyRequests)
+	}
+
+	for _, revision := range []string{"rev-2", "rev-3", "rev-4"} {
+		for _, handler := range source.handlers {
+			handler(&nats.Msg{Data: []byte(revision)})
+		}
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	want := []string{
+		"id: rev-1", "event: revision", `data: {"revision":"rev-1","keys":null}`, "",
+		"id: rev-3", "event: revision", `data: {"revision":"rev-3","keys":["path/key"]}`, "",
+		"id: rev-4", "event: revision", `data: {"revision":"rev-4","keys":["path/sub/key"]}`, "",
+	}
+	for i, wantLine := range want {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() error = %v", err)
+		}
+		if got := strings.TrimSuffix(line, "\n"); got != wantLine {
+			t.Errorf("Line %d = %q, want %q", i, got, wantLine)
+		}
+	}
+}
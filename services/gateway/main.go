@@ -2,23 +2,27 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
-	"time"
 
 	"tweek-gateway/appConfig"
 	"tweek-gateway/audit"
 	"tweek-gateway/corsSupport"
 	"tweek-gateway/externalApps"
+	"tweek-gateway/grpcServer"
 	"tweek-gateway/handlers"
 	"tweek-gateway/metrics"
 	"tweek-gateway/proxy"
+	"tweek-gateway/revisionStream"
+	"tweek-gateway/revisionWatcher"
 
 	"tweek-gateway/passThrough"
 
 	"tweek-gateway/security"
+	"tweek-gateway/snapshot"
 	"tweek-gateway/transformation"
+	"tweek-gateway/upstream"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/urfave/negroni"
@@ -28,10 +32,22 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	logrus.SetFormatter(&joonix.FluentdFormatter{})
 	configuration := appConfig.InitConfig()
 
-	app := newApp(configuration)
+	if errs := appConfig.Validate(configuration); len(errs) > 0 {
+		for _, err := range errs {
+			logrus.WithError(err).Error("Invalid configuration")
+		}
+		logrus.Fatal("Configuration validation failed")
+	}
+
+	app := newReloadableApp(configuration, newServices(configuration))
+	app.WatchConfig(configWatchInterval)
 
 	if len(configuration.Server.Ports) > 1 {
 		for _, port := range configuration.Server.Ports[1:] {
@@ -39,6 +55,10 @@ func main() {
 		}
 	}
 
+	if configuration.Server.GRPCPort > 0 {
+		go runGRPCServer(configuration.Server.GRPCPort, app)
+	}
+
 	port := configuration.Server.Ports[0]
 	runServer(port, app)
 }
@@ -54,60 +74,151 @@ func runServer(port int, handler http.Handler) {
 	logrus.WithError(err).WithField("port", port).Fatal("Server failed unexpectedly")
 }
 
-func newApp(config *appConfig.Configuration) http.Handler {
+func runGRPCServer(port int, handler http.Handler) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
+	if err != nil {
+		logrus.WithError(err).WithField("port", port).Fatal("Unable to listen for gRPC")
+	}
+
+	logrus.WithField("port", port).Info("Gateway is listening for gRPC")
+	err = grpcServer.New(handler).Serve(listener)
+	logrus.WithError(err).WithField("port", port).Fatal("gRPC server failed unexpectedly")
+}
+
+// services holds the parts of the gateway which live as long as the process, and are shared between configuration reloads
+type services struct {
+	token              security.JWTToken
+	snapshots          *snapshot.Store
+	watcher            *revisionWatcher.Watcher
+	revisions          *revisionStream.Broker
+	authorizer         security.Authorizer
+	auditor            audit.Auditor
+	userInfoExtractor  security.SubjectExtractor
+	breakGlass         *security.BreakGlassTokens
+	gatewayMetrics     *metrics.Metrics
+	passThroughMetrics *metrics.Metrics
+}
+
+func newServices(config *appConfig.Configuration) *services {
 	token := security.InitJWT(&config.Security.TweekSecretKey)
 
-	authorizer, err := withRetry(3, time.Second*5, initAuthorizer, &config.Security)
+	breakGlass, err := security.NewBreakGlassTokens(&config.Security.TweekSecretKey)
 	if err != nil {
-		panic("Unable to create Authorizer")
+		logrus.WithError(err).Panic("Unable to create break-glass tokens")
 	}
 
-	externalApps.Init(&config.Security.PolicyStorage)
+	snapshots := snapshot.New(config.Security.PolicyStorage.SnapshotDir)
+	security.UseSnapshots(snapshots)
+
+	watcher, err := revisionWatcher.New(&config.Security.PolicyStorage)
+	if err != nil {
+		logrus.WithError(err).Panic("Unable to watch for repository revisions")
+	}
+
+	authorizer, err := initAuthorizer(&config.Security, watcher, snapshots)
+	if err != nil {
+		logrus.WithError(err).Panic("Unable to create Authorizer")
+	}
+
+	externalApps.Init(&config.Security.PolicyStorage, watcher, snapshots)
 
 	auditor, err := audit.New(os.Stdout)
 	if err != nil {
 		panic("Unable to create security auditing log")
 	}
 
-	userInfoExtractor, err := setupSubjectExtractorWithRefresh(config.Security)
+	userInfoExtractor, err := setupSubjectExtractorWithRefresh(config.Security, watcher, snapshots)
 	if err != nil {
 		logrus.WithError(err).Panic("Unable to setup user info extractor")
 	}
+	userInfoExtractor, err = setupSubjectEnrichment(config.Security, userInfoExtractor, watcher, snapshots)
+	if err != nil {
+		logrus.WithError(err).Panic("Unable to setup subject enrichment")
+	}
+
+	var changedKeys revisionStream.ChangedKeys
+	if len(config.Security.PolicyStorage.MinioEndpoint) > 0 {
+		if changedKeys, err = revisionStream.NewRulesDiff(&config.Security.PolicyStorage); err != nil {
+			logrus.WithError(err).Warn("Unable to detect changed keys, revision events won't be filtered by key path")
+		}
+	}
+	revisions := revisionStream.New(watcher, changedKeys)
+
+	watcher.Start()
+
+	return &services{
+		token:              token,
+		snapshots:          snapshots,
+		watcher:            watcher,
+		revisions:          revisions,
+		authorizer:         authorizer,
+		auditor:            auditor,
+		userInfoExtractor:  userInfoExtractor,
+		breakGlass:         breakGlass,
+		gatewayMetrics:     metrics.NewMetricsVar("gateway"),
+		passThroughMetrics: metrics.NewMetricsVar("passthrough"),
+	}
+}
 
-	authenticationMiddleware := security.AuthenticationMiddleware(&config.Security, userInfoExtractor, auditor)
-	authorizationMiddleware := security.AuthorizationMiddleware(authorizer, auditor)
+func newApp(config *appConfig.Configuration, svc *services, pools upstream.Pools) http.Handler {
+	authenticationMiddleware := security.AuthenticationMiddleware(&config.Security, svc.userInfoExtractor, svc.auditor)
+	authorizationMiddleware := security.AuthorizationMiddleware(svc.authorizer, svc.auditor)
 
 	recovery := negroni.NewRecovery()
 	recovery.PrintStack = false
-	middleware := negroni.New(recovery)
-	middleware.Use(authenticationMiddleware)
-	middleware.Use(authorizationMiddleware)
+	// Break-glass grants are applied after authentication, so authorization of the request takes them into account
+	authenticated := negroni.New(recovery, authenticationMiddleware)
+	if config.Security.BreakGlass.Enabled {
+		authenticated.Use(security.BreakGlassMiddleware(svc.breakGlass, svc.auditor))
+	}
+
+	middleware := authenticated.With(authorizationMiddleware)
 
 	router := NewRouter(config)
 
-	transformation.Mount(&config.Upstreams, config.V2Routes, token, middleware, router.V2Router())
+	watchHandler := negroni.Wrap(handlers.NewWatchHandler(svc.revisions, &config.Watch))
+	router.V2Router().Path("/watch").Methods("GET").Handler(middleware.With(watchHandler))
+
+	// Batch items are authorized separately by the handler
+	apiForwarder := negroni.New(proxy.New(pools["api"], svc.token))
+	batchHandler := negroni.Wrap(handlers.NewBatchValuesHandler(svc.authorizer, svc.auditor, apiForwarder, &config.Batch))
+	router.V2Router().Path("/values/batch").Methods("POST").Handler(authenticated.With(batchHandler))
 
-	metricsVar := metrics.NewMetricsVar("passthrough")
+	// Break-glass requests are authorized by the handler, against the requested role and without the active grants
+	if config.Security.BreakGlass.Enabled {
+		handler, err := security.NewBreakGlassHandler(svc.breakGlass, svc.authorizer, svc.auditor, &config.Security.BreakGlass)
+		if err != nil {
+			logrus.WithError(err).Panic("Invalid break-glass configuration")
+		}
+		breakGlassHandler := negroni.Wrap(handler)
+		router.V2Router().Path("/break-glass").Methods("GET", "POST").Handler(authenticated.With(breakGlassHandler))
+	}
+
+	routesMiddleware := middleware.With(security.ValuesFilterMiddleware(svc.authorizer, svc.auditor))
+	if config.Security.FilterListings {
+		routesMiddleware.Use(security.ListingsFilterMiddleware(svc.authorizer, svc.auditor))
+	}
+	transformation.Mount(pools, config.V2Routes, svc.token, routesMiddleware, svc.gatewayMetrics, router.V2Router())
+
+	metricsVar := svc.passThroughMetrics
 	noAuthMiddleware := negroni.New(recovery)
 
-	passThrough.MountWithHosts(config.Upstreams.API, config.V1Hosts.API, "api", noAuthMiddleware, metricsVar, router.MainRouter())
-	passThrough.MountWithHosts(config.Upstreams.Authoring, config.V1Hosts.Authoring, "authoring", noAuthMiddleware, metricsVar, router.MainRouter())
+	passThrough.MountWithHosts(pools["api"], config.V1Hosts.API, "api", noAuthMiddleware, metricsVar, router.MainRouter())
+	passThrough.MountWithHosts(pools["authoring"], config.V1Hosts.Authoring, "authoring", noAuthMiddleware, metricsVar, router.MainRouter())
 
-	passThrough.MountWithoutHost(config.Upstreams.API, "api", noAuthMiddleware, metricsVar, router.V1Router())
-	passThrough.MountWithoutHost(config.Upstreams.API, "api", noAuthMiddleware, metricsVar, router.MainRouter().PathPrefix("/configurations/").Subrouter())
-	passThrough.MountWithoutHost(config.Upstreams.Authoring, "authoring", noAuthMiddleware, metricsVar, router.LegacyNonV1Router())
+	passThrough.MountWithoutHost(pools["api"], "api", noAuthMiddleware, metricsVar, router.V1Router())
+	passThrough.MountWithoutHost(pools["api"], "api", noAuthMiddleware, metricsVar, router.MainRouter().PathPrefix("/configurations/").Subrouter())
+	passThrough.MountWithoutHost(pools["authoring"], "authoring", noAuthMiddleware, metricsVar, router.LegacyNonV1Router())
 
 	security.MountAuth(&config.Security.Auth, &config.Security.TweekSecretKey, noAuthMiddleware, router.AuthRouter())
 
-	router.MainRouter().PathPrefix("/version").HandlerFunc(handlers.NewVersionHandler(&config.Upstreams, Version))
+	router.MainRouter().PathPrefix("/version").HandlerFunc(handlers.NewVersionHandler(pools, Version))
 	router.MainRouter().PathPrefix("/health").HandlerFunc(handlers.NewHealthHandler())
-	router.MainRouter().PathPrefix("/status").HandlerFunc(handlers.NewStatusHandler(&config.Upstreams))
-
-	handlers.SetupRevisionUpdater(config.Security.PolicyStorage.NatsEndpoint)
+	router.MainRouter().PathPrefix("/status").HandlerFunc(handlers.NewStatusHandler(pools, svc.watcher, svc.snapshots))
 
 	router.MainRouter().PathPrefix("/metrics").Handler(promhttp.Handler())
 
-	router.V2Router().PathPrefix("/current-user").HandlerFunc(security.NewUserInfoHandler(&config.Security, userInfoExtractor))
+	router.V2Router().PathPrefix("/current-user").HandlerFunc(security.NewUserInfoHandler(&config.Security, svc.userInfoExtractor))
 
 	app := negroni.New(recovery)
 
@@ -116,9 +227,8 @@ func newApp(config *appConfig.Configuration) http.Handler {
 		app.Use(corsSupportMiddleware)
 	}
 
-	if &config.Upstreams.Editor != nil {
-		editorURL, _ := url.Parse(config.Upstreams.Editor)
-		editorForwarder := proxy.New(editorURL, nil)
+	if editor, ok := pools["editor"]; ok {
+		editorForwarder := proxy.New(editor, nil)
 		router.MainRouter().Methods("GET").PathPrefix("/").Handler(negroni.New(editorForwarder))
 	}
 
@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CircuitBreakerTransitions counts circuit breaker state transitions by breaker and new state
+var CircuitBreakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "gateway",
+	Name:      "circuit_breaker_transitions_total",
+	Help:      "Total number of circuit breaker state transitions.",
+}, []string{"breaker", "state"})
+
+// CircuitBreakerState holds the current state of each circuit breaker: 0 closed, 1 half-open, 2 open
+var CircuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Subsystem: "gateway",
+	Name:      "circuit_breaker_state",
+	Help:      "Current circuit breaker state (0 closed, 1 half-open, 2 open).",
+}, []string{"breaker"})
+
+func init() {
+	prometheus.MustRegister(CircuitBreakerTransitions, CircuitBreakerState)
+}
@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConfigReloads counts configuration reloads by result (`success` or `failure`)
+var ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Subsystem: "gateway",
+	Name:      "config_reloads_total",
+	Help:      "Total number of configuration reloads.",
+}, []string{"result"})
+
+// ConfigLastReloadSuccess holds the timestamp of the last successful configuration reload
+var ConfigLastReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+	Subsystem: "gateway",
+	Name:      "config_last_reload_success_timestamp_seconds",
+	Help:      "Timestamp of the last successful configuration reload.",
+})
+
+func init() {
+	prometheus.MustRegister(ConfigReloads, ConfigLastReloadSuccess)
+}
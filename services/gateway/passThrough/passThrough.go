@@ -1,20 +1,15 @@
 package passThrough
 
 import (
-	"net/url"
-
-	"github.com/sirupsen/logrus"
-
 	"tweek-gateway/metrics"
 	"tweek-gateway/proxy"
+	"tweek-gateway/upstream"
 
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
 )
 
-func prepareMiddleware(upstream string, metricsName string, metricsVar *metrics.Metrics) []negroni.Handler {
-	parsedUpstream := parseUpstreamOrPanic(upstream)
-
+func prepareMiddleware(pool *upstream.Pool, metricsName string, metricsVar *metrics.Metrics) []negroni.Handler {
 	var handlers = []negroni.Handler{}
 
 	// metrics
@@ -24,33 +19,25 @@ func prepareMiddleware(upstream string, metricsName string, metricsVar *metrics.
 	}
 	
 	// Proxy forwarder
-	handlers = append(handlers, proxy.New(parsedUpstream, nil))
+	handlers = append(handlers, proxy.New(pool, nil))
 
 	return handlers
 }
 
 // MountWithoutHost - mounts the request passThrough handlers and middleware
-func MountWithoutHost(upstream, metricsName string, middleware *negroni.Negroni, metricsVar *metrics.Metrics, router *mux.Router) {
-	handlers := prepareMiddleware(upstream, metricsName, metricsVar)
+func MountWithoutHost(pool *upstream.Pool, metricsName string, middleware *negroni.Negroni, metricsVar *metrics.Metrics, router *mux.Router) {
+	handlers := prepareMiddleware(pool, metricsName, metricsVar)
 
 	// Mounting handler
 	router.PathPrefix("/").Handler(middleware.With(handlers...))
 }
 
 // MountWithHosts - mounts the request passThrough handlers and middleware
-func MountWithHosts(upstream string, hosts []string, metricsName string, middleware *negroni.Negroni, metricsVar *metrics.Metrics, router *mux.Router) {
-	handlers := prepareMiddleware(upstream, metricsName, metricsVar)
+func MountWithHosts(pool *upstream.Pool, hosts []string, metricsName string, middleware *negroni.Negroni, metricsVar *metrics.Metrics, router *mux.Router) {
+	handlers := prepareMiddleware(pool, metricsName, metricsVar)
 
 	// Mounting handler
 	for _, host := range hosts {
 		router.Host(host).Handler(middleware.With(handlers...))
 	}
 }
-
-func parseUpstreamOrPanic(u string) *url.URL {
-	result, err := url.Parse(u)
-	if err != nil {
-		logrus.WithError(err).WithField("upstream", u).Panic("Invalid upstream")
-	}
-	return result
-}
@@ -0,0 +1,203 @@
+package policyTest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"sort"
+
+	"tweek-gateway/security"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/loader"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/tester"
+)
+
+// Decisions of a sample request
+const (
+	Allow = "allow"
+	Deny  = "deny"
+	Error = "error"
+)
+
+// Case is a sample request, and the decision expected for it
+type Case struct {
+	Name     string        `json:"name"`
+	Method   string        `json:"method"`
+	Path     string        `json:"path"`
+	Claims   jwt.MapClaims `json:"claims"`
+	Expected string        `json:"expected"`
+}
+
+// CaseResult is the outcome of evaluating a sample request
+type CaseResult struct {
+	Case
+	Actual  string
+	Subject *security.Subject
+	Action  string
+	Object  security.PolicyResource
+	Err     error
+}
+
+// Pass returns true if the actual decision is the expected one
+func (r *CaseResult) Pass() bool {
+	return r.Actual == r.Expected
+}
+
+// Suite holds the policies under test
+type Suite struct {
+	authorizationRego string
+	policy            string
+	authorizer        security.Authorizer
+	extractor         security.SubjectExtractor
+}
+
+// NewSuite creates a suite from the authorization rules, the policy and the subject extraction rules.
+// The subject extraction rules are optional, but are required to evaluate cases with claims of external issuers
+func NewSuite(authorizationRegoPath, policyPath, subjectExtractionRulesPath string) (suite *Suite, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Invalid policy: %v", r)
+		}
+	}()
+
+	authorizationRego, err := ioutil.ReadFile(authorizationRegoPath)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ioutil.ReadFile(policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	suite = &Suite{
+		authorizationRego: string(authorizationRego),
+		policy:            string(policy),
+		authorizer:        security.NewDefaultAuthorizer(string(authorizationRego), string(policy), "authorization", "authorize"),
+	}
+
+	if len(subjectExtractionRulesPath) > 0 {
+		rules, err := ioutil.ReadFile(subjectExtractionRulesPath)
+		if err != nil {
+			return nil, err
+		}
+		suite.extractor = security.NewDefaultSubjectExtractor(string(rules), "rules", "subject")
+	}
+
+	return suite, nil
+}
+
+// RunRegoTests runs the rego unit tests found in paths against the authorization rules and the policy
+func (s *Suite) RunRegoTests(ctx context.Context, paths ...string) ([]*tester.Result, error) {
+	loaded, err := loader.AllRegos(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizationModule, err := ast.ParseModule("authorization.rego", s.authorizationRego)
+	if err != nil {
+		return nil, err
+	}
+	modules := map[string]*ast.Module{"authorization.rego": authorizationModule}
+	for name, module := range loaded.ParsedModules() {
+		modules[name] = module
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(s.policy), &data); err != nil {
+		return nil, err
+	}
+
+	ch, err := tester.NewRunner().
+		SetStore(inmem.NewFromObject(data)).
+		SetModules(modules).
+		EnableFailureLine(true).
+		RunTests(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*tester.Result{}
+	for result := range ch {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i].Location, results[j].Location
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Row < b.Row
+	})
+	return results, nil
+}
+
+// LoadCases reads sample requests from a JSON file
+func LoadCases(path string) ([]Case, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("Invalid cases file %s: %v", path, err)
+	}
+	return cases, nil
+}
+
+// Evaluate extracts the subject, the action and the object of the sample request, and authorizes it,
+// the same way the gateway does for incoming requests
+func (s *Suite) Evaluate(ctx context.Context, c Case) *CaseResult {
+	result := &CaseResult{Case: c, Actual: Error}
+
+	extractor := s.extractor
+	if extractor == nil {
+		extractor = missingExtractor{}
+	}
+
+	sub, issuer, err := security.SubjectFromClaims(ctx, c.Claims, extractor)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Subject = sub
+
+	if issuer == "tweek" {
+		result.Actual = Allow
+		return result
+	}
+
+	r := httptest.NewRequest(c.Method, c.Path, nil)
+	info := security.NewUserInfo(sub, issuer, c.Claims, r.URL)
+	r = r.WithContext(context.WithValue(ctx, security.UserInfoKey, info))
+
+	_, act, obj, err := security.ExtractFromRequest(r)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Action, result.Object = act, obj
+
+	allowed, err := s.authorizer.Authorize(ctx, sub, obj, act)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if allowed {
+		result.Actual = Allow
+	} else {
+		result.Actual = Deny
+	}
+	return result
+}
+
+type missingExtractor struct{}
+
+func (missingExtractor) ExtractSubject(ctx context.Context, claims jwt.MapClaims) (*security.Subject, error) {
+	return nil, fmt.Errorf("Subject extraction rules are required for issuer %v", claims["iss"])
+}
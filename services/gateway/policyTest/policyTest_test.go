@@ -0,0 +1,68 @@
+package policyTest
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSuite_RunRegoTests(t *testing.T) {
+	suite, err := NewSuite("../authorization.rego", "../testdata/policy.json", "")
+	if err != nil {
+		t.Fatalf("NewSuite() error = %v", err)
+	}
+
+	results, err := suite.RunRegoTests(context.Background(), "../testdata/test_authorization.rego")
+	if err != nil {
+		t.Fatalf("RunRegoTests() error = %v", err)
+	}
+	if len(results) == 0 {
+		t.Fatal("RunRegoTests() found no tests")
+	}
+	for _, result := range results {
+		if !result.Pass() {
+			t.Errorf("%s.%s failed: %v", result.Package, result.Name, result.Error)
+		}
+	}
+}
+
+func TestSuite_Evaluate(t *testing.T) {
+	suite, err := NewSuite("../authorization.rego", "./testdata/policy.json", "./testdata/subject_extraction_rules.rego")
+	if err != nil {
+		t.Fatalf("NewSuite() error = %v", err)
+	}
+	cases, err := LoadCases("./testdata/cases.json")
+	if err != nil {
+		t.Fatalf("LoadCases() error = %v", err)
+	}
+
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			result := suite.Evaluate(context.Background(), c)
+			if !result.Pass() {
+				t.Errorf("Evaluate() = %v, want %v (err = %v)", result.Actual, c.Expected, result.Err)
+			}
+		})
+	}
+}
+
+func TestSuite_EvaluateWithoutSubjectExtractionRules(t *testing.T) {
+	suite, err := NewSuite("../authorization.rego", "./testdata/policy.json", "")
+	if err != nil {
+		t.Fatalf("NewSuite() error = %v", err)
+	}
+
+	result := suite.Evaluate(context.Background(), Case{
+		Method: "GET",
+		Path:   "/api/v2/values/key1",
+		Claims: map[string]interface{}{"iss": "https://accounts.google.com", "sub": "alice@security.test"},
+	})
+	if result.Actual != Error {
+		t.Errorf("Evaluate() = %v, want %v", result.Actual, Error)
+	}
+}
+
+func TestNewSuite_InvalidPolicy(t *testing.T) {
+	if _, err := NewSuite("../authorization.rego", "./testdata/cases.json", ""); err == nil {
+		t.Error("NewSuite() should fail for an invalid policy")
+	}
+}
@@ -0,0 +1,9 @@
+package rules
+
+default subject = { "user": null, "group": null }
+
+subject = { "user": input.sub, "group": "google" } {
+    input.iss = "https://accounts.google.com"
+} else = { "user": input.sub, "group": "tweek" } {
+    input.iss = "tweek"
+}
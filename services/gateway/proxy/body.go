@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// errBodyTooLarge is returned when a streamed body exceeds its limit
+var errBodyTooLarge = errors.New("body exceeds the size limit")
+
+// limitedBody fails reading beyond the limit, instead of truncating the body
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+// limitRequest responds with 413 to streamed requests whose body exceeds max bytes
+func limitRequest(max int64, next http.Handler) http.Handler {
+	if max <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			errorHandler.ServeHTTP(rw, r, errBodyTooLarge)
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &limitedBody{ReadCloser: r.Body, remaining: max}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// limitResponse fails streamed responses whose body exceeds max bytes.
+// Responses with a known length are rejected with 413, others are aborted when reaching the limit
+func limitResponse(max int64) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		if resp.ContentLength > max {
+			resp.Body.Close()
+			return errBodyTooLarge
+		}
+		resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: max}
+		return nil
+	}
+}
@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/upstream"
+
+	"github.com/vulcand/oxy/utils"
+)
+
+const defaultRetryAttempts = 3
+
+// defaultRetryMethods are the idempotent methods which are safe to retry
+var defaultRetryMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+type attemptsKeyType string
+
+const attemptsKey attemptsKeyType = "ProxyAttempts"
+
+// policy holds the parsed timeouts and retry options of a proxy
+type policy struct {
+	connect   time.Duration
+	read      time.Duration
+	total     time.Duration
+	backoff   time.Duration
+	predicate string
+}
+
+func newPolicy(timeouts appConfig.Timeouts, retry appConfig.Retry) (*policy, error) {
+	p := &policy{}
+
+	durations := []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"connect timeout", timeouts.Connect, &p.connect},
+		{"read timeout", timeouts.Read, &p.read},
+		{"total timeout", timeouts.Total, &p.total},
+		{"retry backoff", retry.Backoff, &p.backoff},
+	}
+	for _, d := range durations {
+		if len(d.value) == 0 {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %v", d.name, err)
+		}
+		*d.target = duration
+	}
+
+	p.predicate = retryPredicate(retry)
+	return p, nil
+}
+
+// retryPredicate builds the oxy buffer predicate of the retry options, empty if retries are disabled
+func retryPredicate(retry appConfig.Retry) string {
+	attempts := retry.Attempts
+	if attempts == 0 {
+		attempts = defaultRetryAttempts
+	}
+	if attempts <= 1 {
+		return ""
+	}
+
+	methods := retry.Methods
+	if methods == nil {
+		methods = defaultRetryMethods
+	}
+	if len(methods) == 0 {
+		return ""
+	}
+	methodConditions := make([]string, len(methods))
+	for i, method := range methods {
+		methodConditions[i] = fmt.Sprintf("RequestMethod() == %q", strings.ToUpper(method))
+	}
+
+	errorConditions := []string{"IsNetworkError()"}
+	for _, code := range retry.StatusCodes {
+		errorConditions = append(errorConditions, fmt.Sprintf("ResponseCode() == %d", code))
+	}
+
+	return fmt.Sprintf("Attempts() < %d && (%s) && (%s)", attempts, strings.Join(methodConditions, " || "), strings.Join(errorConditions, " || "))
+}
+
+// withTotalTimeout limits the request with the total timeout, and counts its attempts for backing off between them
+func (p *policy) withTotalTimeout(r *http.Request) (*http.Request, context.CancelFunc) {
+	ctx := context.WithValue(r.Context(), attemptsKey, new(int32))
+	cancel := context.CancelFunc(func() {})
+	if p.total > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.total)
+	}
+	return r.WithContext(ctx), cancel
+}
+
+// waitBeforeAttempt delays retries by the backoff, doubled before each retry.
+// It returns false if the request is done while waiting
+func (p *policy) waitBeforeAttempt(r *http.Request, attempt int32) bool {
+	if attempt <= 1 || p.backoff <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(p.backoff << uint(attempt-2))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+type transportKey struct {
+	connect time.Duration
+	read    time.Duration
+	tls     *tls.Config
+}
+
+var (
+	transportsLock sync.Mutex
+	transports     = map[transportKey]http.RoundTripper{}
+)
+
+// transport returns the pool's transport with the connect and read timeouts, shared by proxies with the same timeouts
+func (p *policy) transport(pool *upstream.Pool) http.RoundTripper {
+	if p.connect == 0 && p.read == 0 {
+		return pool.Transport()
+	}
+	key := transportKey{connect: p.connect, read: p.read, tls: pool.TLSConfig()}
+
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+
+	if t, ok := transports[key]; ok {
+		return t
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if p.connect > 0 {
+		t.DialContext = (&net.Dialer{Timeout: p.connect, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t.ResponseHeaderTimeout = p.read
+	t.TLSClientConfig = key.tls
+	transports[key] = t
+	return t
+}
+
+// errorHandler responds with 413 when a streamed body is too large, with 504 when the total timeout is exceeded,
+// and like oxy's default handler otherwise
+var errorHandler = utils.ErrorHandlerFunc(func(rw http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errBodyTooLarge) {
+		rw.WriteHeader(http.StatusRequestEntityTooLarge)
+		rw.Write([]byte(http.StatusText(http.StatusRequestEntityTooLarge)))
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		rw.WriteHeader(http.StatusGatewayTimeout)
+		rw.Write([]byte(http.StatusText(http.StatusGatewayTimeout)))
+		return
+	}
+	utils.DefaultHandler.ServeHTTP(rw, r, err)
+})
+
+func mergeTimeouts(base, override appConfig.Timeouts) appConfig.Timeouts {
+	if len(override.Connect) > 0 {
+		base.Connect = override.Connect
+	}
+	if len(override.Read) > 0 {
+		base.Read = override.Read
+	}
+	if len(override.Total) > 0 {
+		base.Total = override.Total
+	}
+	return base
+}
+
+func mergeRetry(base, override appConfig.Retry) appConfig.Retry {
+	if override.Attempts > 0 {
+		base.Attempts = override.Attempts
+	}
+	if override.Methods != nil {
+		base.Methods = override.Methods
+	}
+	if override.StatusCodes != nil {
+		base.StatusCodes = override.StatusCodes
+	}
+	if len(override.Backoff) > 0 {
+		base.Backoff = override.Backoff
+	}
+	return base
+}
+
+func mergeBody(base, override appConfig.Body) appConfig.Body {
+	if override.Streaming {
+		base.Streaming = true
+	}
+	if override.MaxRequestBytes > 0 {
+		base.MaxRequestBytes = override.MaxRequestBytes
+	}
+	if override.MaxResponseBytes > 0 {
+		base.MaxResponseBytes = override.MaxResponseBytes
+	}
+	return base
+}
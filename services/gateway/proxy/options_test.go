@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/upstream"
+)
+
+func TestRetryPredicate(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry appConfig.Retry
+		want  string
+	}{
+		{
+			name:  "Defaults",
+			retry: appConfig.Retry{},
+			want:  `Attempts() < 3 && (RequestMethod() == "GET" || RequestMethod() == "HEAD" || RequestMethod() == "OPTIONS") && (IsNetworkError())`,
+		},
+		{
+			name:  "Status codes and methods",
+			retry: appConfig.Retry{Attempts: 5, Methods: []string{"get", "PUT"}, StatusCodes: []int{503}},
+			want:  `Attempts() < 5 && (RequestMethod() == "GET" || RequestMethod() == "PUT") && (IsNetworkError() || ResponseCode() == 503)`,
+		},
+		{
+			name:  "Single attempt",
+			retry: appConfig.Retry{Attempts: 1},
+			want:  "",
+		},
+		{
+			name:  "No methods",
+			retry: appConfig.Retry{Methods: []string{}},
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryPredicate(tt.retry); got != tt.want {
+				t.Errorf("retryPredicate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithOptions(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if r.URL.Path == "/large" {
+			rw.Write(bytes.Repeat([]byte("x"), 1024))
+			return
+		}
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	pool, err := upstream.NewPool("api", server.URL, appConfig.UpstreamOptions{
+		Retry: appConfig.Retry{StatusCodes: []int{http.StatusServiceUnavailable}, Backoff: "1ms"},
+	})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		options      Options
+		wantCode     int
+		wantRequests int32
+	}{
+		{
+			name:         "Retry idempotent requests",
+			method:       "GET",
+			path:         "/fail",
+			wantCode:     http.StatusServiceUnavailable,
+			wantRequests: 3,
+		},
+		{
+			name:         "Never retry writes by default",
+			method:       "POST",
+			path:         "/fail",
+			wantCode:     http.StatusServiceUnavailable,
+			wantRequests: 1,
+		},
+		{
+			name:         "Route overrides attempts",
+			method:       "GET",
+			path:         "/fail",
+			options:      Options{Retry: appConfig.Retry{Attempts: 2}},
+			wantCode:     http.StatusServiceUnavailable,
+			wantRequests: 2,
+		},
+		{
+			name:         "Total timeout",
+			method:       "GET",
+			path:         "/slow",
+			options:      Options{Timeouts: appConfig.Timeouts{Total: "50ms"}},
+			wantCode:     http.StatusGatewayTimeout,
+			wantRequests: 1,
+		},
+		{
+			name:         "Never retry streamed requests",
+			method:       "GET",
+			path:         "/fail",
+			options:      Options{Body: appConfig.Body{Streaming: true}},
+			wantCode:     http.StatusServiceUnavailable,
+			wantRequests: 1,
+		},
+		{
+			name:         "Buffered request too large",
+			method:       "POST",
+			path:         "/fail",
+			body:         "too large body",
+			options:      Options{Body: appConfig.Body{MaxRequestBytes: 4}},
+			wantCode:     http.StatusRequestEntityTooLarge,
+			wantRequests: 0,
+		},
+		{
+			name:         "Streamed request too large",
+			method:       "POST",
+			path:         "/fail",
+			body:         "too large body",
+			options:      Options{Body: appConfig.Body{Streaming: true, MaxRequestBytes: 4}},
+			wantCode:     http.StatusRequestEntityTooLarge,
+			wantRequests: 0,
+		},
+		{
+			name:         "Buffered response too large",
+			method:       "GET",
+			path:         "/large",
+			options:      Options{Body: appConfig.Body{MaxResponseBytes: 512}},
+			wantCode:     http.StatusRequestEntityTooLarge,
+			wantRequests: 1,
+		},
+		{
+			name:         "Streamed response too large",
+			method:       "GET",
+			path:         "/large",
+			options:      Options{Body: appConfig.Body{Streaming: true, MaxResponseBytes: 512}},
+			wantCode:     http.StatusRequestEntityTooLarge,
+			wantRequests: 1,
+		},
+		{
+			name:         "Streamed response within limit",
+			method:       "GET",
+			path:         "/large",
+			options:      Options{Body: appConfig.Body{Streaming: true, MaxResponseBytes: 2048}},
+			wantCode:     http.StatusOK,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			handler := WithOptions(pool, nil, tt.options)
+
+			recorder := httptest.NewRecorder()
+			handler(recorder, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)), nil)
+
+			if recorder.Code != tt.wantCode {
+				t.Errorf("Status code = %v, want %v", recorder.Code, tt.wantCode)
+			}
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequests {
+				t.Errorf("Upstream requests = %v, want %v", got, tt.wantRequests)
+			}
+		})
+	}
+}
@@ -1,36 +1,87 @@
 package proxy
 
 import (
+	"bufio"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 
+	"tweek-gateway/appConfig"
 	"tweek-gateway/security"
+	"tweek-gateway/upstream"
 
 	"github.com/urfave/negroni"
 	"github.com/vulcand/oxy/buffer"
 	"github.com/vulcand/oxy/forward"
 )
 
-// New creates a new Proxy Middleware to forward the requests
-func New(upstream *url.URL, token security.JWTToken) negroni.HandlerFunc {
-	fwd, err := forward.New()
+// Options override the non-empty options of the upstream for a proxy
+type Options struct {
+	Timeouts appConfig.Timeouts
+	Retry    appConfig.Retry
+	Body     appConfig.Body
+}
+
+// New creates a new Proxy Middleware to forward the requests to the instances of the upstream pool,
+// with the options of the upstream
+func New(pool *upstream.Pool, token security.JWTToken) negroni.HandlerFunc {
+	return WithOptions(pool, token, Options{})
+}
+
+// WithOptions creates a Proxy Middleware like New, with options overriding the ones of the upstream
+func WithOptions(pool *upstream.Pool, token security.JWTToken, overrides Options) negroni.HandlerFunc {
+	options := pool.Options()
+	body := mergeBody(options.Body, overrides.Body)
+	policy, err := newPolicy(mergeTimeouts(options.Timeouts, overrides.Timeouts), mergeRetry(options.Retry, overrides.Retry))
 	if err != nil {
-		panic(fmt.Sprintf("Failed to setup request forwarding %v", err))
+		panic(fmt.Sprintf("Invalid options for upstream %s: %v", pool.Name(), err))
+	}
+
+	var responseModifier func(*http.Response) error
+	if body.MaxResponseBytes > 0 {
+		responseModifier = limitResponse(body.MaxResponseBytes)
 	}
-	proxy, err := buffer.New(fwd, buffer.Retry(`IsNetworkError() && Attempts() <= 2`))
+	fwd, err := forward.New(
+		forward.PassHostHeader(true),
+		forward.RoundTripper(policy.transport(pool)),
+		forward.ErrorHandler(errorHandler),
+		forward.ResponseModifier(responseModifier),
+	)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to setup error handler %v", err))
+		panic(fmt.Sprintf("Failed to setup request forwarding %v", err))
+	}
+
+	var forwarder http.Handler
+	if body.Streaming {
+		// Bodies can't be replayed, so streamed requests are never retried
+		forwarder = limitRequest(body.MaxRequestBytes, balance(pool, policy, fwd))
+	} else {
+		forwarder, err = buffer.New(balance(pool, policy, fwd),
+			buffer.CondSetter(len(policy.predicate) > 0, buffer.Retry(policy.predicate)),
+			buffer.CondSetter(body.MaxRequestBytes > 0, buffer.MaxRequestBodyBytes(body.MaxRequestBytes)),
+			buffer.CondSetter(body.MaxResponseBytes > 0, buffer.MaxResponseBodyBytes(body.MaxResponseBytes)),
+		)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to setup error handler %v", err))
+		}
 	}
+	proxy := pool.Breaker().Wrap(forwarder)
 
+	upstreamURL := pool.URL()
 	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 		rw.Header().Set("X-GATEWAY", "true")
-		patchUpstream(r, upstream)
+		patchUpstream(r, upstreamURL)
 		r.Header.Del("Origin")
 		if token != nil {
 			setJwtToken(r, token.GetToken())
 		}
+
+		r, cancel := policy.withTotalTimeout(r)
 		proxy.ServeHTTP(rw, r)
+		cancel()
+
 		if next != nil {
 			next(rw, r)
 		}
@@ -38,16 +89,37 @@ func New(upstream *url.URL, token security.JWTToken) negroni.HandlerFunc {
 }
 
 // FromStringURL create a new Proxy Middleware to forward the requests
-func FromStringURL(upstream string, token security.JWTToken) negroni.HandlerFunc {
-	newURL, err := url.Parse(upstream)
+func FromStringURL(upstreamURL string, token security.JWTToken) negroni.HandlerFunc {
+	newURL, err := url.Parse(upstreamURL)
 	if err != nil {
 		panic(err)
 	}
-	return New(newURL, token)
+	return New(upstream.Static(newURL), token)
+}
+
+// balance forwards every attempt to the instance picked by the pool, and reports the result back to it
+func balance(pool *upstream.Pool, policy *policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if attempts, ok := r.Context().Value(attemptsKey).(*int32); ok {
+			if !policy.waitBeforeAttempt(r, atomic.AddInt32(attempts, 1)) {
+				errorHandler.ServeHTTP(rw, r, r.Context().Err())
+				return
+			}
+		}
+
+		target := pool.Pick()
+		r.URL.Scheme = target.URL.Scheme
+		r.URL.Host = target.URL.Host
+		r.Host = target.Host
+
+		recorder := &statusRecorder{ResponseWriter: rw, code: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		pool.Release(target, recorder.code)
+	})
 }
 
-func patchUpstream(request *http.Request, upstream *url.URL) {
-	newURL := upstream.ResolveReference(request.URL)
+func patchUpstream(request *http.Request, upstreamURL *url.URL) {
+	newURL := upstreamURL.ResolveReference(request.URL)
 	request.URL = newURL
 	request.RequestURI = newURL.RequestURI()
 }
@@ -55,3 +127,27 @@ func patchUpstream(request *http.Request, upstream *url.URL) {
 func setJwtToken(r *http.Request, tokenStr string) {
 	r.Header.Set("Authorization", fmt.Sprintf("Bearer %v", tokenStr))
 }
+
+// statusRecorder captures the status code of the response, keeping the optional interfaces of the writer
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := s.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, fmt.Errorf("%T is not a http.Hijacker", s.ResponseWriter)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/metrics"
+	"tweek-gateway/security"
+	"tweek-gateway/upstream"
+
+	"github.com/sirupsen/logrus"
+)
+
+// configWatchInterval is the interval for checking the configuration files for changes
+const configWatchInterval = 5 * time.Second
+
+// reloadableApp serves requests with the handler built from the latest valid configuration
+type reloadableApp struct {
+	handler  atomic.Value
+	lock     sync.Mutex
+	config   *appConfig.Configuration
+	services *services
+	pools    upstream.Pools
+	// load loads the configuration on reload
+	load func() (*appConfig.Configuration, error)
+}
+
+func newReloadableApp(config *appConfig.Configuration, svc *services) *reloadableApp {
+	build, err := buildApp(config, svc)
+	if err != nil {
+		logrus.WithError(err).Panic("Unable to create the gateway")
+	}
+	build.pools.Start()
+
+	app := &reloadableApp{
+		config:   config,
+		services: svc,
+		pools:    build.pools,
+		load:     appConfig.LoadConfig,
+	}
+	app.handler.Store(build.handler)
+	build.applyGlobals(config)
+	return app
+}
+
+func (a *reloadableApp) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	a.handler.Load().(http.Handler).ServeHTTP(rw, r)
+}
+
+// Reload loads the configuration again, and replaces the handler if the new configuration is valid.
+// Otherwise the previous configuration keeps being served
+func (a *reloadableApp) Reload() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	err := a.reload()
+	if err != nil {
+		metrics.ConfigReloads.WithLabelValues("failure").Inc()
+		logrus.WithError(err).Error("Configuration reload failed, keeping the previous configuration")
+		return err
+	}
+
+	metrics.ConfigReloads.WithLabelValues("success").Inc()
+	metrics.ConfigLastReloadSuccess.SetToCurrentTime()
+	logrus.Info("Configuration reloaded")
+	return nil
+}
+
+func (a *reloadableApp) reload() error {
+	config, err := a.load()
+	if err != nil {
+		return err
+	}
+
+	if errs := appConfig.Validate(config); len(errs) > 0 {
+		return errs
+	}
+
+	build, err := buildApp(config, a.services)
+	if err != nil {
+		return err
+	}
+
+	warnOnRestartRequired(a.config, config)
+
+	build.pools.Start()
+	a.handler.Store(build.handler)
+	build.applyGlobals(config)
+	a.pools.Stop()
+	a.config = config
+	a.pools = build.pools
+	return nil
+}
+
+// WatchConfig reloads the configuration on SIGHUP, and whenever one of the configuration files changes
+func (a *reloadableApp) WatchConfig(interval time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		modified := modificationTimes(a.currentConfig().Files())
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-signals:
+				logrus.Info("Received SIGHUP, reloading configuration")
+			case <-ticker.C:
+				current := modificationTimes(a.currentConfig().Files())
+				if reflect.DeepEqual(current, modified) {
+					continue
+				}
+				logrus.Info("Configuration files changed, reloading configuration")
+			}
+			a.Reload()
+			modified = modificationTimes(a.currentConfig().Files())
+		}
+	}()
+}
+
+func (a *reloadableApp) currentConfig() *appConfig.Configuration {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.config
+}
+
+// appBuild is the handler built for a configuration, along with the parts of the configuration shared by all handlers
+type appBuild struct {
+	handler        http.Handler
+	pools          upstream.Pools
+	jwksTransports *security.JWKSTransports
+}
+
+// applyGlobals applies the parts of the configuration, which are shared by all handlers.
+// It is called once the handler is served, so a failed build doesn't affect the served configuration
+func (b *appBuild) applyGlobals(config *appConfig.Configuration) {
+	security.UseTransports(b.jwksTransports)
+	security.LoadJWKS(&config.Security)
+}
+
+// buildApp creates the handler and the upstream pools for the configuration, converting panics of invalid configuration to errors.
+// The pools are not started
+func buildApp(config *appConfig.Configuration, svc *services) (build *appBuild, err error) {
+	pools, err := upstream.NewPools(&config.Upstreams)
+	if err != nil {
+		return nil, err
+	}
+
+	jwksTransports, err := security.NewJWKSTransports(&config.Security.Auth, pools.TransportFor)
+	if err != nil {
+		pools.Stop()
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			pools.Stop()
+			build, err = nil, fmt.Errorf("Invalid configuration: %v", r)
+		}
+	}()
+
+	return &appBuild{handler: newApp(config, svc, pools), pools: pools, jwksTransports: jwksTransports}, nil
+}
+
+// warnOnRestartRequired logs changes to configuration sections which are only applied on startup
+func warnOnRestartRequired(current, next *appConfig.Configuration) {
+	sections := map[string][2]interface{}{
+		"server":                  {current.Server, next.Server},
+		"security.policyStorage":  {current.Security.PolicyStorage, next.Security.PolicyStorage},
+		"security.tweekSecretKey": {current.Security.TweekSecretKey, next.Security.TweekSecretKey},
+		"security.enrichment":     {current.Security.Enrichment, next.Security.Enrichment},
+		"security.auth.providers.*.subject_extraction_rules": {
+			subjectExtractionRules(current.Security.Auth.Providers),
+			subjectExtractionRules(next.Security.Auth.Providers),
+		},
+	}
+	for section, values := range sections {
+		if !reflect.DeepEqual(values[0], values[1]) {
+			logrus.WithField("section", section).Warn("Configuration section changed, restart is required to apply it")
+		}
+	}
+}
+
+// subjectExtractionRules maps issuers to their subject extraction rules, which are loaded on startup
+func subjectExtractionRules(providers map[string]appConfig.AuthProvider) map[string]string {
+	rules := map[string]string{}
+	for _, provider := range providers {
+		if len(provider.SubjectExtractionRules) > 0 {
+			rules[provider.Issuer] = provider.SubjectExtractionRules
+		}
+	}
+	return rules
+}
+
+func modificationTimes(files []string) map[string]time.Time {
+	result := map[string]time.Time{}
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			result[file] = info.ModTime()
+		}
+	}
+	return result
+}
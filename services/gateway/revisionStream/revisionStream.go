@@ -0,0 +1,179 @@
+package revisionStream
+
+import (
+	"strings"
+	"sync"
+
+	"tweek-gateway/revisionWatcher"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+)
+
+// historySize is the number of recent events kept for clients resuming with `Last-Event-ID`
+const historySize = 100
+
+// subscriberBuffer is the number of events a slow subscriber can lag behind before its stream is closed.
+// Clients reconnect with `Last-Event-ID`, and resume from the history
+const subscriberBuffer = 16
+
+// Event is a new repository revision
+type Event struct {
+	Revision string `json:"revision"`
+	// Keys are the key paths changed since the previous revision, null when unknown
+	Keys []string `json:"keys"`
+}
+
+// Under returns the event with only the keys under the key path prefix, and false if none of them changed.
+// Events with unknown keys are returned as is
+func (e Event) Under(prefix string) (Event, bool) {
+	prefix = strings.Trim(prefix, "/")
+	if len(prefix) == 0 || e.Keys == nil {
+		return e, true
+	}
+	keys := []string{}
+	for _, key := range e.Keys {
+		if key == prefix || strings.HasPrefix(key, prefix+"/") {
+			keys = append(keys, key)
+		}
+	}
+	return Event{Revision: e.Revision, Keys: keys}, len(keys) > 0
+}
+
+// ChangedKeys returns the key paths changed in a revision, or nil if unknown
+type ChangedKeys func(revision string) ([]string, error)
+
+// Source notifies about new revisions, like the revision watcher
+type Source interface {
+	Subscribe(handler nats.MsgHandler)
+	Revision() string
+}
+
+// Broker fans out the repository revisions to the connected clients
+type Broker struct {
+	changedKeys ChangedKeys
+	// publishLock serializes publishing, so changed keys are detected in the order of the revisions
+	publishLock sync.Mutex
+
+	lock        sync.Mutex
+	history     []Event
+	subscribers map[chan Event]struct{}
+	connections map[string]int
+}
+
+// New creates a broker which publishes the revisions of the source. changedKeys is optional
+func New(source Source, changedKeys ChangedKeys) *Broker {
+	b := &Broker{
+		changedKeys: changedKeys,
+		subscribers: map[chan Event]struct{}{},
+		connections: map[string]int{},
+	}
+	if revision := source.Revision(); len(revision) > 0 {
+		b.history = []Event{{Revision: revision}}
+		// records the keys of the current revision, to detect the changes of the next one
+		b.keys(revision)
+	}
+	source.Subscribe(func(msg *nats.Msg) {
+		b.Publish(string(msg.Data))
+	})
+	return b
+}
+
+// Publish sends the revision to all the subscribers. Subscribers lagging behind are closed
+func (b *Broker) Publish(revision string) {
+	if len(revision) == 0 {
+		return
+	}
+	b.publishLock.Lock()
+	defer b.publishLock.Unlock()
+
+	event := Event{Revision: revision}
+	if !revisionWatcher.IsFingerprint(revision) {
+		event.Keys = b.keys(revision)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.history = append(b.history, event)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+			logrus.WithField("revision", revision).Warn("Revision stream subscriber is too slow, closing its stream")
+			delete(b.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+func (b *Broker) keys(revision string) []string {
+	if b.changedKeys == nil {
+		return nil
+	}
+	keys, err := b.changedKeys(revision)
+	if err != nil {
+		logrus.WithError(err).WithField("revision", revision).Warn("Unable to detect changed keys")
+		return nil
+	}
+	return keys
+}
+
+// Subscribe returns the events missed since lastEventID, and a channel of the next events.
+// Without lastEventID, or if it is too old, the backlog is the latest revision with unknown changed keys.
+// The channel is closed if the subscriber lags behind. cancel must be called when the subscriber is done
+func (b *Broker) Subscribe(lastEventID string) (backlog []Event, events <-chan Event, cancel func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	backlog = b.backlog(lastEventID)
+	ch := make(chan Event, subscriberBuffer)
+	b.subscribers[ch] = struct{}{}
+
+	return backlog, ch, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		delete(b.subscribers, ch)
+	}
+}
+
+func (b *Broker) backlog(lastEventID string) []Event {
+	if len(b.history) == 0 {
+		return nil
+	}
+	if len(lastEventID) > 0 {
+		for i, event := range b.history {
+			if event.Revision == lastEventID {
+				return append([]Event{}, b.history[i+1:]...)
+			}
+		}
+	}
+	return []Event{{Revision: b.history[len(b.history)-1].Revision}}
+}
+
+// Acquire counts a connection of the subject, and returns false if the subject already has max connections.
+// max of 0 is unlimited
+func (b *Broker) Acquire(subject string, max int) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if max > 0 && b.connections[subject] >= max {
+		return false
+	}
+	b.connections[subject]++
+	return true
+}
+
+// Release stops counting a connection acquired by the subject
+func (b *Broker) Release(subject string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.connections[subject]--
+	if b.connections[subject] <= 0 {
+		delete(b.connections, subject)
+	}
+}
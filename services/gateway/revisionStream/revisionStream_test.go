@@ -0,0 +1,170 @@
+package revisionStream
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"testing"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+type testSource struct {
+	revision string
+	handlers []nats.MsgHandler
+}
+
+func (s *testSource) Subscribe(handler nats.MsgHandler) { s.handlers = append(s.handlers, handler) }
+func (s *testSource) Revision() string                  { return s.revision }
+
+func (s *testSource) publish(revision string) {
+	for _, handler := range s.handlers {
+		handler(&nats.Msg{Subject: "version", Data: []byte(revision)})
+	}
+}
+
+func TestBroker_Subscribe(t *testing.T) {
+	changed := map[string][]string{"rev-2": {"a/key"}, "rev-3": {"b/key"}}
+	source := &testSource{revision: "rev-1"}
+	broker := New(source, func(revision string) ([]string, error) { return changed[revision], nil })
+	source.publish("rev-2")
+	source.publish("rev-3")
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []Event
+	}{
+		{
+			name: "New subscriber",
+			want: []Event{{Revision: "rev-3"}},
+		},
+		{
+			name:        "Resume",
+			lastEventID: "rev-1",
+			want:        []Event{{Revision: "rev-2", Keys: []string{"a/key"}}, {Revision: "rev-3", Keys: []string{"b/key"}}},
+		},
+		{
+			name:        "Up to date",
+			lastEventID: "rev-3",
+			want:        []Event{},
+		},
+		{
+			name:        "Unknown revision",
+			lastEventID: "rev-0",
+			want:        []Event{{Revision: "rev-3"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backlog, _, cancel := broker.Subscribe(tt.lastEventID)
+			defer cancel()
+			if !reflect.DeepEqual(backlog, tt.want) {
+				t.Errorf("Subscribe() backlog = %v, want %v", backlog, tt.want)
+			}
+		})
+	}
+
+	_, events, cancel := broker.Subscribe("")
+	defer cancel()
+	source.publish("rev-4")
+	if event := <-events; event.Revision != "rev-4" || event.Keys != nil {
+		t.Errorf("Subscribe() event = %v, want rev-4 with unknown keys", event)
+	}
+}
+
+func TestBroker_PublishDetectsKeysInOrder(t *testing.T) {
+	var detected []string
+	source := &testSource{revision: "rev-1"}
+	New(source, func(revision string) ([]string, error) {
+		detected = append(detected, revision)
+		return nil, nil
+	})
+	source.publish("rev-2")
+	source.publish("etags-0123456789abcdef")
+
+	if want := []string{"rev-1", "rev-2"}; !reflect.DeepEqual(detected, want) {
+		t.Errorf("Detected keys of %v, want %v without changes detected by ETags", detected, want)
+	}
+}
+
+func TestBroker_PublishClosesLaggingSubscribers(t *testing.T) {
+	source := &testSource{revision: "rev-0"}
+	broker := New(source, nil)
+	_, lagging, cancelLagging := broker.Subscribe("")
+	defer cancelLagging()
+	_, events, cancel := broker.Subscribe("")
+	defer cancel()
+
+	var received int
+	for i := 1; i <= subscriberBuffer+1; i++ {
+		source.publish(fmt.Sprintf("rev-%d", i))
+		<-events
+		received++
+	}
+
+	for range lagging {
+		received--
+	}
+	if received != 1 {
+		t.Errorf("Lagging subscriber missed %v events before being closed, want 1", received)
+	}
+
+	backlog, _, cancelResumed := broker.Subscribe(fmt.Sprintf("rev-%d", subscriberBuffer))
+	defer cancelResumed()
+	if len(backlog) != 1 || backlog[0].Revision != fmt.Sprintf("rev-%d", subscriberBuffer+1) {
+		t.Errorf("Resumed backlog = %v, want the missed revision", backlog)
+	}
+}
+
+func TestEvent_Under(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     Event
+		prefix    string
+		want      Event
+		wantMatch bool
+	}{
+		{name: "No prefix", event: Event{Keys: []string{"a"}}, want: Event{Keys: []string{"a"}}, wantMatch: true},
+		{name: "Unknown keys", event: Event{}, prefix: "a", want: Event{}, wantMatch: true},
+		{name: "Key under prefix", event: Event{Keys: []string{"b/c", "a/b/c"}}, prefix: "/a/b/", want: Event{Keys: []string{"a/b/c"}}, wantMatch: true},
+		{name: "Exact key", event: Event{Keys: []string{"a/b"}}, prefix: "a/b", want: Event{Keys: []string{"a/b"}}, wantMatch: true},
+		{name: "Key with common name prefix", event: Event{Keys: []string{"a/bc"}}, prefix: "a/b", want: Event{Keys: []string{}}, wantMatch: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, match := tt.event.Under(tt.prefix)
+			if match != tt.wantMatch || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Under() = %v, %v, want %v, %v", got, match, tt.want, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestBroker_Acquire(t *testing.T) {
+	broker := New(&testSource{}, nil)
+	if !broker.Acquire("default:alice", 1) {
+		t.Fatal("Acquire() = false, want true")
+	}
+	if broker.Acquire("default:alice", 1) {
+		t.Error("Acquire() over the limit = true, want false")
+	}
+	if !broker.Acquire("default:bob", 1) {
+		t.Error("Acquire() of another subject = false, want true")
+	}
+	broker.Release("default:alice")
+	if !broker.Acquire("default:alice", 1) {
+		t.Error("Acquire() after release = false, want true")
+	}
+}
+
+func Test_diff(t *testing.T) {
+	hash := func(s string) [sha256.Size]byte { return sha256.Sum256([]byte(s)) }
+	previous := map[string][sha256.Size]byte{"same": hash("1"), "modified": hash("1"), "removed": hash("1")}
+	current := map[string][sha256.Size]byte{"same": hash("1"), "modified": hash("2"), "added": hash("1")}
+
+	want := []string{"added", "modified", "removed"}
+	if got := diff(previous, current); !reflect.DeepEqual(got, want) {
+		t.Errorf("diff() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package revisionStream
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"tweek-gateway/appConfig"
+
+	minio "github.com/minio/minio-go"
+)
+
+// rulesDiff detects the changed keys by comparing the rules of consecutive revisions in the policy storage.
+// The storage holds the rules of each revision as an object named after it, mapping key paths to their definitions
+type rulesDiff struct {
+	client *minio.Client
+	bucket string
+
+	lock   sync.Mutex
+	hashes map[string][sha256.Size]byte
+}
+
+// NewRulesDiff creates a ChangedKeys function reading the rules of the revisions from the policy storage
+func NewRulesDiff(cfg *appConfig.PolicyStorage) (ChangedKeys, error) {
+	client, err := minio.New(cfg.MinioEndpoint, cfg.MinioAccessKey, cfg.MinioSecretKey, cfg.MinioUseSSL)
+	if err != nil {
+		return nil, err
+	}
+	d := &rulesDiff{client: client, bucket: cfg.MinioBucketName}
+	return d.changedKeys, nil
+}
+
+func (d *rulesDiff) changedKeys(revision string) ([]string, error) {
+	hashes, err := d.read(revision)
+	if err != nil {
+		return nil, err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	previous := d.hashes
+	d.hashes = hashes
+	if previous == nil {
+		return nil, nil
+	}
+	return diff(previous, hashes), nil
+}
+
+func (d *rulesDiff) read(revision string) (map[string][sha256.Size]byte, error) {
+	reader, err := d.client.GetObject(d.bucket, revision, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var rules map[string]json.RawMessage
+	if err := json.NewDecoder(reader).Decode(&rules); err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string][sha256.Size]byte, len(rules))
+	for key, definition := range rules {
+		hashes[key] = sha256.Sum256(definition)
+	}
+	return hashes, nil
+}
+
+// diff returns the sorted keys which were added, removed or modified
+func diff(previous, current map[string][sha256.Size]byte) []string {
+	keys := []string{}
+	for key, hash := range current {
+		if previousHash, ok := previous[key]; !ok || previousHash != hash {
+			keys = append(keys, key)
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
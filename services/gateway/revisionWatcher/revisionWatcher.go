@@ -0,0 +1,400 @@
+package revisionWatcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"tweek-gateway/appConfig"
+
+	minio "github.com/minio/minio-go"
+	nats "github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SourceNats means that revision updates are received from NATS only
+	SourceNats = "nats"
+	// SourcePolling means that revision updates are detected by polling the policy storage only
+	SourcePolling = "polling"
+	// SourceNatsAndPolling means that NATS is used, and polling is a fallback for missed updates
+	SourceNatsAndPolling = "nats+polling"
+	// SourceNone means that no revision updates will be received
+	SourceNone = "none"
+)
+
+// natsReconnectInterval is used to retry the initial NATS connection when polling is disabled
+const natsReconnectInterval = 10 * time.Second
+
+// watchedObjects are used to detect changes when the `versions` object is not available
+var watchedObjects = []string{"security/policy.json", "security/subject_extraction_rules.rego", "external_apps.json"}
+
+// fingerprintPrefix marks the revisions dispatched for changes detected by ETags, when the actual revision is unknown
+const fingerprintPrefix = "etags-"
+
+// IsFingerprint returns true if the revision identifies a change detected by ETags, rather than a repository revision
+func IsFingerprint(revision string) bool {
+	return strings.HasPrefix(revision, fingerprintPrefix)
+}
+
+// fingerprintRevision identifies a change detected by ETags, as the ETags are too long to be used as an event ID
+func fingerprintRevision(fingerprint string) string {
+	hash := sha256.Sum256([]byte(fingerprint))
+	return fingerprintPrefix + hex.EncodeToString(hash[:8])
+}
+
+type versionsBlob struct {
+	Latest   string `json:"latest"`
+	Previous string `json:"previous"`
+}
+
+// Status describes the current source of truth for revision updates
+type Status struct {
+	Source           string    `json:"source"`
+	NatsConnected    bool      `json:"natsConnected"`
+	PollInterval     string    `json:"pollInterval,omitempty"`
+	Revision         string    `json:"revision"`
+	LastUpdate       time.Time `json:"lastUpdate"`
+	LastUpdateSource string    `json:"lastUpdateSource,omitempty"`
+	LastPoll         time.Time `json:"lastPoll"`
+	LastPollError    string    `json:"lastPollError,omitempty"`
+}
+
+// Watcher notifies subscribers when a new repository revision is published, either by NATS or by polling the policy storage
+type Watcher struct {
+	cfg          *appConfig.PolicyStorage
+	pollInterval time.Duration
+	minioClient  *minio.Client
+	objects      []string
+	// readStorage reads the revision and its fingerprint from the policy storage, it is nil when polling is disabled
+	readStorage func() (revision, fingerprint string, err error)
+	// natsRevisions passes the latest revision received from NATS to the polling goroutine, which fingerprints it
+	natsRevisions chan string
+
+	lock             sync.RWMutex
+	handlers         []nats.MsgHandler
+	natsConn         *nats.Conn
+	subscription     *nats.Subscription
+	revision         string
+	fingerprint      string
+	lastUpdate       time.Time
+	lastUpdateSource string
+	lastPoll         time.Time
+	lastPollError    error
+}
+
+// New creates a Watcher. It fails if neither NATS nor polling can be used to receive updates
+func New(cfg *appConfig.PolicyStorage) (*Watcher, error) {
+	w := &Watcher{cfg: cfg, objects: append([]string{}, watchedObjects...)}
+
+	if len(cfg.PollInterval) > 0 {
+		interval, err := time.ParseDuration(cfg.PollInterval)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid policy storage poll interval %q: %v", cfg.PollInterval, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("Policy storage poll interval must be positive, got %q", cfg.PollInterval)
+		}
+		w.pollInterval = interval
+
+		client, err := minio.New(cfg.MinioEndpoint, cfg.MinioAccessKey, cfg.MinioSecretKey, cfg.MinioUseSSL)
+		if err != nil {
+			return nil, err
+		}
+		w.minioClient = client
+		w.readStorage = w.readRevision
+		w.natsRevisions = make(chan string, 1)
+	}
+
+	if err := w.connectNats(); err != nil {
+		if w.pollInterval == 0 && len(cfg.SnapshotDir) == 0 {
+			return nil, err
+		}
+		logrus.WithError(err).WithField("natsEndpoint", cfg.NatsEndpoint).Warn("Failed to connect to nats, will keep retrying")
+	}
+
+	return w, nil
+}
+
+// Subscribe registers a handler, which is called for every new revision
+func (w *Watcher) Subscribe(handler nats.MsgHandler) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.handlers = append(w.handlers, handler)
+}
+
+// Watch adds objects, whose changes are detected when the `versions` object is not available.
+// It should be called before Start
+func (w *Watcher) Watch(objects ...string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.objects = append(w.objects, objects...)
+}
+
+// Start starts polling the policy storage if enabled, and reconnecting to NATS if the initial connection failed
+func (w *Watcher) Start() {
+	if w.pollInterval == 0 {
+		if !w.natsEndpointConfigured() || w.natsConnected() {
+			return
+		}
+		go func() {
+			for range time.Tick(natsReconnectInterval) {
+				if w.reconnectNats() {
+					return
+				}
+			}
+		}()
+		return
+	}
+
+	// the first poll only records the current revision, subscribers are already initialized with it
+	w.poll(false)
+	go func() {
+		tick := time.Tick(w.pollInterval)
+		for {
+			select {
+			case revision := <-w.natsRevisions:
+				w.update(revision, w.natsFingerprint(revision), SourceNats)
+			case <-tick:
+				if w.natsEndpointConfigured() {
+					w.reconnectNats()
+				}
+				w.poll(true)
+			}
+		}
+	}()
+}
+
+// Revision returns the latest known repository revision
+func (w *Watcher) Revision() string {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.revision
+}
+
+// Status returns the current state of the watcher
+func (w *Watcher) Status() Status {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	natsConnected := w.natsConn != nil && w.natsConn.IsConnected()
+	status := Status{
+		NatsConnected:    natsConnected,
+		Revision:         w.revision,
+		LastUpdate:       w.lastUpdate,
+		LastUpdateSource: w.lastUpdateSource,
+		LastPoll:         w.lastPoll,
+	}
+
+	switch {
+	case natsConnected && w.pollInterval > 0:
+		status.Source = SourceNatsAndPolling
+	case natsConnected:
+		status.Source = SourceNats
+	case w.pollInterval > 0:
+		status.Source = SourcePolling
+	default:
+		status.Source = SourceNone
+	}
+
+	if w.pollInterval > 0 {
+		status.PollInterval = w.pollInterval.String()
+	}
+	if w.lastPollError != nil {
+		status.LastPollError = w.lastPollError.Error()
+	}
+
+	return status
+}
+
+func (w *Watcher) natsEndpointConfigured() bool {
+	return len(w.cfg.NatsEndpoint) > 0
+}
+
+func (w *Watcher) natsConnected() bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.natsConn != nil && w.natsConn.IsConnected()
+}
+
+// reconnectNats connects to NATS if not connected yet, and returns true if connected.
+// Once connected, reconnections are handled by the NATS client
+func (w *Watcher) reconnectNats() bool {
+	w.lock.RLock()
+	connected := w.natsConn != nil
+	w.lock.RUnlock()
+	if connected {
+		return true
+	}
+
+	if err := w.connectNats(); err != nil {
+		logrus.WithError(err).Debug("Still unable to connect to nats")
+		return false
+	}
+	return true
+}
+
+func (w *Watcher) connectNats() error {
+	if !w.natsEndpointConfigured() {
+		return fmt.Errorf("Nats endpoint is not configured")
+	}
+
+	nc, err := nats.Connect(w.cfg.NatsEndpoint, nats.MaxReconnects(-1))
+	if err != nil {
+		return err
+	}
+
+	subscription, err := nc.Subscribe("version", func(msg *nats.Msg) {
+		w.receiveNats(string(msg.Data))
+	})
+	if err != nil {
+		nc.Close()
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.natsConn != nil {
+		w.natsConn.Close()
+	}
+	w.natsConn = nc
+	w.subscription = subscription
+	logrus.WithField("natsEndpoint", w.cfg.NatsEndpoint).Info("Subscribed to repository revision updates")
+	return nil
+}
+
+// receiveNats updates the revision received from NATS. When polling is enabled, the polling goroutine fingerprints it,
+// so the NATS handler doesn't wait for the policy storage. Only the latest pending revision is kept
+func (w *Watcher) receiveNats(revision string) {
+	if w.readStorage == nil {
+		w.update(revision, revision, SourceNats)
+		return
+	}
+	for {
+		select {
+		case w.natsRevisions <- revision:
+			return
+		default:
+		}
+		select {
+		case <-w.natsRevisions:
+		default:
+		}
+	}
+}
+
+func (w *Watcher) poll(notify bool) {
+	revision, fingerprint, err := w.readStorage()
+
+	w.lock.Lock()
+	w.lastPoll = time.Now()
+	w.lastPollError = err
+	w.lock.Unlock()
+
+	if err != nil {
+		logrus.WithError(err).Warn("Failed polling policy storage for revision")
+		return
+	}
+
+	if notify {
+		w.update(revision, fingerprint, SourcePolling)
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if len(w.fingerprint) == 0 {
+		w.revision = revision
+		w.fingerprint = fingerprint
+	}
+}
+
+// readRevision reads the latest revision from the `versions` object, falling back to ETags of the watched objects
+func (w *Watcher) readRevision() (revision, fingerprint string, err error) {
+	reader, err := w.minioClient.GetObject(w.cfg.MinioBucketName, "versions", minio.GetObjectOptions{})
+	if err == nil {
+		defer reader.Close()
+		var data []byte
+		data, err = ioutil.ReadAll(reader)
+		if err == nil {
+			var versions versionsBlob
+			err = json.Unmarshal(data, &versions)
+			if err == nil && len(versions.Latest) > 0 {
+				return versions.Latest, versions.Latest, nil
+			}
+		}
+	}
+
+	w.lock.RLock()
+	objects := w.objects
+	w.lock.RUnlock()
+
+	etags := make([]string, 0, len(objects))
+	for _, object := range objects {
+		info, statErr := w.minioClient.StatObject(w.cfg.MinioBucketName, object, minio.StatObjectOptions{})
+		if statErr != nil {
+			return "", "", fmt.Errorf("Unable to read versions (%v) or stat %s (%v)", err, object, statErr)
+		}
+		etags = append(etags, info.ETag)
+	}
+	return "", strings.Join(etags, ","), nil
+}
+
+// natsFingerprint fingerprints a revision received from NATS the same way polling does.
+// Without the `versions` object polling fingerprints by ETags, so they are used for NATS updates as well,
+// otherwise every alternation between the sources would refresh the same revision again
+func (w *Watcher) natsFingerprint(revision string) string {
+	if w.readStorage == nil {
+		return revision
+	}
+	stored, fingerprint, err := w.readStorage()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed reading policy storage to fingerprint revision")
+		return revision
+	}
+	if len(stored) > 0 {
+		return revision
+	}
+	return fingerprint
+}
+
+func (w *Watcher) update(revision, fingerprint, source string) {
+	w.lock.Lock()
+	if fingerprint == w.fingerprint {
+		w.lock.Unlock()
+		return
+	}
+	w.fingerprint = fingerprint
+	if len(revision) > 0 {
+		w.revision = revision
+	}
+	w.lastUpdate = time.Now()
+	w.lastUpdateSource = source
+	handlers := make([]nats.MsgHandler, len(w.handlers))
+	copy(handlers, w.handlers)
+	w.lock.Unlock()
+
+	logrus.WithFields(logrus.Fields{"revision": revision, "source": source}).Info("New repository revision")
+
+	if len(revision) == 0 {
+		revision = fingerprintRevision(fingerprint)
+	}
+	msg := &nats.Msg{Subject: "version", Data: []byte(revision)}
+	for _, handler := range handlers {
+		dispatch(handler, msg)
+	}
+}
+
+func dispatch(handler nats.MsgHandler, msg *nats.Msg) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithField(logrus.ErrorKey, r).Error("Revision update handler failed")
+		}
+	}()
+	handler(msg)
+}
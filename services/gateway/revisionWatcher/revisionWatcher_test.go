@@ -0,0 +1,140 @@
+package revisionWatcher
+
+import (
+	"testing"
+	"time"
+
+	"tweek-gateway/appConfig"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func TestWatcher_update(t *testing.T) {
+	w := &Watcher{cfg: &appConfig.PolicyStorage{}, pollInterval: time.Minute}
+
+	var received []string
+	w.Subscribe(func(msg *nats.Msg) {
+		received = append(received, string(msg.Data))
+	})
+
+	w.update("rev1", "rev1", SourceNats)
+	w.update("rev1", "rev1", SourcePolling)
+	w.update("rev2", "rev2", SourcePolling)
+
+	if len(received) != 2 || received[0] != "rev1" || received[1] != "rev2" {
+		t.Errorf("update() dispatched %v, want [rev1 rev2]", received)
+	}
+
+	status := w.Status()
+	if status.Revision != "rev2" {
+		t.Errorf("Status().Revision = %v, want rev2", status.Revision)
+	}
+	if status.LastUpdateSource != SourcePolling {
+		t.Errorf("Status().LastUpdateSource = %v, want %v", status.LastUpdateSource, SourcePolling)
+	}
+	if status.Source != SourcePolling {
+		t.Errorf("Status().Source = %v, want %v", status.Source, SourcePolling)
+	}
+}
+
+func TestWatcher_updateRecoversFromPanickingHandler(t *testing.T) {
+	w := &Watcher{cfg: &appConfig.PolicyStorage{}}
+
+	called := false
+	w.Subscribe(func(msg *nats.Msg) {
+		panic("failed refreshing")
+	})
+	w.Subscribe(func(msg *nats.Msg) {
+		called = true
+	})
+
+	w.update("rev1", "rev1", SourceNats)
+
+	if !called {
+		t.Error("update() should call all handlers, even if one of them panics")
+	}
+	if status := w.Status(); status.Source != SourceNone {
+		t.Errorf("Status().Source = %v, want %v", status.Source, SourceNone)
+	}
+}
+
+func TestWatcher_updateFromAlternatingSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage func() (string, string, error)
+	}{
+		{
+			name:    "Versions object",
+			storage: func() (string, string, error) { return "rev1", "rev1", nil },
+		},
+		{
+			name:    "ETags",
+			storage: func() (string, string, error) { return "", "etag1,etag2", nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watcher{cfg: &appConfig.PolicyStorage{}, pollInterval: time.Minute, readStorage: tt.storage}
+
+			dispatched := 0
+			w.Subscribe(func(msg *nats.Msg) {
+				dispatched++
+			})
+
+			w.update("rev1", w.natsFingerprint("rev1"), SourceNats)
+			w.poll(true)
+			w.update("rev1", w.natsFingerprint("rev1"), SourceNats)
+			w.poll(true)
+
+			if dispatched != 1 {
+				t.Errorf("Dispatched %v times, want 1 for the same revision", dispatched)
+			}
+			if revision := w.Revision(); revision != "rev1" {
+				t.Errorf("Revision() = %v, want rev1", revision)
+			}
+		})
+	}
+}
+
+func TestWatcher_receiveNatsWithPolling(t *testing.T) {
+	reads := 0
+	storage := func() (string, string, error) {
+		reads++
+		return "rev2", "rev2", nil
+	}
+	w := &Watcher{cfg: &appConfig.PolicyStorage{}, pollInterval: time.Minute, readStorage: storage, natsRevisions: make(chan string, 1)}
+
+	dispatched := 0
+	w.Subscribe(func(msg *nats.Msg) {
+		dispatched++
+	})
+
+	w.receiveNats("rev1")
+	w.receiveNats("rev2")
+
+	if reads != 0 || dispatched != 0 {
+		t.Errorf("receiveNats() read the storage %v times and dispatched %v times, want it left to the polling goroutine", reads, dispatched)
+	}
+	if pending := <-w.natsRevisions; pending != "rev2" {
+		t.Errorf("Pending revision = %v, want the latest rev2", pending)
+	}
+}
+
+func TestWatcher_updateWithoutRevision(t *testing.T) {
+	w := &Watcher{cfg: &appConfig.PolicyStorage{}, pollInterval: time.Minute}
+
+	var received []string
+	w.Subscribe(func(msg *nats.Msg) {
+		received = append(received, string(msg.Data))
+	})
+
+	w.update("", "etag1,etag2", SourcePolling)
+	w.update("", "etag1,etag3", SourcePolling)
+
+	if len(received) != 2 || !IsFingerprint(received[0]) || !IsFingerprint(received[1]) || received[0] == received[1] {
+		t.Errorf("update() dispatched %v, want a distinct fingerprint revision per change", received)
+	}
+	if revision := w.Revision(); len(revision) != 0 {
+		t.Errorf("Revision() = %v, want unknown", revision)
+	}
+}
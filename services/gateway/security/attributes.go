@@ -0,0 +1,89 @@
+package security
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"tweek-gateway/appConfig"
+)
+
+type requestAttributesKeyType string
+
+// RequestAttributesKey is used to store and fetch the request attributes from the context
+const RequestAttributesKey requestAttributesKeyType = "RequestAttributes"
+
+// RequestAttributes are the attributes of a request, which are passed to the authorization policies
+type RequestAttributes struct {
+	SourceIP string
+	// Headers hold the first value of the allow-listed headers, by their lower cased names
+	Headers map[string]string
+}
+
+// RequestAttributesExtractor extracts the attributes of a request
+type RequestAttributesExtractor func(r *http.Request) *RequestAttributes
+
+// NewRequestAttributesExtractor creates an extractor of the request attributes, passing only the configured headers.
+// The trusted proxies are parsed once, as they are validated with the configuration
+func NewRequestAttributesExtractor(configuration *appConfig.Attributes) RequestAttributesExtractor {
+	trusted, _ := configuration.TrustedNetworks()
+	forwardedFor := configuration.ForwardedFor
+	headers := make([]string, 0, len(configuration.Headers))
+	for _, header := range configuration.Headers {
+		headers = append(headers, strings.TrimSpace(header))
+	}
+
+	return func(r *http.Request) *RequestAttributes {
+		attributes := &RequestAttributes{SourceIP: sourceIP(r, forwardedFor, trusted), Headers: map[string]string{}}
+		for _, name := range headers {
+			if value := r.Header.Get(name); len(value) > 0 {
+				attributes.Headers[strings.ToLower(name)] = value
+			}
+		}
+		return attributes
+	}
+}
+
+// WithRequestAttributes returns a copy of the context, which holds the request attributes
+func WithRequestAttributes(ctx context.Context, attributes *RequestAttributes) context.Context {
+	return context.WithValue(ctx, RequestAttributesKey, attributes)
+}
+
+// sourceIP returns the remote address of the request. With forwardedFor, X-Forwarded-For is read from the right,
+// skipping the trusted proxies, since the entries to their left may be set by the client
+func sourceIP(r *http.Request, forwardedFor bool, trusted []*net.IPNet) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if !forwardedFor || len(forwarded) == 0 {
+		return remote
+	}
+
+	if len(trusted) > 0 && !isTrustedProxy(remote, trusted) {
+		return remote
+	}
+	addresses := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(addresses[i])
+		if i == 0 || !isTrustedProxy(address, trusted) {
+			return address
+		}
+	}
+	return remote
+}
+
+func isTrustedProxy(address string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
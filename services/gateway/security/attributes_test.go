@@ -0,0 +1,121 @@
+package security
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"tweek-gateway/appConfig"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestNewRequestAttributesExtractor(t *testing.T) {
+	tests := []struct {
+		name          string
+		configuration appConfig.Attributes
+		headers       map[string]string
+		want          *RequestAttributes
+	}{
+		{
+			name:    "Remote address",
+			headers: map[string]string{"X-Forwarded-For": "10.0.0.1", "X-Tenant": "acme"},
+			want:    &RequestAttributes{SourceIP: "192.0.2.1", Headers: map[string]string{}},
+		},
+		{
+			name:          "Forwarded for by the direct peer",
+			configuration: appConfig.Attributes{ForwardedFor: true},
+			headers:       map[string]string{"X-Forwarded-For": "10.0.0.1, 172.16.0.1"},
+			want:          &RequestAttributes{SourceIP: "172.16.0.1", Headers: map[string]string{}},
+		},
+		{
+			name:          "Forwarded for skipping trusted proxies",
+			configuration: appConfig.Attributes{ForwardedFor: true, TrustedProxies: []string{"192.0.2.1", "172.16.0.0/12"}},
+			headers:       map[string]string{"X-Forwarded-For": "10.0.0.2, 10.0.0.1, 172.16.0.1"},
+			want:          &RequestAttributes{SourceIP: "10.0.0.1", Headers: map[string]string{}},
+		},
+		{
+			name:          "Forwarded for through trusted proxies only",
+			configuration: appConfig.Attributes{ForwardedFor: true, TrustedProxies: []string{"192.0.2.0/24", "172.16.0.0/12"}},
+			headers:       map[string]string{"X-Forwarded-For": "172.16.0.2, 172.16.0.1"},
+			want:          &RequestAttributes{SourceIP: "172.16.0.2", Headers: map[string]string{}},
+		},
+		{
+			name:          "Forwarded for by an untrusted peer",
+			configuration: appConfig.Attributes{ForwardedFor: true, TrustedProxies: []string{"172.16.0.0/12"}},
+			headers:       map[string]string{"X-Forwarded-For": "10.0.0.1"},
+			want:          &RequestAttributes{SourceIP: "192.0.2.1", Headers: map[string]string{}},
+		},
+		{
+			name:          "Allowed headers",
+			configuration: appConfig.Attributes{Headers: []string{"X-Tenant", "user-agent", "X-Missing"}},
+			headers:       map[string]string{"X-Tenant": "acme", "User-Agent": "test", "X-Other": "other"},
+			want:          &RequestAttributes{SourceIP: "192.0.2.1", Headers: map[string]string{"x-tenant": "acme", "user-agent": "test"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v2/values/some/key", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := NewRequestAttributesExtractor(&tt.configuration)(r); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewRequestAttributesExtractor()() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultAuthorizer_attributes(t *testing.T) {
+	rules := `package authorization
+default authorize = false
+authorize = true {
+	input.issuer = "https://issuer"
+	input.claims.department = "engineering"
+	net.cidr_contains("10.0.0.0/8", input.source_ip)
+	input.headers["x-tenant"] = "acme"
+	input.time > 0
+}`
+	authorizer := NewDefaultAuthorizer(rules, `{}`, "authorization", "authorize")
+
+	sub := &Subject{User: "alice", Group: "default"}
+	info := NewUserInfo(sub, "https://issuer", jwt.MapClaims{"department": "engineering"}, httptest.NewRequest("GET", "/", nil).URL)
+	ctx := context.WithValue(context.Background(), UserInfoKey, info)
+
+	tests := []struct {
+		name       string
+		attributes *RequestAttributes
+		want       bool
+	}{
+		{
+			name:       "Matching attributes",
+			attributes: &RequestAttributes{SourceIP: "10.1.2.3", Headers: map[string]string{"x-tenant": "acme"}},
+			want:       true,
+		},
+		{
+			name:       "Other network",
+			attributes: &RequestAttributes{SourceIP: "172.16.0.1", Headers: map[string]string{"x-tenant": "acme"}},
+			want:       false,
+		},
+		{
+			name: "No attributes",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := ctx
+			if tt.attributes != nil {
+				ctx = WithRequestAttributes(ctx, tt.attributes)
+			}
+			got, err := authorizer.Authorize(ctx, sub, PolicyResource{Item: "repo", Contexts: map[string][]string{}}, "read")
+			if err != nil {
+				t.Fatalf("Authorize() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Authorize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -20,15 +20,29 @@ import (
 
 type userInfoKeyType string
 
+// Subject is the user of a request, and the groups it belongs to.
+// Group is the primary group, which identifies the subject in the `group:user` form
 type Subject struct {
 	User  string
 	Group string
+	// Groups are all the groups and roles of the subject, starting with the primary group
+	Groups []string
+	// Attributes of the subject, which are looked up in the directory
+	Attributes map[string]interface{}
 }
 
 func (sub *Subject) String() string {
 	return fmt.Sprintf("%s:%s", sub.Group, sub.User)
 }
 
+// AllGroups returns all the groups of the subject, or only the primary group of subjects without groups
+func (sub *Subject) AllGroups() []string {
+	if len(sub.Groups) == 0 {
+		return []string{sub.Group}
+	}
+	return sub.Groups
+}
+
 // UserInfoKey is used to store and fetch user info from the context
 const UserInfoKey userInfoKeyType = "UserInfo"
 
@@ -37,6 +51,7 @@ type userInfo struct {
 	email  string
 	name   string
 	issuer string
+	claims jwt.MapClaims
 	jwt.StandardClaims
 }
 
@@ -47,16 +62,29 @@ type UserInfo interface {
 	Name() string
 	Issuer() string
 	Claims() jwt.StandardClaims
+	VerifiedClaims() jwt.MapClaims
 }
 
-func (u *userInfo) Sub() *Subject              { return u.sub }
-func (u *userInfo) Email() string              { return u.email }
-func (u *userInfo) Name() string               { return u.name }
-func (u *userInfo) Issuer() string             { return u.issuer }
-func (u *userInfo) Claims() jwt.StandardClaims { return u.StandardClaims }
+func (u *userInfo) Sub() *Subject                 { return u.sub }
+func (u *userInfo) Email() string                 { return u.email }
+func (u *userInfo) Name() string                  { return u.name }
+func (u *userInfo) Issuer() string                { return u.issuer }
+func (u *userInfo) Claims() jwt.StandardClaims    { return u.StandardClaims }
+func (u *userInfo) VerifiedClaims() jwt.MapClaims { return u.claims }
 
 var tweekPrivateKey *rsa.PrivateKey
 
+// LoadJWKS loads the key sets of the auth providers, which weren't loaded yet, and refreshes all of them periodically.
+// Key sets are shared between configuration reloads, so it should only be called once the configuration is applied
+func LoadJWKS(configuration *appConfig.Security) {
+	var jwksEndpoints []string
+	for _, issuer := range configuration.Auth.Providers {
+		jwksEndpoints = append(jwksEndpoints, issuer.JWKSURL)
+	}
+	LoadNewEndpoints(jwksEndpoints)
+	RefreshEndpoints(jwksEndpoints)
+}
+
 // AuthenticationMiddleware enriches the request's context with the user info from JWT
 func AuthenticationMiddleware(configuration *appConfig.Security, extractor SubjectExtractor, auditor audit.Auditor) negroni.HandlerFunc {
 	var err error
@@ -64,28 +92,23 @@ func AuthenticationMiddleware(configuration *appConfig.Security, extractor Subje
 	if err != nil {
 		logrus.Panicln("Error reading tweek private key", err)
 	}
-	var jwksEndpoints []string
-	for _, issuer := range configuration.Auth.Providers {
-		jwksEndpoints = append(jwksEndpoints, issuer.JWKSURL)
-	}
-	LoadAllEndpoints(jwksEndpoints)
-	RefreshEndpoints(jwksEndpoints)
+	requestAttributes := NewRequestAttributesExtractor(&configuration.Attributes)
 	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		ctx := WithRequestAttributes(r.Context(), requestAttributes(r))
 		info, err := userInfoFromRequest(r, configuration, extractor)
 		if err != nil {
 			auditor.TokenError(err)
 			logrus.WithError(err).Error("Error extracting the user from the request")
-			next(rw, r)
+			next(rw, r.WithContext(ctx))
 			return
 		}
 
-		newRequest := r.WithContext(context.WithValue(r.Context(), UserInfoKey, info))
+		newRequest := r.WithContext(context.WithValue(ctx, UserInfoKey, info))
 		next(rw, newRequest)
 	})
 }
 
 func userInfoFromRequest(req *http.Request, configuration *appConfig.Security, extractor SubjectExtractor) (UserInfo, error) {
-	var claims jwt.MapClaims
 	token, err := request.ParseFromRequest(req, request.AuthorizationHeaderExtractor, func(t *jwt.Token) (interface{}, error) {
 		claims := t.Claims.(jwt.MapClaims)
 		if issuer, ok := claims["iss"].(string); ok {
@@ -106,52 +129,65 @@ func userInfoFromRequest(req *http.Request, configuration *appConfig.Security, e
 		return nil, err
 	}
 
-	var sub *Subject
-	var issuer string
-
-	if err == request.ErrNoTokenInRequest {
+	var claims jwt.MapClaims
+	if err == nil {
+		claims = token.Claims.(jwt.MapClaims)
+	} else {
 		clientID := req.Header.Get("x-client-id")
 		clientSecret := req.Header.Get("x-client-secret")
 
-		if len(clientID) == 0 && len(clientSecret) == 0 {
-			sub = &Subject{User: "anonymous", Group: "anonymous"}
-			issuer = "none"
-		} else {
+		if len(clientID) != 0 || len(clientSecret) != 0 {
 			validateCredentialsErr := externalApps.ValidateCredentials(clientID, clientSecret)
 			if validateCredentialsErr != nil {
 				logrus.WithError(validateCredentialsErr).WithField("clientID", clientID).Error("Couldn't validate app for clientID")
 				return nil, validateCredentialsErr
 			}
 
-			sub = &Subject{User: clientID, Group: "externalapps"}
-			issuer = "tweek-externalapps"
+			sub := &Subject{User: clientID, Group: "externalapps"}
+			return NewUserInfo(sub, "tweek-externalapps", nil, req.URL), nil
 		}
+	}
 
-	} else {
-		var extractSubjectErr error
-		claims = token.Claims.(jwt.MapClaims)
-		issuer = claims["iss"].(string)
-		if issuer == "tweek-basic-auth" {
-			sub = &Subject{User: claims["sub"].(string), Group: "externalapps"}
-		} else {
-			sub, extractSubjectErr = extractor.ExtractSubject(req.Context(), claims)
-			if extractSubjectErr != nil {
-				logrus.WithError(extractSubjectErr).Error("Failed to extract user info from JWT claims")
-				return nil, fmt.Errorf("Failed to extract user info from JWT claims")
-			}
-		}
+	sub, issuer, err := SubjectFromClaims(req.Context(), claims, extractor)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUserInfo(sub, issuer, claims, req.URL), nil
+}
+
+// SubjectFromClaims extracts the subject and the issuer from verified JWT claims.
+// Requests without claims are anonymous
+func SubjectFromClaims(ctx context.Context, claims jwt.MapClaims, extractor SubjectExtractor) (*Subject, string, error) {
+	if len(claims) == 0 {
+		return &Subject{User: "anonymous", Group: "anonymous"}, "none", nil
+	}
 
+	issuer, _ := claims["iss"].(string)
+	if issuer == "tweek-basic-auth" {
+		user, _ := claims["sub"].(string)
+		return &Subject{User: user, Group: "externalapps"}, issuer, nil
 	}
 
-	var name, email string = getNameAndEmail(req.URL, claims, sub)
+	sub, err := extractor.ExtractSubject(ctx, claims)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to extract user info from JWT claims")
+		return nil, issuer, fmt.Errorf("Failed to extract user info from JWT claims")
+	}
+	return sub, issuer, nil
+}
+
+// NewUserInfo creates the user info of a subject, taking the name and email from the claims or the request's query
+func NewUserInfo(sub *Subject, issuer string, claims jwt.MapClaims, u *url.URL) UserInfo {
+	name, email := getNameAndEmail(u, claims, sub)
 
-	info := &userInfo{
+	return &userInfo{
 		sub:    sub,
 		issuer: issuer,
 		name:   name,
 		email:  email,
+		claims: claims,
 	}
-	return info, nil
 }
 
 func getNameAndEmail(url *url.URL, claims jwt.MapClaims, subject *Subject) (name, email string) {
@@ -13,40 +13,43 @@ import (
 // AuthorizationMiddleware enforces authorization policies of incoming requests
 func AuthorizationMiddleware(authorizer Authorizer, auditor audit.Auditor) negroni.HandlerFunc {
 	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-		user, ok := r.Context().Value(UserInfoKey).(UserInfo)
-		if !ok {
-			logrus.Error("Authentication failed")
-			auditor.TokenError(errors.New("Authentication failed"))
-			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		if user, ok := r.Context().Value(UserInfoKey).(UserInfo); ok && user.Issuer() != "tweek" && r.Method == http.MethodGet {
+			if _, ok := wholeContextIdentityType(r); ok {
+				authorizeContextRead(authorizer, auditor, rw, r, next)
+				return
+			}
+		}
+		if status := Authorize(authorizer, auditor, r); status != http.StatusOK {
+			http.Error(rw, http.StatusText(status), status)
 			return
 		}
-		if user.Issuer() == "tweek" {
-			auditor.Allowed("tweek issuer", "any", "any")
-			next(rw, r)
-		} else {
-			sub, act, ctxs, err := ExtractFromRequest(r)
-			if err != nil {
-				logrus.WithError(err).Error("Failed to extract from request")
-				auditor.AuthorizerError(sub.String(), fmt.Sprintf("%q", ctxs), act, err)
-				http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-			} else {
-				res, err := authorizer.Authorize(r.Context(), sub, ctxs, act)
-				if err != nil {
-					logrus.WithError(err).Error("Failed to validate request")
-					auditor.AuthorizerError(sub.String(), fmt.Sprintf("%q", ctxs), act, err)
-					http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-					return
-				}
+		next(rw, r)
+	})
+}
 
-				if !res {
-					auditor.Denied(sub.String(), fmt.Sprintf("%q", ctxs), act)
-					http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-					return
-				}
+// Authorize enforces the authorization policies of a request, and returns http.StatusOK if it's allowed,
+// or the status code to respond with otherwise. Context updates are authorized per property
+func Authorize(authorizer Authorizer, auditor audit.Auditor, r *http.Request) int {
+	user, ok := r.Context().Value(UserInfoKey).(UserInfo)
+	if !ok {
+		logrus.Error("Authentication failed")
+		auditor.TokenError(errors.New("Authentication failed"))
+		return http.StatusUnauthorized
+	}
+	if user.Issuer() == "tweek" {
+		auditor.Allowed("tweek issuer", "any", "any")
+		return http.StatusOK
+	}
 
-				auditor.Allowed(sub.String(), fmt.Sprintf("%q", ctxs), act)
-				next(rw, r)
-			}
-		}
-	})
+	sub, act, ctxs, err := ExtractFromRequest(r)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to extract from request")
+		auditor.AuthorizerError(sub.String(), fmt.Sprintf("%q", ctxs), act, err)
+		return http.StatusBadRequest
+	}
+
+	if identityType, ok := wholeContextIdentityType(r); ok && r.Method == http.MethodPost {
+		return authorizeContextWrite(authorizer, auditor, r, identityType, sub, act, ctxs)
+	}
+	return authorizeObject(r.Context(), authorizer, auditor, sub, ctxs, act)
 }
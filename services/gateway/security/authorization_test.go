@@ -5,7 +5,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"tweek-gateway/audit"
 )
 
 func noopHandler(rw http.ResponseWriter, r *http.Request) {}
@@ -20,6 +24,15 @@ func (a *emptyAuditor) AuthorizerError(subject, object, action string, err error
 }
 func (a *emptyAuditor) TokenError(err error) {
 }
+func (a *emptyAuditor) Filtered(subject, object, action string, count int) {
+}
+func (a *emptyAuditor) BreakGlassGranted(subject, role, justification string, expiresAt time.Time) {
+}
+func (a *emptyAuditor) BreakGlassRequest(subject, method, path string, roles []string) {
+}
+func (a *emptyAuditor) WithBreakGlass(roles []string) audit.Auditor {
+	return a
+}
 
 func TestAuthorizationMiddleware(t *testing.T) {
 	authorization, err := ioutil.ReadFile("../authorization.rego")
@@ -55,6 +68,11 @@ func TestAuthorizationMiddleware(t *testing.T) {
 			args: args{method: "GET", path: "/api/v2/values/key2?user=alice2@security.test", user: "alice2@security.test", group: "default"},
 			want: http.StatusOK,
 		},
+		{
+			name: "Deny calculating values when one of the contexts isn't allowed",
+			args: args{method: "GET", path: "/api/v2/values/key2?user=alice2@security.test&user=bob@security.test", user: "alice2@security.test", group: "default"},
+			want: http.StatusForbidden,
+		},
 		{
 			name: "Allow reading context for self",
 			args: args{method: "GET", path: "/api/v2/context/user/alice2@security.test", user: "alice2@security.test", group: "default"},
@@ -85,6 +103,16 @@ func TestAuthorizationMiddleware(t *testing.T) {
 			args: args{method: "DELETE", path: "/api/v2/context/user/bob@security.test/prop", user: "alice@security.test", group: "default"},
 			want: http.StatusForbidden,
 		},
+		{
+			name: "Allow writing keys by a policy with the user placeholder",
+			args: args{method: "POST", path: "/api/v2/keys/personal/alice@security.test/key", user: "alice@security.test", group: "default"},
+			want: http.StatusOK,
+		},
+		{
+			name: "Deny writing keys of another user by a policy with the user placeholder",
+			args: args{method: "POST", path: "/api/v2/keys/personal/alice@security.test/key", user: "bob@security.test", group: "default"},
+			want: http.StatusForbidden,
+		},
 		{
 			name: "Deny deleting context property for self",
 			args: args{method: "DELETE", path: "/api/v2/context/user/bob@security.test/prop", user: "bob@security.test", group: "default"},
@@ -115,3 +143,115 @@ func createRequest(method, target, user, group string) *http.Request {
 	ctx := context.WithValue(r.Context(), UserInfoKey, info)
 	return r.WithContext(ctx)
 }
+
+func TestAuthorizationMiddleware_contextProperties(t *testing.T) {
+	authorization, err := ioutil.ReadFile("../authorization.rego")
+	if err != nil {
+		t.Fatal("Could not load rego file")
+	}
+	policy, err := ioutil.ReadFile("./testdata/policy.json")
+	if err != nil {
+		t.Fatal("Could not load policy file")
+	}
+	authorizer := NewDefaultAuthorizer(string(authorization), string(policy), "authorization", "authorize")
+	server := AuthorizationMiddleware(authorizer, &emptyAuditor{})
+	next := func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			switch r.URL.Path {
+			case "/api/v2/context/device/dev3":
+				rw.Write([]byte(`{}`))
+			case "/api/v2/context/device/dev4":
+				rw.WriteHeader(http.StatusInternalServerError)
+				rw.Write([]byte(`{"AppVersion":"1.0","Tier":"gold"}`))
+			default:
+				rw.Write([]byte(`{"AppVersion":"1.0","Tier":"gold"}`))
+			}
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		rw.Write(body)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		maxBytes int64
+		user     string
+		group    string
+		want     int
+		wantBody string
+	}{
+		{
+			name: "Allow updating an allowed property", method: "POST", path: "/api/v2/context/device/dev1", body: `{"AppVersion":"2.0"}`,
+			user: "dev1", group: "devices", want: http.StatusOK, wantBody: `{"AppVersion":"2.0"}`,
+		},
+		{
+			name: "Deny updating a property which isn't allowed", method: "POST", path: "/api/v2/context/device/dev1", body: `{"AppVersion":"2.0","Tier":"platinum"}`,
+			user: "dev1", group: "devices", want: http.StatusForbidden,
+		},
+		{
+			name: "Deny updating another identity", method: "POST", path: "/api/v2/context/device/dev2", body: `{"AppVersion":"2.0"}`,
+			user: "dev1", group: "devices", want: http.StatusForbidden,
+		},
+		{
+			name: "Deny invalid update", method: "POST", path: "/api/v2/context/device/dev1", body: `[]`,
+			user: "dev1", group: "devices", want: http.StatusBadRequest,
+		},
+		{
+			name: "Deny update exceeding the body limit of the route", method: "POST", path: "/api/v2/context/device/dev1", body: `{"AppVersion":"2.0"}`, maxBytes: 10,
+			user: "dev1", group: "devices", want: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "Allow update within the body limit of the route", method: "POST", path: "/api/v2/context/device/dev1", body: `{"AppVersion":"2.0"}`, maxBytes: 20,
+			user: "dev1", group: "devices", want: http.StatusOK, wantBody: `{"AppVersion":"2.0"}`,
+		},
+		{
+			name: "Deny update exceeding the default body limit", method: "POST", path: "/api/v2/context/device/dev1", body: `{"AppVersion":"` + strings.Repeat("1", defaultContextMaxBytes) + `"}`,
+			user: "dev1", group: "devices", want: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "Allow updating properties with a context wildcard policy", method: "POST", path: "/api/v2/context/user/alice2@security.test", body: `{"name":"alice","prop":1}`,
+			user: "alice2@security.test", group: "default", want: http.StatusOK, wantBody: `{"name":"alice","prop":1}`,
+		},
+		{
+			name: "Filter reading properties which aren't allowed", method: "GET", path: "/api/v2/context/device/dev1",
+			user: "dev1", group: "devices", want: http.StatusOK, wantBody: `{"AppVersion":"1.0"}`,
+		},
+		{
+			name: "Deny reading when no property is allowed", method: "GET", path: "/api/v2/context/device/dev2",
+			user: "dev1", group: "devices", want: http.StatusForbidden,
+		},
+		{
+			name: "Allow reading the whole context", method: "GET", path: "/api/v2/context/user/alice2@security.test",
+			user: "alice2@security.test", group: "default", want: http.StatusOK, wantBody: `{"AppVersion":"1.0","Tier":"gold"}`,
+		},
+		{
+			name: "Allow reading an empty context with property rights", method: "GET", path: "/api/v2/context/device/dev3",
+			user: "dev3", group: "devices", want: http.StatusOK, wantBody: `{}`,
+		},
+		{
+			name: "Drop the body of a failed read", method: "GET", path: "/api/v2/context/device/dev4",
+			user: "dev4", group: "devices", want: http.StatusInternalServerError, wantBody: "Internal Server Error\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := createRequest(tt.method, tt.path, tt.user, tt.group)
+			request.Body = ioutil.NopCloser(strings.NewReader(tt.body))
+			if tt.maxBytes > 0 {
+				request = request.WithContext(context.WithValue(request.Context(), MaxRequestBytesKey, tt.maxBytes))
+			}
+
+			server.ServeHTTP(recorder, request, next)
+			if code := recorder.Result().StatusCode; code != tt.want {
+				t.Errorf("AuthorizationMiddleware() = %v, want %v", code, tt.want)
+			}
+			if got := recorder.Body.String(); (tt.want == http.StatusOK || len(tt.wantBody) > 0) && got != tt.wantBody {
+				t.Errorf("AuthorizationMiddleware() body = %v, want %v", got, tt.wantBody)
+			}
+		})
+	}
+}
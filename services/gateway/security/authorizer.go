@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/open-policy-agent/opa/storage/inmem"
 
 	"github.com/open-policy-agent/opa/ast"
@@ -20,7 +22,7 @@ type Authorizer interface {
 
 // DefaultAuthorizer is the default implementation of Authorizer
 type DefaultAuthorizer struct {
-	partialResult *rego.PartialResult
+	query rego.PreparedEvalQuery
 }
 
 // NewDefaultAuthorizer is the constructor for DefaultAuthorizer
@@ -42,6 +44,9 @@ func NewDefaultAuthorizer(rules, data, pkg, query string) *DefaultAuthorizer {
 	if err != nil {
 		logrus.WithError(err).Panic("Error deserializing JSON data")
 	}
+	if err := ValidatePolicy([]byte(data)); err != nil {
+		logrus.WithError(err).Panic("Invalid policy")
+	}
 
 	dataStore := inmem.NewFromObject(actualData)
 
@@ -57,24 +62,49 @@ func NewDefaultAuthorizer(rules, data, pkg, query string) *DefaultAuthorizer {
 		logrus.WithError(err).Panic("Error loading Rego")
 	}
 
+	// The query is prepared once, as responses filtering authorizes many objects per request
+	prepared, err := partial.Rego().PrepareForEval(context.Background())
+	if err != nil {
+		logrus.WithError(err).Panic("Error preparing Rego")
+	}
+
 	return &DefaultAuthorizer{
-		partialResult: &partial,
+		query: prepared,
 	}
 }
 
 // Authorize implements authorization for DefaultAuthorizer
 func (d *DefaultAuthorizer) Authorize(ctx context.Context, subject *Subject, object PolicyResource, action string) (bool, error) {
 	input := map[string]interface{}{
-		"group":    subject.Group,
-		"user":     subject.User,
-		"object":   object.Item,
-		"contexts": object.Contexts,
-		"action":   action,
+		"group":      subject.Group,
+		"groups":     subject.AllGroups(),
+		"attributes": map[string]interface{}{},
+		"user":       subject.User,
+		"object":     object.Item,
+		"contexts":   object.Contexts,
+		"action":     action,
+		"time":       time.Now().UnixNano(),
+	}
+	if subject.Attributes != nil {
+		input["attributes"] = subject.Attributes
+	}
+	if user, ok := ctx.Value(UserInfoKey).(UserInfo); ok {
+		input["issuer"] = user.Issuer()
+		claims := user.VerifiedClaims()
+		if claims == nil {
+			claims = jwt.MapClaims{}
+		}
+		input["claims"] = claims
+	}
+	if roles := breakGlassRoles(ctx); len(roles) > 0 {
+		input["break_glass_roles"] = roles
+	}
+	if attributes, ok := ctx.Value(RequestAttributesKey).(*RequestAttributes); ok {
+		input["source_ip"] = attributes.SourceIP
+		input["headers"] = attributes.Headers
 	}
 
-	evaluator := d.partialResult.Rego(rego.Input(input))
-
-	result, err := evaluator.Eval(ctx)
+	result, err := d.query.Eval(ctx, rego.EvalInput(input))
 
 	if err != nil {
 		return false, err
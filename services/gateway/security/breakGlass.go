@@ -0,0 +1,284 @@
+package security
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/audit"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+)
+
+const defaultBreakGlassMaxDuration = time.Hour
+
+// maxJustificationLength limits the justification recorded in the audit log
+const maxJustificationLength = 1000
+
+type breakGlassKeyType string
+
+// BreakGlassKey is used to store and fetch the active break-glass grants of the subject from the context
+const BreakGlassKey breakGlassKeyType = "BreakGlass"
+
+// BreakGlassHeader holds the break-glass tokens of a request, in several headers or separated by commas
+const BreakGlassHeader = "X-Break-Glass"
+
+// breakGlassIssuer is the issuer of break-glass tokens, which aren't accepted as authentication tokens
+const breakGlassIssuer = "tweek-break-glass"
+
+// BreakGlassGrant is temporary elevated access of a subject to a role
+type BreakGlassGrant struct {
+	Role          string    `json:"role"`
+	Justification string    `json:"justification"`
+	GrantedAt     time.Time `json:"grantedAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	// Token is the signed grant, which is only returned when it's granted
+	Token string `json:"token,omitempty"`
+}
+
+type breakGlassClaims struct {
+	Role          string `json:"role"`
+	Justification string `json:"justification"`
+	jwt.StandardClaims
+}
+
+// BreakGlassTokens issues break-glass grants as tokens signed by the tweek key, so any gateway instance can verify them.
+// Grants aren't stored, so they can't be revoked before they expire
+type BreakGlassTokens struct {
+	key *rsa.PrivateKey
+	now func() time.Time
+}
+
+// NewBreakGlassTokens creates break-glass tokens signed by the key
+func NewBreakGlassTokens(keyEnv *appConfig.EnvInlineOrPath) (*BreakGlassTokens, error) {
+	key, err := getPrivateKey(keyEnv)
+	if err != nil {
+		return nil, err
+	}
+	return &BreakGlassTokens{key: key, now: time.Now}, nil
+}
+
+// Grant issues a token granting the role to the subject for the duration
+func (t *BreakGlassTokens) Grant(sub *Subject, role, justification string, duration time.Duration) (BreakGlassGrant, error) {
+	now := t.now().Truncate(time.Second)
+	grant := BreakGlassGrant{Role: role, Justification: justification, GrantedAt: now, ExpiresAt: now.Add(duration).Truncate(time.Second)}
+	claims := breakGlassClaims{
+		Role:          role,
+		Justification: justification,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    breakGlassIssuer,
+			Subject:   sub.String(),
+			IssuedAt:  grant.GrantedAt.Unix(),
+			ExpiresAt: grant.ExpiresAt.Unix(),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(t.key)
+	if err != nil {
+		return BreakGlassGrant{}, err
+	}
+	grant.Token = token
+	return grant, nil
+}
+
+// Active verifies the break-glass tokens of the request, and returns the grants of the subject which haven't expired,
+// with the latest grant of each role. Invalid tokens and tokens of other subjects are ignored
+func (t *BreakGlassTokens) Active(sub *Subject, r *http.Request) []BreakGlassGrant {
+	now := t.now()
+	latest := map[string]BreakGlassGrant{}
+	for _, token := range breakGlassTokens(r) {
+		claims, err := t.verify(token)
+		if err != nil {
+			logrus.WithError(err).Warn("Invalid break-glass token")
+			continue
+		}
+		grant := BreakGlassGrant{
+			Role:          claims.Role,
+			Justification: claims.Justification,
+			GrantedAt:     time.Unix(claims.IssuedAt, 0),
+			ExpiresAt:     time.Unix(claims.ExpiresAt, 0),
+		}
+		if claims.Subject != sub.String() || !now.Before(grant.ExpiresAt) {
+			continue
+		}
+		if existing, ok := latest[grant.Role]; !ok || grant.GrantedAt.After(existing.GrantedAt) {
+			latest[grant.Role] = grant
+		}
+	}
+
+	var grants []BreakGlassGrant
+	for _, grant := range latest {
+		grants = append(grants, grant)
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].Role < grants[j].Role })
+	return grants
+}
+
+// verify checks the signature and the issuer of the token. Expiration is checked by the caller
+func (t *BreakGlassTokens) verify(token string) (*breakGlassClaims, error) {
+	claims := &breakGlassClaims{}
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}, SkipClaimsValidation: true}
+	if _, err := parser.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return t.key.Public(), nil
+	}); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != breakGlassIssuer {
+		return nil, fmt.Errorf("Unexpected issuer %q", claims.Issuer)
+	}
+	if len(claims.Role) == 0 {
+		return nil, errors.New("No role in claims")
+	}
+	return claims, nil
+}
+
+func breakGlassTokens(r *http.Request) []string {
+	var tokens []string
+	for _, value := range r.Header.Values(BreakGlassHeader) {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); len(token) > 0 {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// breakGlassRoles returns the roles of the active break-glass grants in the context
+func breakGlassRoles(ctx context.Context) []string {
+	grants, _ := ctx.Value(BreakGlassKey).([]BreakGlassGrant)
+	roles := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		roles = append(roles, grant.Role)
+	}
+	return roles
+}
+
+// withoutBreakGlass hides the break-glass grants of the context from the authorizer
+func withoutBreakGlass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, BreakGlassKey, []BreakGlassGrant(nil))
+}
+
+// requestAuditor marks the audit entries of requests made under break-glass grants
+func requestAuditor(ctx context.Context, auditor audit.Auditor) audit.Auditor {
+	if roles := breakGlassRoles(ctx); len(roles) > 0 {
+		return auditor.WithBreakGlass(roles)
+	}
+	return auditor
+}
+
+// BreakGlassMiddleware passes the active break-glass grants of the subject to the authorizer, and audits every request made under them.
+// The tokens aren't forwarded to the upstreams
+func BreakGlassMiddleware(tokens *BreakGlassTokens, auditor audit.Auditor) negroni.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		user, ok := r.Context().Value(UserInfoKey).(UserInfo)
+		var grants []BreakGlassGrant
+		if ok {
+			grants = tokens.Active(user.Sub(), r)
+		}
+		r.Header.Del(BreakGlassHeader)
+		if len(grants) == 0 {
+			next(rw, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), BreakGlassKey, grants)
+		auditor.BreakGlassRequest(user.Sub().String(), r.Method, r.URL.Path, breakGlassRoles(ctx))
+		next(rw, r.WithContext(ctx))
+	}
+}
+
+// BreakGlassRequest is a request for temporary elevated access to a role
+type BreakGlassRequest struct {
+	Role          string `json:"role"`
+	Justification string `json:"justification"`
+	// Duration defaults to the maximal duration
+	Duration string `json:"duration"`
+}
+
+// NewBreakGlassHandler returns the active break-glass grants of the request on GET, which are passed by BreakGlassMiddleware,
+// and grants a role on POST. Requesting a role must be allowed by a policy of the object `break-glass/<role>` and the action `write`,
+// which is authorized without the active grants, so they can't be chained into other roles
+func NewBreakGlassHandler(tokens *BreakGlassTokens, authorizer Authorizer, auditor audit.Auditor, config *appConfig.BreakGlass) (http.HandlerFunc, error) {
+	maxDuration := defaultBreakGlassMaxDuration
+	if len(config.MaxDuration) > 0 {
+		duration, err := time.ParseDuration(config.MaxDuration)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid break-glass max duration %q: %v", config.MaxDuration, err)
+		}
+		maxDuration = duration
+	}
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(UserInfoKey).(UserInfo)
+		if !ok {
+			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			grants, _ := r.Context().Value(BreakGlassKey).([]BreakGlassGrant)
+			if grants == nil {
+				grants = []BreakGlassGrant{}
+			}
+			writeBreakGlassResponse(rw, http.StatusOK, grants)
+			return
+		}
+
+		var request BreakGlassRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid break-glass request: %v", err), http.StatusBadRequest)
+			return
+		}
+		request.Justification = strings.TrimSpace(request.Justification)
+		if len(request.Role) == 0 || len(request.Justification) == 0 {
+			http.Error(rw, "Break-glass requests require a role and a justification", http.StatusBadRequest)
+			return
+		}
+		if len(request.Justification) > maxJustificationLength {
+			http.Error(rw, fmt.Sprintf("Justification must not exceed %d characters", maxJustificationLength), http.StatusBadRequest)
+			return
+		}
+		duration := maxDuration
+		if len(request.Duration) > 0 {
+			var err error
+			duration, err = time.ParseDuration(request.Duration)
+			if err != nil || duration <= 0 || duration > maxDuration {
+				http.Error(rw, fmt.Sprintf("Duration must be positive, and at most %v", maxDuration), http.StatusBadRequest)
+				return
+			}
+		}
+
+		object := PolicyResource{Item: "break-glass/" + url.PathEscape(request.Role), Contexts: map[string][]string{}}
+		if status := authorizeObject(withoutBreakGlass(r.Context()), authorizer, auditor, user.Sub(), object, "write"); status != http.StatusOK {
+			http.Error(rw, http.StatusText(status), status)
+			return
+		}
+
+		grant, err := tokens.Grant(user.Sub(), request.Role, request.Justification, duration)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to sign break-glass grant")
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		auditor.BreakGlassGranted(user.Sub().String(), grant.Role, grant.Justification, grant.ExpiresAt)
+		writeBreakGlassResponse(rw, http.StatusCreated, grant)
+	}, nil
+}
+
+func writeBreakGlassResponse(rw http.ResponseWriter, status int, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(body); err != nil {
+		logrus.WithError(err).Error("Failed to write break-glass response")
+	}
+}
@@ -0,0 +1,280 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/audit"
+)
+
+type breakGlassAuditor struct {
+	emptyAuditor
+	granted  []string
+	requests []string
+	allowed  []string
+}
+
+func (a *breakGlassAuditor) Allowed(subject, object, action string) {
+	a.allowed = append(a.allowed, subject)
+}
+
+func (a *breakGlassAuditor) WithBreakGlass(roles []string) audit.Auditor {
+	return &markedAuditor{breakGlassAuditor: a, roles: roles}
+}
+
+// markedAuditor records the entries audited under break-glass roles
+type markedAuditor struct {
+	*breakGlassAuditor
+	roles []string
+}
+
+func (a *markedAuditor) Allowed(subject, object, action string) {
+	a.allowed = append(a.allowed, subject+" "+strings.Join(a.roles, ","))
+}
+
+// responderAuthorizer allows requesting the responder role, and the admin role under a responder grant
+type responderAuthorizer struct{}
+
+func (responderAuthorizer) Authorize(ctx context.Context, subject *Subject, object PolicyResource, action string) (bool, error) {
+	roles := breakGlassRoles(ctx)
+	underResponder := len(roles) == 1 && roles[0] == "responder"
+	return object.Item == "break-glass/responder" || (object.Item == "break-glass/admin" && underResponder), nil
+}
+
+func (a *breakGlassAuditor) BreakGlassGranted(subject, role, justification string, expiresAt time.Time) {
+	a.granted = append(a.granted, subject+" "+role+" "+justification)
+}
+
+func (a *breakGlassAuditor) BreakGlassRequest(subject, method, path string, roles []string) {
+	a.requests = append(a.requests, subject+" "+method+" "+path+" "+strings.Join(roles, ","))
+}
+
+func newBreakGlassTokens(t *testing.T) *BreakGlassTokens {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &BreakGlassTokens{key: key, now: time.Now}
+}
+
+func breakGlassRequest(sub *Subject, tokens ...string) *http.Request {
+	r := httptest.NewRequest("PUT", "/api/v2/keys/some/key", nil)
+	for _, token := range tokens {
+		r.Header.Add(BreakGlassHeader, token)
+	}
+	return r.WithContext(context.WithValue(r.Context(), UserInfoKey, &userInfo{sub: sub}))
+}
+
+func TestBreakGlassTokens(t *testing.T) {
+	tokens := newBreakGlassTokens(t)
+	now := time.Now()
+	tokens.now = func() time.Time { return now }
+	// another gateway instance, with the same key
+	other := &BreakGlassTokens{key: tokens.key, now: tokens.now}
+	alice := &Subject{User: "alice", Group: "oncall"}
+
+	grant := func(tokens *BreakGlassTokens, role, justification string, duration time.Duration) string {
+		granted, err := tokens.Grant(alice, role, justification, duration)
+		if err != nil {
+			t.Fatalf("Grant() error = %v", err)
+		}
+		return granted.Token
+	}
+	responder := grant(tokens, "responder", "incident", time.Hour)
+	admin := grant(other, "admin", "incident", 10*time.Minute)
+	now = now.Add(time.Second)
+	latestResponder := grant(tokens, "responder", "still the incident", 30*time.Minute)
+	tweekToken := createNewJWT(tokens.key)
+	foreign := grant(newBreakGlassTokens(t), "admin", "forged", time.Hour)
+
+	r := breakGlassRequest(alice, responder+", "+admin, latestResponder, tweekToken, foreign, "invalid")
+	authenticated := httptest.NewRequest("GET", "/api/v2/current-user", nil)
+	authenticated.Header.Set("Authorization", "Bearer "+responder)
+	if _, err := userInfoFromRequest(authenticated, &appConfig.Security{}, nil); err == nil {
+		t.Error("userInfoFromRequest() accepted a break-glass token for authentication")
+	}
+	if got := other.Active(alice, r); len(got) != 2 || got[0].Role != "admin" || got[1].Justification != "still the incident" {
+		t.Errorf("Active() = %v, want admin and the latest responder grant", got)
+	}
+	if got := other.Active(&Subject{User: "alice", Group: "other"}, r); len(got) != 0 {
+		t.Errorf("Active() of another subject = %v, want none", got)
+	}
+
+	now = now.Add(20 * time.Minute)
+	if got := other.Active(alice, r); len(got) != 1 || got[0].Justification != "still the incident" {
+		t.Errorf("Active() = %v, want only the latest responder grant after admin expired", got)
+	}
+
+	now = now.Add(20 * time.Minute)
+	if got := other.Active(alice, r); len(got) != 1 || got[0].Justification != "incident" {
+		t.Errorf("Active() = %v, want the earlier responder grant after the latest expired", got)
+	}
+
+	now = now.Add(time.Hour)
+	if got := other.Active(alice, r); len(got) != 0 {
+		t.Errorf("Active() = %v, want no grants after all expired", got)
+	}
+}
+
+func TestBreakGlassHandler(t *testing.T) {
+	authorizer := responderAuthorizer{}
+	tokens := newBreakGlassTokens(t)
+	alice := &Subject{User: "alice", Group: "oncall"}
+	responder, err := tokens.Grant(alice, "responder", "incident 41", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		grants      []string
+		want        int
+		wantGranted bool
+	}{
+		{
+			name:        "Granted",
+			body:        `{"role":"responder","justification":"incident 42","duration":"30m"}`,
+			want:        http.StatusCreated,
+			wantGranted: true,
+		},
+		{
+			name:        "Default duration",
+			body:        `{"role":"responder","justification":"incident 42"}`,
+			want:        http.StatusCreated,
+			wantGranted: true,
+		},
+		{
+			name: "Role not allowed",
+			body: `{"role":"admin","justification":"incident 42"}`,
+			want: http.StatusForbidden,
+		},
+		{
+			name:   "Role allowed only under an active grant",
+			body:   `{"role":"admin","justification":"incident 42"}`,
+			grants: []string{responder.Token},
+			want:   http.StatusForbidden,
+		},
+		{
+			name: "Missing justification",
+			body: `{"role":"responder","justification":" "}`,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "Duration above maximum",
+			body: `{"role":"responder","justification":"incident 42","duration":"2h"}`,
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "Invalid body",
+			body: `responder`,
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor := &breakGlassAuditor{}
+			handler, err := NewBreakGlassHandler(tokens, authorizer, auditor, &appConfig.BreakGlass{Enabled: true, MaxDuration: "1h"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("POST", "/api/v2/break-glass", strings.NewReader(tt.body))
+			for _, token := range tt.grants {
+				r.Header.Add(BreakGlassHeader, token)
+			}
+			r = r.WithContext(context.WithValue(r.Context(), UserInfoKey, &userInfo{sub: alice}))
+			recorder := httptest.NewRecorder()
+			BreakGlassMiddleware(tokens, auditor)(recorder, r, handler)
+
+			if recorder.Code != tt.want {
+				t.Fatalf("Status code = %v, want %v (%s)", recorder.Code, tt.want, recorder.Body.String())
+			}
+			var grant BreakGlassGrant
+			json.Unmarshal(recorder.Body.Bytes(), &grant)
+			granted := len(tokens.Active(alice, breakGlassRequest(alice, grant.Token))) == 1
+			if granted != tt.wantGranted || (len(auditor.granted) == 1) != tt.wantGranted {
+				t.Errorf("Granted = %v, audited %v, want %v", granted, auditor.granted, tt.wantGranted)
+			}
+			if !tt.wantGranted {
+				return
+			}
+
+			r = httptest.NewRequest("GET", "/api/v2/break-glass", nil)
+			r.Header.Set(BreakGlassHeader, grant.Token)
+			r = r.WithContext(context.WithValue(r.Context(), UserInfoKey, &userInfo{sub: alice}))
+			recorder = httptest.NewRecorder()
+			BreakGlassMiddleware(tokens, auditor)(recorder, r, handler)
+			var grants []BreakGlassGrant
+			if err := json.Unmarshal(recorder.Body.Bytes(), &grants); err != nil || len(grants) != 1 || grants[0].Justification != "incident 42" {
+				t.Errorf("Active grants = %s, want the granted role", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewBreakGlassHandler_InvalidMaxDuration(t *testing.T) {
+	if _, err := NewBreakGlassHandler(newBreakGlassTokens(t), responderAuthorizer{}, &emptyAuditor{}, &appConfig.BreakGlass{Enabled: true, MaxDuration: "an hour"}); err == nil {
+		t.Error("NewBreakGlassHandler() error = nil, want an error for an invalid max duration")
+	}
+}
+
+func TestBreakGlassMiddleware(t *testing.T) {
+	tokens := newBreakGlassTokens(t)
+	auditor := &breakGlassAuditor{}
+	alice := &Subject{User: "alice", Group: "oncall"}
+	grant, err := tokens.Grant(alice, "responder", "incident 42", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		sub       *Subject
+		tokens    []string
+		wantRoles []string
+		wantAudit string
+	}{
+		{name: "With grants", sub: alice, tokens: []string{grant.Token}, wantRoles: []string{"responder"}, wantAudit: "oncall:alice responder"},
+		{name: "Without grants", sub: alice, wantRoles: []string{}, wantAudit: "oncall:alice"},
+		{name: "With grants of another subject", sub: &Subject{User: "bob", Group: "oncall"}, tokens: []string{grant.Token}, wantRoles: []string{}, wantAudit: "oncall:bob"},
+	}
+	allowAll := funcAuthorizer(func(object PolicyResource) bool { return true })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor.requests = nil
+			auditor.allowed = nil
+			r := breakGlassRequest(tt.sub, tt.tokens...)
+
+			var roles []string
+			var forwarded string
+			BreakGlassMiddleware(tokens, auditor)(httptest.NewRecorder(), r, func(rw http.ResponseWriter, r *http.Request) {
+				roles = breakGlassRoles(r.Context())
+				forwarded = r.Header.Get(BreakGlassHeader)
+				authorizeObject(r.Context(), allowAll, auditor, tt.sub, PolicyResource{Item: "key"}, "write")
+			})
+
+			if !reflect.DeepEqual(roles, tt.wantRoles) {
+				t.Errorf("Break-glass roles = %v, want %v", roles, tt.wantRoles)
+			}
+			if flagged := len(auditor.requests) == 1; flagged != (len(tt.wantRoles) > 0) {
+				t.Errorf("Audited requests = %v, want flagged %v", auditor.requests, len(tt.wantRoles) > 0)
+			}
+			if len(auditor.allowed) != 1 || auditor.allowed[0] != tt.wantAudit {
+				t.Errorf("Audited allowed = %v, want %q", auditor.allowed, tt.wantAudit)
+			}
+			if len(forwarded) > 0 {
+				t.Errorf("Forwarded break-glass header = %q, want it removed", forwarded)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"tweek-gateway/audit"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/negroni"
+)
+
+// defaultContextMaxBytes limits the body of context updates, on routes without a request body limit
+const defaultContextMaxBytes = 1 << 20
+
+type maxRequestBytesKeyType string
+
+// MaxRequestBytesKey is used to store and fetch the request body limit of the route from the context
+const MaxRequestBytesKey maxRequestBytesKeyType = "MaxRequestBytes"
+
+// MaxRequestBytesMiddleware stores the request body limit of the route in the context, so the body is limited
+// when it's read for authorization, before reaching the proxy
+func MaxRequestBytesMiddleware(max int64) negroni.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		next(rw, r.WithContext(context.WithValue(r.Context(), MaxRequestBytesKey, max)))
+	}
+}
+
+// errForbidden is returned by response filters, when nothing in the response may be read
+var errForbidden = errors.New("Nothing in the response is allowed")
+
+// wholeContextIdentityType returns the identity type of requests of a whole identity's context, which are authorized per property
+func wholeContextIdentityType(r *http.Request) (string, bool) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/v2/context/")
+	if path == r.URL.EscapedPath() {
+		return "", false
+	}
+	segments := strings.Split(path, "/")
+	if len(segments) != 2 || len(segments[contextIdentityType]) == 0 || len(segments[contextIdentityID]) == 0 {
+		return "", false
+	}
+	return segments[contextIdentityType], true
+}
+
+func contextPropertyResource(identityType, property string, ctxs PolicyResource) PolicyResource {
+	return PolicyResource{Item: fmt.Sprintf("context/%v/%v", identityType, url.PathEscape(property)), Contexts: ctxs.Contexts}
+}
+
+// authorizeContextWrite authorizes each property in the body of a context update, and rejects the update
+// if any of them isn't allowed. Updates without properties are authorized against the whole context
+func authorizeContextWrite(authorizer Authorizer, auditor audit.Auditor, r *http.Request, identityType string, sub *Subject, act string, obj PolicyResource) int {
+	max, _ := r.Context().Value(MaxRequestBytesKey).(int64)
+	if max <= 0 {
+		max = defaultContextMaxBytes
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, max))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return http.StatusRequestEntityTooLarge
+		}
+		logrus.WithError(err).Error("Failed to read context update")
+		return http.StatusBadRequest
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var properties map[string]json.RawMessage
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &properties); err != nil {
+			auditor.AuthorizerError(sub.String(), fmt.Sprintf("%q", obj), act, err)
+			return http.StatusBadRequest
+		}
+	}
+	if len(properties) == 0 {
+		return authorizeObject(r.Context(), authorizer, auditor, sub, obj, act)
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if status := authorizeObject(r.Context(), authorizer, auditor, sub, contextPropertyResource(identityType, name, obj), act); status != http.StatusOK {
+			return status
+		}
+	}
+	return http.StatusOK
+}
+
+// authorizeContextRead filters the properties of a context response to the ones the subject may read.
+// Subjects who may read none of them, and aren't allowed the whole context, are rejected. Empty contexts are returned as they are
+func authorizeContextRead(authorizer Authorizer, auditor audit.Auditor, rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	auditor = requestAuditor(r.Context(), auditor)
+	identityType, _ := wholeContextIdentityType(r)
+	sub, act, obj, err := ExtractFromRequest(r)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to extract from request")
+		auditor.AuthorizerError(sub.String(), fmt.Sprintf("%q", obj), act, err)
+		http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	wholeContext, err := authorizer.Authorize(r.Context(), sub, obj, act)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to validate request")
+		auditor.AuthorizerError(sub.String(), fmt.Sprintf("%q", obj), act, err)
+		http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	filterResponse(rw, r, next, func(body []byte, _ http.Header) ([]byte, error) {
+		if len(bytes.TrimSpace(body)) == 0 {
+			if !wholeContext {
+				auditor.Denied(sub.String(), fmt.Sprintf("%q", obj), act)
+				return nil, errForbidden
+			}
+			auditor.Allowed(sub.String(), fmt.Sprintf("%q", obj), act)
+			return body, nil
+		}
+
+		var properties map[string]json.RawMessage
+		if err := json.Unmarshal(body, &properties); err != nil {
+			return nil, fmt.Errorf("Invalid context response: %v", err)
+		}
+		filtered := 0
+		for name := range properties {
+			object := contextPropertyResource(identityType, name, obj)
+			allowed, err := authorizer.Authorize(r.Context(), sub, object, act)
+			if err != nil {
+				auditor.AuthorizerError(sub.String(), fmt.Sprintf("%q", object), act, err)
+			}
+			if !allowed {
+				delete(properties, name)
+				filtered++
+			}
+		}
+
+		if len(properties) == 0 && filtered > 0 && !wholeContext {
+			auditor.Denied(sub.String(), fmt.Sprintf("%q", obj), act)
+			return nil, errForbidden
+		}
+		auditor.Allowed(sub.String(), fmt.Sprintf("%q", obj), act)
+		if filtered > 0 {
+			auditor.Filtered(sub.String(), fmt.Sprintf("%q", obj), act, filtered)
+		}
+		return json.Marshal(properties)
+	})
+}
+
+func authorizeObject(ctx context.Context, authorizer Authorizer, auditor audit.Auditor, sub *Subject, obj PolicyResource, act string) int {
+	auditor = requestAuditor(ctx, auditor)
+	res, err := authorizer.Authorize(ctx, sub, obj, act)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to validate request")
+		auditor.AuthorizerError(sub.String(), fmt.Sprintf("%q", obj), act, err)
+		return http.StatusUnauthorized
+	}
+
+	if !res {
+		auditor.Denied(sub.String(), fmt.Sprintf("%q", obj), act)
+		return http.StatusForbidden
+	}
+
+	auditor.Allowed(sub.String(), fmt.Sprintf("%q", obj), act)
+	return http.StatusOK
+}
@@ -0,0 +1,290 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+)
+
+// DirectoryEntry holds the additional groups and attributes of a user
+type DirectoryEntry struct {
+	Groups     []string               `json:"groups"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Directory looks up the additional groups and attributes of subjects
+type Directory interface {
+	Lookup(ctx context.Context, subject *Subject) (*DirectoryEntry, error)
+}
+
+// EnrichingSubjectExtractor adds the groups and attributes found in a directory to the extracted subjects
+type EnrichingSubjectExtractor struct {
+	extractor       SubjectExtractor
+	directory       Directory
+	fallbackToToken bool
+}
+
+// NewEnrichingSubjectExtractor creates an extractor, which enriches the subjects of extractor.
+// Subjects are rejected when the directory fails, unless fallbackToToken is set
+func NewEnrichingSubjectExtractor(extractor SubjectExtractor, directory Directory, fallbackToToken bool) *EnrichingSubjectExtractor {
+	return &EnrichingSubjectExtractor{
+		extractor:       extractor,
+		directory:       directory,
+		fallbackToToken: fallbackToToken,
+	}
+}
+
+// ExtractSubject implements extraction for EnrichingSubjectExtractor
+func (e *EnrichingSubjectExtractor) ExtractSubject(ctx context.Context, claims jwt.MapClaims) (*Subject, error) {
+	sub, err := e.extractor.ExtractSubject(ctx, claims)
+	if err != nil || claims["iss"] == "tweek" {
+		return sub, err
+	}
+
+	entry, err := e.directory.Lookup(ctx, sub)
+	if err != nil {
+		if e.fallbackToToken {
+			logrus.WithError(err).WithField("subject", sub.String()).Warn("Directory lookup failed, using the subject of the token")
+			return sub, nil
+		}
+		return &Subject{}, fmt.Errorf("Directory lookup of %s failed: %v", sub, err)
+	}
+	return enrichSubject(sub, entry), nil
+}
+
+// enrichSubject returns a copy of the subject with the groups and attributes of the entry. Groups of the token come first
+func enrichSubject(sub *Subject, entry *DirectoryEntry) *Subject {
+	enriched := &Subject{User: sub.User, Group: sub.Group, Groups: append([]string{}, sub.AllGroups()...), Attributes: map[string]interface{}{}}
+	for name, value := range sub.Attributes {
+		enriched.Attributes[name] = value
+	}
+	if entry == nil {
+		return enriched
+	}
+
+	for _, group := range entry.Groups {
+		exists := false
+		for _, existing := range enriched.Groups {
+			if existing == group {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			enriched.Groups = append(enriched.Groups, group)
+		}
+	}
+	for name, value := range entry.Attributes {
+		enriched.Attributes[name] = value
+	}
+	return enriched
+}
+
+// HTTPDirectory looks up subjects with GET requests to a directory service, which responds with a DirectoryEntry.
+// Users unknown to the directory (404) have no additional groups or attributes
+type HTTPDirectory struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPDirectory creates a directory of the service at directoryURL
+func NewHTTPDirectory(directoryURL string, timeout time.Duration) *HTTPDirectory {
+	return &HTTPDirectory{
+		url:    directoryURL,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Lookup implements Directory for HTTPDirectory
+func (d *HTTPDirectory) Lookup(ctx context.Context, subject *Subject) (*DirectoryEntry, error) {
+	u, err := url.Parse(d.url)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("user", subject.User)
+	query.Set("group", subject.Group)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return &DirectoryEntry{}, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Directory responded with status %d", res.StatusCode)
+	}
+
+	entry := &DirectoryEntry{}
+	if err := json.NewDecoder(res.Body).Decode(entry); err != nil {
+		return nil, fmt.Errorf("Invalid directory response: %v", err)
+	}
+	return entry, nil
+}
+
+// CachedDirectory caches the successful lookups of a directory for a TTL
+type CachedDirectory struct {
+	directory Directory
+	ttl       time.Duration
+	now       func() time.Time
+
+	lock      sync.Mutex
+	entries   map[string]cachedEntry
+	lastSweep time.Time
+}
+
+type cachedEntry struct {
+	entry   *DirectoryEntry
+	expires time.Time
+}
+
+// NewCachedDirectory creates a cache of the directory's lookups
+func NewCachedDirectory(directory Directory, ttl time.Duration) *CachedDirectory {
+	return &CachedDirectory{
+		directory: directory,
+		ttl:       ttl,
+		now:       time.Now,
+		entries:   map[string]cachedEntry{},
+	}
+}
+
+// Lookup implements Directory for CachedDirectory
+func (c *CachedDirectory) Lookup(ctx context.Context, subject *Subject) (*DirectoryEntry, error) {
+	key := subject.String()
+	c.lock.Lock()
+	cached, ok := c.entries[key]
+	c.lock.Unlock()
+	if ok && c.now().Before(cached.expires) {
+		return cached.entry, nil
+	}
+
+	entry, err := c.directory.Lookup(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.now()
+	// expired entries are removed once per TTL, so subjects which stopped sending requests don't pile up
+	if now.Sub(c.lastSweep) > c.ttl {
+		for key, cached := range c.entries {
+			if !now.Before(cached.expires) {
+				delete(c.entries, key)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.entries[key] = cachedEntry{entry: entry, expires: now.Add(c.ttl)}
+	return entry, nil
+}
+
+// MappingDirectory looks up users in a mapping loaded from the policy storage
+type MappingDirectory struct {
+	lock    sync.RWMutex
+	entries map[string]*DirectoryEntry
+}
+
+// NewMappingDirectory creates an empty mapping directory
+func NewMappingDirectory() *MappingDirectory {
+	return &MappingDirectory{entries: map[string]*DirectoryEntry{}}
+}
+
+// Lookup implements Directory for MappingDirectory
+func (m *MappingDirectory) Lookup(ctx context.Context, subject *Subject) (*DirectoryEntry, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if entry, ok := m.entries[subject.User]; ok {
+		return entry, nil
+	}
+	return &DirectoryEntry{}, nil
+}
+
+// Update replaces the mapping with the one parsed from data, in JSON or CSV format by the object's name
+func (m *MappingDirectory) Update(name string, data []byte) error {
+	var entries map[string]*DirectoryEntry
+	var err error
+	if strings.HasSuffix(name, ".csv") {
+		entries, err = parseCSVMapping(data)
+	} else {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid mapping %s: %v", name, err)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.entries = entries
+	return nil
+}
+
+// parseCSVMapping parses rows of users and their groups. The header must have a `user` column, and may have a `group` column.
+// Other columns are attributes, and users with several groups have a row for each
+func parseCSVMapping(data []byte) (map[string]*DirectoryEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	userColumn, groupColumn := -1, -1
+	for i, column := range header {
+		switch strings.TrimSpace(column) {
+		case "user":
+			userColumn = i
+		case "group":
+			groupColumn = i
+		}
+	}
+	if userColumn < 0 {
+		return nil, fmt.Errorf("Expected a user column, but got %v", header)
+	}
+
+	entries := map[string]*DirectoryEntry{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		user := strings.TrimSpace(row[userColumn])
+		entry, ok := entries[user]
+		if !ok {
+			entry = &DirectoryEntry{Attributes: map[string]interface{}{}}
+			entries[user] = entry
+		}
+		for i, value := range row {
+			value = strings.TrimSpace(value)
+			switch {
+			case i == userColumn || len(value) == 0:
+			case i == groupColumn:
+				entry.Groups = append(entry.Groups, value)
+			default:
+				entry.Attributes[strings.TrimSpace(header[i])] = value
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package security
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+type staticExtractor struct{}
+
+func (staticExtractor) ExtractSubject(ctx context.Context, claims jwt.MapClaims) (*Subject, error) {
+	return &Subject{User: claims["sub"].(string), Group: "default"}, nil
+}
+
+func TestEnrichingSubjectExtractor_ExtractSubject(t *testing.T) {
+	lookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		lookups++
+		switch r.URL.Query().Get("user") {
+		case "alice":
+			rw.Write([]byte(`{"groups":["default","editors"],"attributes":{"department":"engineering"}}`))
+		case "unknown":
+			http.NotFound(rw, r)
+		default:
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name            string
+		user            string
+		fallbackToToken bool
+		want            *Subject
+		wantErr         bool
+	}{
+		{
+			name: "Enriched",
+			user: "alice",
+			want: &Subject{User: "alice", Group: "default", Groups: []string{"default", "editors"}, Attributes: map[string]interface{}{"department": "engineering"}},
+		},
+		{
+			name: "Unknown user",
+			user: "unknown",
+			want: &Subject{User: "unknown", Group: "default", Groups: []string{"default"}, Attributes: map[string]interface{}{}},
+		},
+		{
+			name:    "Directory failure fails closed",
+			user:    "bob",
+			wantErr: true,
+		},
+		{
+			name:            "Directory failure falls back to the token",
+			user:            "bob",
+			fallbackToToken: true,
+			want:            &Subject{User: "bob", Group: "default"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor := NewEnrichingSubjectExtractor(staticExtractor{}, NewHTTPDirectory(server.URL, time.Second), tt.fallbackToToken)
+			got, err := extractor.ExtractSubject(context.Background(), jwt.MapClaims{"iss": "https://issuer", "sub": tt.user})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractSubject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractSubject() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	lookups = 0
+	extractor := NewEnrichingSubjectExtractor(staticExtractor{}, NewHTTPDirectory(server.URL, time.Second), false)
+	if _, err := extractor.ExtractSubject(context.Background(), jwt.MapClaims{"iss": "tweek", "sub": "bob"}); err != nil || lookups != 0 {
+		t.Errorf("ExtractSubject() of tweek tokens error = %v, lookups = %v, want no lookups", err, lookups)
+	}
+}
+
+type countingDirectory struct {
+	lookups int
+	err     error
+}
+
+func (d *countingDirectory) Lookup(ctx context.Context, subject *Subject) (*DirectoryEntry, error) {
+	d.lookups++
+	return &DirectoryEntry{Groups: []string{"editors"}}, d.err
+}
+
+func TestCachedDirectory_Lookup(t *testing.T) {
+	directory := &countingDirectory{}
+	cache := NewCachedDirectory(directory, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	alice := &Subject{User: "alice", Group: "default"}
+
+	cache.Lookup(context.Background(), alice)
+	cache.Lookup(context.Background(), alice)
+	if directory.lookups != 1 {
+		t.Errorf("Lookups = %v, want 1 within TTL", directory.lookups)
+	}
+
+	cache.Lookup(context.Background(), &Subject{User: "bob", Group: "default"})
+	if directory.lookups != 2 {
+		t.Errorf("Lookups = %v, want 2 for another subject", directory.lookups)
+	}
+
+	now = now.Add(2 * time.Minute)
+	directory.err = context.DeadlineExceeded
+	if _, err := cache.Lookup(context.Background(), alice); err == nil {
+		t.Error("Lookup() after TTL returned no error, want the directory's error")
+	}
+	directory.err = nil
+	cache.Lookup(context.Background(), alice)
+	if directory.lookups != 4 {
+		t.Errorf("Lookups = %v, want 4 as failures aren't cached", directory.lookups)
+	}
+	if len(cache.entries) != 1 {
+		t.Errorf("Cached entries = %v, want expired entries removed", len(cache.entries))
+	}
+}
+
+func TestMappingDirectory_Update(t *testing.T) {
+	tests := []struct {
+		name    string
+		object  string
+		data    string
+		want    *DirectoryEntry
+		wantErr bool
+	}{
+		{
+			name:   "JSON",
+			object: "security/directory.json",
+			data:   `{"alice":{"groups":["editors"],"attributes":{"department":"engineering"}}}`,
+			want:   &DirectoryEntry{Groups: []string{"editors"}, Attributes: map[string]interface{}{"department": "engineering"}},
+		},
+		{
+			name:   "CSV",
+			object: "security/directory.csv",
+			data:   "user,group,department\nalice,editors,engineering\nalice,release-managers,\nbob,readers,sales\n",
+			want:   &DirectoryEntry{Groups: []string{"editors", "release-managers"}, Attributes: map[string]interface{}{"department": "engineering"}},
+		},
+		{
+			name:    "CSV without users",
+			object:  "security/directory.csv",
+			data:    "group,department\neditors,engineering\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := NewMappingDirectory()
+			if err := directory.Update(tt.object, []byte(tt.data)); (err != nil) != tt.wantErr {
+				t.Fatalf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, _ := directory.Lookup(context.Background(), &Subject{User: "alice", Group: "default"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
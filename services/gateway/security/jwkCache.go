@@ -2,9 +2,19 @@ package security
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"tweek-gateway/appConfig"
+	"tweek-gateway/snapshot"
+
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/sirupsen/logrus"
 )
@@ -14,14 +24,30 @@ type jwkRecord struct {
 	err error
 }
 
-var jwkCache map[string]*jwkRecord
+var jwkCache struct {
+	lock    sync.RWMutex
+	records map[string]*jwkRecord
+}
+
+// jwksTransports holds the *JWKSTransports used to fetch the endpoints
+var jwksTransports atomic.Value
+
+// jwkSnapshots keeps the last successfully fetched key sets, to be used when an endpoint is unreachable
+var jwkSnapshots *snapshot.Store
+
+var refreshed struct {
+	lock      sync.Mutex
+	endpoints map[string]bool
+	started   bool
+}
 
 func init() {
-	jwkCache = map[string]*jwkRecord{}
+	jwkCache.records = map[string]*jwkRecord{}
+	refreshed.endpoints = map[string]bool{}
 }
 
 func getJWKByEndpoint(endpoint, keyID string) (rawKey interface{}, err error) {
-	rec, ok := jwkCache[endpoint]
+	rec, ok := cachedRecord(endpoint)
 	if !ok {
 		return nil, fmt.Errorf("No keys found for endpoint %s", endpoint)
 	}
@@ -45,6 +71,93 @@ func getJWKByEndpoint(endpoint, keyID string) (rawKey interface{}, err error) {
 	return
 }
 
+// UseSnapshots sets the store used to save and restore the last successfully fetched key sets
+func UseSnapshots(store *snapshot.Store) {
+	jwkSnapshots = store
+}
+
+// JWKSTransports holds the transports used to fetch JWKS endpoints with TLS options
+type JWKSTransports struct {
+	endpoints map[string]*http.Transport
+	upstreams func(*url.URL) http.RoundTripper
+}
+
+// NewJWKSTransports creates the transports of the providers' JWKS endpoints. The TLS options of a provider
+// override the TLS options of all providers, and endpoints without TLS options use the transport of the upstream serving them, if any
+func NewJWKSTransports(auth *appConfig.Auth, upstreams func(*url.URL) http.RoundTripper) (*JWKSTransports, error) {
+	transports := &JWKSTransports{endpoints: map[string]*http.Transport{}, upstreams: upstreams}
+	for key, provider := range auth.Providers {
+		options := provider.JWKSTLS
+		if options == (appConfig.TLS{}) {
+			options = auth.JWKSTLS
+		}
+		config, err := appConfig.LoadTLSConfig(&options)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid jwks_tls of provider %s: %v", key, err)
+		}
+		if config == nil {
+			continue
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		transports.endpoints[provider.JWKSURL] = transport
+	}
+	return transports, nil
+}
+
+func (t *JWKSTransports) transportFor(endpoint string) http.RoundTripper {
+	if transport, ok := t.endpoints[endpoint]; ok {
+		return transport
+	}
+	if t.upstreams == nil {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil
+	}
+	return t.upstreams(u)
+}
+
+func (t *JWKSTransports) closeIdleConnections() {
+	for _, transport := range t.endpoints {
+		transport.CloseIdleConnections()
+	}
+}
+
+// UseTransports sets the transports used to fetch the endpoints, closing the idle connections of the previous ones
+func UseTransports(transports *JWKSTransports) {
+	previous, _ := jwksTransports.Load().(*JWKSTransports)
+	jwksTransports.Store(transports)
+	if previous != nil {
+		previous.closeIdleConnections()
+	}
+}
+
+func fetchOptions(endpoint string) []jwk.FetchOption {
+	transports, _ := jwksTransports.Load().(*JWKSTransports)
+	if transports == nil {
+		return nil
+	}
+	if transport := transports.transportFor(endpoint); transport != nil {
+		return []jwk.FetchOption{jwk.WithHTTPClient(&http.Client{Transport: transport})}
+	}
+	return nil
+}
+
+func cachedRecord(endpoint string) (*jwkRecord, bool) {
+	jwkCache.lock.RLock()
+	defer jwkCache.lock.RUnlock()
+	rec, ok := jwkCache.records[endpoint]
+	return rec, ok
+}
+
+func cacheRecord(endpoint string, rec *jwkRecord) {
+	jwkCache.lock.Lock()
+	defer jwkCache.lock.Unlock()
+	jwkCache.records[endpoint] = rec
+}
+
 // LoadAllEndpoints loads all the endpoints
 func LoadAllEndpoints(endpoints []string) {
 	for _, ep := range endpoints {
@@ -52,35 +165,72 @@ func LoadAllEndpoints(endpoints []string) {
 	}
 }
 
-// RefreshEndpoints refreshes endpoints
+// LoadNewEndpoints loads the endpoints which weren't loaded yet, keeping the cached keys of the others.
+// It is used on configuration reloads, where the cached endpoints are refreshed by RefreshEndpoints
+func LoadNewEndpoints(endpoints []string) {
+	for _, ep := range endpoints {
+		if _, ok := cachedRecord(ep); !ok {
+			loadEndpoint(ep)
+		}
+	}
+}
+
+// RefreshEndpoints refreshes endpoints. Endpoints are added to a single refresh loop, so it can be called on every configuration reload
 func RefreshEndpoints(endpoints []string) {
+	refreshed.lock.Lock()
+	defer refreshed.lock.Unlock()
+	for _, ep := range endpoints {
+		refreshed.endpoints[ep] = true
+	}
+	if refreshed.started {
+		return
+	}
+	refreshed.started = true
+
 	ticker := time.NewTicker(time.Hour * 24)
 	go func() {
 		for true {
 			<-ticker.C
-			for _, ep := range endpoints {
+			for _, ep := range refreshedEndpoints() {
 				loadEndpoint(ep)
 			}
 		}
 	}()
 }
 
+func refreshedEndpoints() []string {
+	refreshed.lock.Lock()
+	defer refreshed.lock.Unlock()
+	endpoints := make([]string, 0, len(refreshed.endpoints))
+	for ep := range refreshed.endpoints {
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints
+}
+
 func loadEndpoint(endpoint string) *jwkRecord {
 	return loadEndpointWithRetry(endpoint, 0)
 }
 
 func loadEndpointWithRetry(endpoint string, retryCount uint) *jwkRecord {
 	rec := &jwkRecord{}
-	rec.set, rec.err = jwk.Fetch(context.Background(), endpoint)
-	jwkCache[endpoint] = rec
-
-	if rec.err != nil {
+	rec.set, rec.err = jwk.Fetch(context.Background(), endpoint, fetchOptions(endpoint)...)
+	failed := rec.err != nil
+	if !failed {
+		saveSnapshot(endpoint, rec.set)
+	} else {
 		logrus.WithError(rec.err).WithField("endpoint", endpoint).Error("Unable to load keys for endpoint")
+		if set, err := loadSnapshot(endpoint); err == nil {
+			jwkSnapshots.SetDegraded(degradedName(endpoint), rec.err)
+			rec.set, rec.err = set, nil
+		}
+	}
+	cacheRecord(endpoint, rec)
 
+	if failed {
 		go func() {
 			<-time.After(time.Second * (1 << retryCount))
-			cached := jwkCache[endpoint]
-			if cached == rec {
+			if cached, _ := cachedRecord(endpoint); cached == rec {
 				nextCount := retryCount + 1
 				if nextCount > 6 {
 					// limit retry delay to 64 Seconds (~1 Minute)
@@ -93,3 +243,34 @@ func loadEndpointWithRetry(endpoint string, retryCount uint) *jwkRecord {
 
 	return rec
 }
+
+func snapshotName(endpoint string) string {
+	hash := sha256.Sum256([]byte(endpoint))
+	return fmt.Sprintf("jwks/%s.json", hex.EncodeToString(hash[:]))
+}
+
+func degradedName(endpoint string) string {
+	return "jwks " + endpoint
+}
+
+func saveSnapshot(endpoint string, set jwk.Set) {
+	if !jwkSnapshots.Enabled() {
+		return
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		logrus.WithError(err).WithField("endpoint", endpoint).Warn("Unable to serialize keys for snapshot")
+		return
+	}
+	jwkSnapshots.Save(snapshotName(endpoint), data)
+	jwkSnapshots.ClearDegraded(degradedName(endpoint))
+}
+
+func loadSnapshot(endpoint string) (jwk.Set, error) {
+	data, err := jwkSnapshots.Load(snapshotName(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	return jwk.Parse(data)
+}
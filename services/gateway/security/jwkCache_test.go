@@ -0,0 +1,83 @@
+package security
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"tweek-gateway/appConfig"
+)
+
+func TestJWKSTransports(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(`{"keys":[{"kty":"oct","kid":"k1","k":"c2VjcmV0"}]}`))
+	}))
+	defer server.Close()
+	ca := appConfig.TLS{CA: appConfig.EnvInlineOrPath{
+		Inline: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+	}}
+	upstreamTransport := server.Client().Transport
+	upstreams := func(u *url.URL) http.RoundTripper {
+		if u.Host == "upstream" {
+			return upstreamTransport
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		auth    appConfig.Auth
+		wantErr bool
+	}{
+		{
+			name: "Provider TLS options",
+			auth: appConfig.Auth{Providers: map[string]appConfig.AuthProvider{"mock": {JWKSURL: server.URL, JWKSTLS: ca}}},
+		},
+		{
+			name: "TLS options of all providers",
+			auth: appConfig.Auth{JWKSTLS: ca, Providers: map[string]appConfig.AuthProvider{"mock": {JWKSURL: server.URL}}},
+		},
+		{
+			name: "Provider TLS options override the options of all providers",
+			auth: appConfig.Auth{
+				JWKSTLS:   appConfig.TLS{MinVersion: "1.3", ServerName: "other"},
+				Providers: map[string]appConfig.AuthProvider{"mock": {JWKSURL: server.URL, JWKSTLS: ca}},
+			},
+		},
+		{
+			name:    "Without TLS options",
+			auth:    appConfig.Auth{Providers: map[string]appConfig.AuthProvider{"mock": {JWKSURL: server.URL}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transports, err := NewJWKSTransports(&tt.auth, upstreams)
+			if err != nil {
+				t.Fatalf("NewJWKSTransports() error = %v", err)
+			}
+			UseTransports(transports)
+			defer UseTransports(nil)
+
+			if rec := loadEndpoint(server.URL); (rec.err != nil) != tt.wantErr {
+				t.Errorf("loadEndpoint() error = %v, wantErr %v", rec.err, tt.wantErr)
+			}
+		})
+	}
+
+	transports, _ := NewJWKSTransports(&appConfig.Auth{}, upstreams)
+	if transport := transports.transportFor("https://upstream/jwks"); transport != upstreamTransport {
+		t.Error("transportFor() of an endpoint served by an upstream should use the upstream's transport")
+	}
+	if transport := transports.transportFor("https://idp/jwks"); transport != nil {
+		t.Errorf("transportFor() = %v, want the default transport", transport)
+	}
+
+	_, err := NewJWKSTransports(&appConfig.Auth{JWKSTLS: appConfig.TLS{MinVersion: "1.4"}, Providers: map[string]appConfig.AuthProvider{"mock": {}}}, nil)
+	if err == nil {
+		t.Error("NewJWKSTransports() with invalid TLS options should fail")
+	}
+}
@@ -0,0 +1,158 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"tweek-gateway/audit"
+
+	"github.com/urfave/negroni"
+)
+
+// ListingsFilterMiddleware removes the keys the subject isn't allowed to read under `repo/keys/<path>`,
+// from the responses of authoring listings: all the manifests, search, suggestions and dependents.
+// Search results are trimmed by the authoring service before filtering, so fewer results than requested may be returned.
+// The search index can't be filtered, so it is denied, and clients should use search instead
+func ListingsFilterMiddleware(authorizer Authorizer, auditor audit.Auditor) negroni.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		user, ok := r.Context().Value(UserInfoKey).(UserInfo)
+		if ok && user.Issuer() == "tweek" {
+			next(rw, r)
+			return
+		}
+		auditor := requestAuditor(r.Context(), auditor)
+		if isSearchIndex(r) {
+			subject := "unknown"
+			if ok {
+				subject = user.Sub().String()
+			}
+			auditor.Denied(subject, fmt.Sprintf("%q", r.URL.Path), "read")
+			http.Error(rw, "The search index isn't available when listings are filtered, use search instead", http.StatusForbidden)
+			return
+		}
+
+		filter := listingFilter(r)
+		if filter == nil || !ok {
+			next(rw, r)
+			return
+		}
+
+		keys := &keysAuthorizer{ctx: r.Context(), authorizer: authorizer, auditor: auditor, user: user, allowed: map[string]bool{}}
+		filterResponse(rw, r, next, func(body []byte, _ http.Header) ([]byte, error) {
+			filtered, err := filter(body, keys.isAllowed)
+			if err == nil && keys.filtered > 0 {
+				auditor.Filtered(user.Sub().String(), fmt.Sprintf("%q", r.URL.Path), "read", keys.filtered)
+			}
+			return filtered, err
+		})
+	}
+}
+
+func isSearchIndex(r *http.Request) bool {
+	return strings.TrimSuffix(r.URL.EscapedPath(), "/") == "/api/v2/search-index"
+}
+
+type listingFilterFunc func(body []byte, isAllowed func(keyPath string) bool) ([]byte, error)
+
+// listingFilter returns the filter of the listing response of a request, or nil for other requests
+func listingFilter(r *http.Request) listingFilterFunc {
+	if r.Method != http.MethodGet {
+		return nil
+	}
+	path := strings.TrimSuffix(r.URL.EscapedPath(), "/")
+	switch {
+	case path == "/api/v2/manifests" && len(r.URL.Query().Get("keyPath")) == 0:
+		return filterManifests
+	case path == "/api/v2/search" || path == "/api/v2/suggestions":
+		return filterKeyPaths
+	case strings.HasPrefix(path, "/api/v2/dependents"):
+		return filterDependents
+	}
+	return nil
+}
+
+// filterManifests filters an array of manifests by their key path
+func filterManifests(body []byte, isAllowed func(keyPath string) bool) ([]byte, error) {
+	var manifests []json.RawMessage
+	if err := json.Unmarshal(body, &manifests); err != nil {
+		return nil, fmt.Errorf("Invalid manifests response: %v", err)
+	}
+
+	result := []json.RawMessage{}
+	for _, manifest := range manifests {
+		var key struct {
+			KeyPath string `json:"key_path"`
+		}
+		if err := json.Unmarshal(manifest, &key); err != nil {
+			return nil, fmt.Errorf("Invalid manifest: %v", err)
+		}
+		if isAllowed(key.KeyPath) {
+			result = append(result, manifest)
+		}
+	}
+	return json.Marshal(result)
+}
+
+// filterKeyPaths filters an array of key paths
+func filterKeyPaths(body []byte, isAllowed func(keyPath string) bool) ([]byte, error) {
+	var keyPaths []string
+	if err := json.Unmarshal(body, &keyPaths); err != nil {
+		return nil, fmt.Errorf("Invalid key paths response: %v", err)
+	}
+	return json.Marshal(allowedKeyPaths(keyPaths, isAllowed))
+}
+
+// filterDependents filters the arrays of key paths which depend on a key
+func filterDependents(body []byte, isAllowed func(keyPath string) bool) ([]byte, error) {
+	var dependents map[string][]string
+	if err := json.Unmarshal(body, &dependents); err != nil {
+		return nil, fmt.Errorf("Invalid dependents response: %v", err)
+	}
+	for kind, keyPaths := range dependents {
+		dependents[kind] = allowedKeyPaths(keyPaths, isAllowed)
+	}
+	return json.Marshal(dependents)
+}
+
+func allowedKeyPaths(keyPaths []string, isAllowed func(keyPath string) bool) []string {
+	result := []string{}
+	for _, keyPath := range keyPaths {
+		if isAllowed(keyPath) {
+			result = append(result, keyPath)
+		}
+	}
+	return result
+}
+
+// keysAuthorizer authorizes reading keys of a request once per key, and counts the filtered ones
+type keysAuthorizer struct {
+	ctx        context.Context
+	authorizer Authorizer
+	auditor    audit.Auditor
+	user       UserInfo
+	allowed    map[string]bool
+	filtered   int
+}
+
+func (k *keysAuthorizer) isAllowed(keyPath string) bool {
+	allowed, ok := k.allowed[keyPath]
+	if !ok {
+		escaped, err := EscapeKeyPath(strings.Trim(keyPath, "/"))
+		if err == nil {
+			object := PolicyResource{Item: "repo/keys/" + escaped, Contexts: map[string][]string{}}
+			allowed, err = k.authorizer.Authorize(k.ctx, k.user.Sub(), object, "read")
+			if err != nil {
+				k.auditor.AuthorizerError(k.user.Sub().String(), fmt.Sprintf("%q", object), "read", err)
+				allowed = false
+			}
+		}
+		k.allowed[keyPath] = allowed
+	}
+	if !allowed {
+		k.filtered++
+	}
+	return allowed
+}
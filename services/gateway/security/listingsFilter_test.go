@@ -0,0 +1,65 @@
+package security
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListingsFilterMiddleware(t *testing.T) {
+	authorizer := funcAuthorizer(func(object PolicyResource) bool {
+		return strings.HasPrefix(object.Item, "repo/keys/team/")
+	})
+	responses := map[string]string{
+		"/api/v2/manifests":            `[{"key_path":"team/a","meta":{}},{"key_path":"other/b"}]`,
+		"/api/v2/search":               `["other/b","team/a"]`,
+		"/api/v2/suggestions":          `["team/a","other/b"]`,
+		"/api/v2/dependents/team/a":    `{"usedBy":["other/b","team/c"],"aliases":["other/d"]}`,
+		"/api/v2/schemas":              `["other/b"]`,
+		"/api/v2/manifests?keyPath=ab": `{"key_path":"other/b"}`,
+		"/api/v2/search-index":         `{"index":{"other/b":{}}}`,
+	}
+	upstream := func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(responses[r.URL.RequestURI()]))
+	}
+
+	tests := []struct {
+		path         string
+		issuer       string
+		want         string
+		wantFiltered int
+		wantDenied   bool
+	}{
+		{path: "/api/v2/manifests", want: `[{"key_path":"team/a","meta":{}}]`, wantFiltered: 1},
+		{path: "/api/v2/search", want: `["team/a"]`, wantFiltered: 1},
+		{path: "/api/v2/suggestions", want: `["team/a"]`, wantFiltered: 1},
+		{path: "/api/v2/dependents/team/a", want: `{"aliases":[],"usedBy":["team/c"]}`, wantFiltered: 2},
+		{path: "/api/v2/schemas", want: `["other/b"]`},
+		{path: "/api/v2/manifests?keyPath=ab", want: `{"key_path":"other/b"}`},
+		{path: "/api/v2/search-index", want: "The search index isn't available when listings are filtered, use search instead\n", wantDenied: true},
+		{path: "/api/v2/search-index", issuer: "tweek", want: `{"index":{"other/b":{}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			auditor := &countingAuditor{}
+			recorder := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", tt.path, nil)
+			info := &userInfo{sub: &Subject{User: "alice", Group: "default"}, issuer: tt.issuer}
+			r = r.WithContext(context.WithValue(r.Context(), UserInfoKey, info))
+
+			ListingsFilterMiddleware(authorizer, auditor)(recorder, r, upstream)
+
+			if got := recorder.Body.String(); got != tt.want {
+				t.Errorf("Body = %v, want %v", got, tt.want)
+			}
+			if auditor.filtered != tt.wantFiltered {
+				t.Errorf("Filtered = %v, want %v", auditor.filtered, tt.wantFiltered)
+			}
+			if denied := recorder.Code == http.StatusForbidden; denied != tt.wantDenied || auditor.denied != tt.wantDenied {
+				t.Errorf("Status = %v, audited denied %v, want denied %v", recorder.Code, auditor.denied, tt.wantDenied)
+			}
+		})
+	}
+}
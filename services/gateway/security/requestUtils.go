@@ -8,10 +8,27 @@ import (
 	"strings"
 )
 
-// PolicyResource describes policy resource with item and associated tweek contexts
+// PolicyResource describes policy resource with item and associated tweek contexts.
+// Contexts holds all the identity ids requested for each identity type
 type PolicyResource struct {
 	Item     string
-	Contexts map[string]string
+	Contexts map[string][]string
+}
+
+// ErrInvalidKeyPath is returned for key paths with empty, `.` or `..` segments, which would resolve to other keys upstream
+var ErrInvalidKeyPath = errors.New("Key path must not have empty, . or .. segments")
+
+// EscapeKeyPath escapes each segment of the key path, for authorizing and requesting it as a path.
+// Key paths with dot or empty segments are rejected, so the authorized key is the one requested upstream
+func EscapeKeyPath(keyPath string) (string, error) {
+	segments := strings.Split(keyPath, "/")
+	for i, segment := range segments {
+		if len(segment) == 0 || segment == "." || segment == ".." {
+			return "", ErrInvalidKeyPath
+		}
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/"), nil
 }
 
 func extractActionFromRequest(r *http.Request) (act string, err error) {
@@ -59,6 +76,8 @@ func extractActionFromRequest(r *http.Request) (act string, err error) {
 	case r.Method == "GET" && strings.HasPrefix(uri.Path, "/api/v2/context"):
 		fallthrough
 	case r.Method == "GET" && strings.HasPrefix(uri.Path, "/api/v2/apps"):
+		fallthrough
+	case r.Method == "GET" && strings.HasPrefix(uri.Path, "/api/v2/watch"):
 		act = "read"
 		break
 	default:
@@ -77,34 +96,66 @@ const (
 func extractContextsFromValuesRequest(r *http.Request, u UserInfo) (ctxs PolicyResource, err error) {
 	uri := r.URL
 
-	ctxs = PolicyResource{Contexts: map[string]string{}}
+	ctxs = PolicyResource{Contexts: map[string][]string{}}
 	ctxs.Item = strings.Replace(uri.EscapedPath(), "/api/v2/values/", "values/", 1)
-	for key, value := range uri.Query() {
+	for key, values := range uri.Query() {
 		// checking for special chars - these are not context identity names
 		if !strings.ContainsAny(key, "$.") {
-			identityID := normalizeIdentityID(url.PathEscape(value[0]), u)
-			ctxs.Contexts[url.PathEscape(key)] = identityID
+			identityIDs := make([]string, len(values))
+			for i, value := range values {
+				identityIDs[i] = normalizeIdentityID(url.PathEscape(value), u)
+			}
+			ctxs.Contexts[url.PathEscape(key)] = identityIDs
 		}
 	}
 
 	return
 }
 
+// extractContextsFromWatchRequest authorizes watching like reading the values under the watched key path
+func extractContextsFromWatchRequest(r *http.Request) (ctxs PolicyResource, err error) {
+	ctxs = PolicyResource{Item: "values/_", Contexts: map[string][]string{}}
+	if keyPath := strings.Trim(r.URL.Query().Get("keyPath"), "/"); len(keyPath) > 0 {
+		escaped, err := EscapeKeyPath(keyPath)
+		if err != nil {
+			return PolicyResource{}, err
+		}
+		ctxs.Item = "values/" + escaped + "/_"
+	}
+	return
+}
+
 func extractContextsFromKeysRequest(r *http.Request, u UserInfo) (ctxs PolicyResource, err error) {
 	uri := r.URL
 
-	ctxs = PolicyResource{Contexts: map[string]string{}}
 	if r.Method == "GET" {
-		ctxs.Item = "repo"
-		return
+		return extractKeyPathResource(r, "/api/v2/keys")
 	}
+	ctxs = PolicyResource{Contexts: map[string][]string{}}
 	ctxs.Item = strings.Replace(uri.EscapedPath(), "/api/v2/keys/", "repo/keys/", 1)
 
 	return
 }
 
+// extractKeyPathResource authorizes reads of a key path, from the path after the prefix or the `keyPath` query parameter,
+// against the key itself. Reads without a key path are authorized against the whole repository
+func extractKeyPathResource(r *http.Request, prefix string) (PolicyResource, error) {
+	keyPath := strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), prefix), "/")
+	if query := strings.Trim(r.URL.Query().Get("keyPath"), "/"); len(keyPath) == 0 && len(query) > 0 {
+		var err error
+		if keyPath, err = EscapeKeyPath(query); err != nil {
+			return PolicyResource{}, err
+		}
+	}
+
+	if len(keyPath) == 0 {
+		return PolicyResource{Item: "repo", Contexts: map[string][]string{}}, nil
+	}
+	return PolicyResource{Item: "repo/keys/" + keyPath, Contexts: map[string][]string{}}, nil
+}
+
 func extractContextFromContextRequest(r *http.Request, u UserInfo) (ctx PolicyResource, err error) {
-	ctx = PolicyResource{Contexts: map[string]string{}}
+	ctx = PolicyResource{Contexts: map[string][]string{}}
 	path := r.URL.EscapedPath()
 
 	segments := strings.Split(strings.Replace(path, "/api/v2/context/", "", 1), "/")
@@ -121,9 +172,9 @@ func extractContextFromContextRequest(r *http.Request, u UserInfo) (ctx PolicyRe
 			prop = segments[contextProp]
 		}
 		ctx.Item = fmt.Sprintf("context/%v/%v", identityType, prop)
-		ctx.Contexts[identityType] = identityID
+		ctx.Contexts[identityType] = []string{identityID}
 	case "GET", "POST":
-		ctx.Contexts[identityType] = identityID
+		ctx.Contexts[identityType] = []string{identityID}
 		ctx.Item = fmt.Sprintf("context/%v/*", identityType)
 	default:
 		err = fmt.Errorf("ExtractContextFromContextRequest: unexpected method %v", method)
@@ -144,7 +195,7 @@ func normalizeIdentityID(id string, u UserInfo) string {
 }
 
 func extractResourceFromRepoRequest(r *http.Request, u UserInfo, kind string) (ctxs PolicyResource, err error) {
-	ctxs = PolicyResource{Contexts: map[string]string{}}
+	ctxs = PolicyResource{Contexts: map[string][]string{}}
 	switch {
 	case r.Method == "GET":
 		if kind != "hooks" {
@@ -171,29 +222,31 @@ func extractContextsFromRequest(r *http.Request, u UserInfo) (ctxs PolicyResourc
 	path := r.URL.EscapedPath()
 	switch {
 	case strings.HasPrefix(path, "/api/v2/manifests"):
-		fallthrough
-	case strings.HasPrefix(path, "/api/v2/suggestions"):
-		fallthrough
+		return extractKeyPathResource(r, "/api/v2/manifests")
 	case strings.HasPrefix(path, "/api/v2/dependents"):
+		return extractKeyPathResource(r, "/api/v2/dependents")
+	case strings.HasPrefix(path, "/api/v2/revision-history"):
+		return extractKeyPathResource(r, "/api/v2/revision-history")
+	case strings.HasPrefix(path, "/api/v2/suggestions"):
 		fallthrough
 	case strings.HasPrefix(path, "/api/v2/search"):
 		fallthrough
-	case strings.HasPrefix(path, "/api/v2/revision-history"):
-		fallthrough
 	case strings.HasPrefix(path, "/api/v2/search-index"):
-		ctxs = PolicyResource{Item: "repo", Contexts: map[string]string{}}
+		ctxs = PolicyResource{Item: "repo", Contexts: map[string][]string{}}
 		return
 	case strings.HasPrefix(path, "/api/v2/apps"):
-		ctxs = PolicyResource{Item: "repo/apps", Contexts: map[string]string{}}
+		ctxs = PolicyResource{Item: "repo/apps", Contexts: map[string][]string{}}
 		return
 	case strings.HasPrefix(path, "/api/v2/policies"):
 		fallthrough
 	case strings.HasPrefix(path, "/api/v2/jwt-extraction-policy"):
-		ctxs = PolicyResource{Item: "repo/policies", Contexts: map[string]string{}}
+		ctxs = PolicyResource{Item: "repo/policies", Contexts: map[string][]string{}}
 		return
 	case strings.HasPrefix(path, "/api/v2/bulk-keys-upload"):
-		ctxs = PolicyResource{Item: "repo/keys/_", Contexts: map[string]string{}}
+		ctxs = PolicyResource{Item: "repo/keys/_", Contexts: map[string][]string{}}
 		return
+	case strings.HasPrefix(path, "/api/v2/watch"):
+		return extractContextsFromWatchRequest(r)
 	case strings.HasPrefix(path, "/api/v2/context"):
 		return extractContextFromContextRequest(r, u)
 	case strings.HasPrefix(path, "/api/v2/values"):
@@ -224,13 +277,13 @@ func ExtractFromRequest(r *http.Request) (sub *Subject, act string, obj PolicyRe
 	act, err = extractActionFromRequest(r)
 	if err != nil {
 		fullErr := fmt.Errorf("Couldn't extract action from request: %v", err)
-		return &Subject{}, "", PolicyResource{Contexts: map[string]string{}}, fullErr
+		return &Subject{}, "", PolicyResource{Contexts: map[string][]string{}}, fullErr
 	}
 
 	obj, err = extractContextsFromRequest(r, user)
 	if err != nil {
 		fullErr := fmt.Errorf("Couldn't extract action from request: %v", err)
-		return &Subject{}, "", PolicyResource{Contexts: map[string]string{}}, fullErr
+		return &Subject{}, "", PolicyResource{Contexts: map[string][]string{}}, fullErr
 	}
 
 	err = nil
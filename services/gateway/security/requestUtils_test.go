@@ -32,7 +32,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/keys", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -42,7 +42,57 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/keys/some/key", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/keys/some/key", Contexts: map[string][]string{}},
+			wantSub: &Subject{User: "A b sub", Group: "default"},
+			wantAct: "read",
+			wantErr: nil,
+		},
+		{
+			name: "Read some key request by key path parameter",
+			args: args{
+				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/keys?keyPath=/some/key", userInfo),
+			},
+			wantObj: PolicyResource{Item: "repo/keys/some/key", Contexts: map[string][]string{}},
+			wantSub: &Subject{User: "A b sub", Group: "default"},
+			wantAct: "read",
+			wantErr: nil,
+		},
+		{
+			name: "Manifest request",
+			args: args{
+				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/manifests/some/key", userInfo),
+			},
+			wantObj: PolicyResource{Item: "repo/keys/some/key", Contexts: map[string][]string{}},
+			wantSub: &Subject{User: "A b sub", Group: "default"},
+			wantAct: "read",
+			wantErr: nil,
+		},
+		{
+			name: "All manifests request",
+			args: args{
+				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/manifests", userInfo),
+			},
+			wantObj: PolicyResource{Item: "repo", Contexts: map[string][]string{}},
+			wantSub: &Subject{User: "A b sub", Group: "default"},
+			wantAct: "read",
+			wantErr: nil,
+		},
+		{
+			name: "Dependents request",
+			args: args{
+				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/dependents/some/key", userInfo),
+			},
+			wantObj: PolicyResource{Item: "repo/keys/some/key", Contexts: map[string][]string{}},
+			wantSub: &Subject{User: "A b sub", Group: "default"},
+			wantAct: "read",
+			wantErr: nil,
+		},
+		{
+			name: "Key history request",
+			args: args{
+				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/revision-history/some/key?since=1", userInfo),
+			},
+			wantObj: PolicyResource{Item: "repo/keys/some/key", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -52,7 +102,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("POST", "https://gateway.tweek.com/api/v2/keys/key1", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/keys/key1", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/keys/key1", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "write",
 			wantErr: nil,
@@ -62,7 +112,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/values/value1", userInfo),
 			},
-			wantObj: PolicyResource{Item: "values/value1", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "values/value1", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -72,7 +122,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/revision-history", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -82,7 +132,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/search-index", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -92,7 +142,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/tags", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -102,7 +152,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/context/some_user/some_id", userInfo),
 			},
-			wantObj: PolicyResource{Item: "context/some_user/*", Contexts: map[string]string{"some_user": "some_id"}},
+			wantObj: PolicyResource{Item: "context/some_user/*", Contexts: map[string][]string{"some_user": {"some_id"}}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -112,7 +162,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/apps", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -122,7 +172,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/apps/some_app_id", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -132,7 +182,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("POST", "https://gateway.tweek.com/api/v2/apps", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "write",
 			wantErr: nil,
@@ -142,7 +192,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("DELETE", "https://gateway.tweek.com/api/v2/apps/some_app_id", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "write",
 			wantErr: nil,
@@ -152,7 +202,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/apps/some_app_id/keys", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -162,7 +212,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/apps/some_app_id/keys/some_key_id", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -172,7 +222,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("POST", "https://gateway.tweek.com/api/v2/apps/some_app_id/keys", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "write",
 			wantErr: nil,
@@ -182,7 +232,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("DELETE", "https://gateway.tweek.com/api/v2/apps/some_app_id/keys/some_key_id", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/apps", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "write",
 			wantErr: nil,
@@ -192,7 +242,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/policies", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/policies", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/policies", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -202,7 +252,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/jwt-extraction-policy", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/policies", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/policies", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -212,7 +262,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("PUT", "https://gateway.tweek.com/api/v2/bulk-keys-upload", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/keys/_", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/keys/_", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "write",
 			wantErr: nil,
@@ -222,7 +272,7 @@ func TestExtractFromRequest(t *testing.T) {
 			args: args{
 				r: createTestRequest("GET", "https://gateway.tweek.com/api/v2/hooks", userInfo),
 			},
-			wantObj: PolicyResource{Item: "repo/hooks", Contexts: map[string]string{}},
+			wantObj: PolicyResource{Item: "repo/hooks", Contexts: map[string][]string{}},
 			wantSub: &Subject{User: "A b sub", Group: "default"},
 			wantAct: "read",
 			wantErr: nil,
@@ -234,7 +284,7 @@ func TestExtractFromRequest(t *testing.T) {
 			if !reflect.DeepEqual(gotObj, tt.wantObj) {
 				t.Errorf("ExtractFromRequest() gotObj = %q, want %q", gotObj, tt.wantObj)
 			}
-			if *gotSub != *tt.wantSub {
+			if !reflect.DeepEqual(gotSub, tt.wantSub) {
 				t.Errorf("ExtractFromRequest() gotSub = %q, want %q", gotSub, tt.wantSub)
 			}
 			if gotAct != tt.wantAct {
@@ -268,7 +318,7 @@ func Test_extractContextsFromRequest(t *testing.T) {
 			args: args{
 				r: createRequest("POST", "/api/v2/schemas/device", "alice", "default"),
 			},
-			wantCtxs: PolicyResource{Item: "repo/schemas", Contexts: map[string]string{}},
+			wantCtxs: PolicyResource{Item: "repo/schemas", Contexts: map[string][]string{}},
 			wantErr:  false,
 		},
 		{
@@ -276,7 +326,7 @@ func Test_extractContextsFromRequest(t *testing.T) {
 			args: args{
 				r: createRequest("GET", "/api/v2/values/key1?user=alice", "alice", "default"),
 			},
-			wantCtxs: PolicyResource{Item: "values/key1", Contexts: map[string]string{"user": "self"}},
+			wantCtxs: PolicyResource{Item: "values/key1", Contexts: map[string][]string{"user": {"self"}}},
 			wantErr:  false,
 		},
 		{
@@ -284,7 +334,23 @@ func Test_extractContextsFromRequest(t *testing.T) {
 			args: args{
 				r: createRequest("GET", "/api/v2/values/key1?user=alice&device=1234", "alice", "default"),
 			},
-			wantCtxs: PolicyResource{Item: "values/key1", Contexts: map[string]string{"user": "self", "device": "1234"}},
+			wantCtxs: PolicyResource{Item: "values/key1", Contexts: map[string][]string{"user": {"self"}, "device": {"1234"}}},
+			wantErr:  false,
+		},
+		{
+			name: "Contexts for values request, with repeated identity",
+			args: args{
+				r: createRequest("GET", "/api/v2/values/key1?user=alice&user=bob&device=1234", "alice", "default"),
+			},
+			wantCtxs: PolicyResource{Item: "values/key1", Contexts: map[string][]string{"user": {"self", "bob"}, "device": {"1234"}}},
+			wantErr:  false,
+		},
+		{
+			name: "Contexts for values request, with escaped identity values",
+			args: args{
+				r: createRequest("GET", "/api/v2/values/key1?device=a%2Fb&device=c", "alice", "default"),
+			},
+			wantCtxs: PolicyResource{Item: "values/key1", Contexts: map[string][]string{"device": {"a%2Fb", "c"}}},
 			wantErr:  false,
 		},
 		{
@@ -292,7 +358,7 @@ func Test_extractContextsFromRequest(t *testing.T) {
 			args: args{
 				r: createRequest("GET", "/api/v2/context/user/alice", "alice", "default"),
 			},
-			wantCtxs: PolicyResource{Contexts: map[string]string{"user": "self"}, Item: "context/user/*"},
+			wantCtxs: PolicyResource{Contexts: map[string][]string{"user": {"self"}}, Item: "context/user/*"},
 			wantErr:  false,
 		},
 		{
@@ -300,7 +366,7 @@ func Test_extractContextsFromRequest(t *testing.T) {
 			args: args{
 				r: createRequest("POST", "/api/v2/context/user/alice", "alice", "default"),
 			},
-			wantCtxs: PolicyResource{Contexts: map[string]string{"user": "self"}, Item: "context/user/*"},
+			wantCtxs: PolicyResource{Contexts: map[string][]string{"user": {"self"}}, Item: "context/user/*"},
 			wantErr:  false,
 		},
 		{
@@ -308,7 +374,7 @@ func Test_extractContextsFromRequest(t *testing.T) {
 			args: args{
 				r: createRequest("DELETE", "/api/v2/context/user/alice", "alice", "default"),
 			},
-			wantCtxs: PolicyResource{Contexts: map[string]string{"user": "self"}, Item: "context/user/*"},
+			wantCtxs: PolicyResource{Contexts: map[string][]string{"user": {"self"}}, Item: "context/user/*"},
 			wantErr:  false,
 		},
 		{
@@ -316,9 +382,41 @@ func Test_extractContextsFromRequest(t *testing.T) {
 			args: args{
 				r: createRequest("DELETE", "/api/v2/context/user/alice/property", "alice", "default"),
 			},
-			wantCtxs: PolicyResource{Contexts: map[string]string{"user": "self"}, Item: "context/user/property"},
+			wantCtxs: PolicyResource{Contexts: map[string][]string{"user": {"self"}}, Item: "context/user/property"},
+			wantErr:  false,
+		},
+		{
+			name: "Watch all values",
+			args: args{
+				r: createRequest("GET", "/api/v2/watch", "alice", "default"),
+			},
+			wantCtxs: PolicyResource{Item: "values/_", Contexts: map[string][]string{}},
+			wantErr:  false,
+		},
+		{
+			name: "Watch values under key path",
+			args: args{
+				r: createRequest("GET", "/api/v2/watch?keyPath=/path/to/", "alice", "default"),
+			},
+			wantCtxs: PolicyResource{Item: "values/path/to/_", Contexts: map[string][]string{}},
 			wantErr:  false,
 		},
+		{
+			name: "Watch values under key path with dot segments",
+			args: args{
+				r: createRequest("GET", "/api/v2/watch?keyPath=path/../secret", "alice", "default"),
+			},
+			wantCtxs: PolicyResource{},
+			wantErr:  true,
+		},
+		{
+			name: "Manifest by key path parameter with dot segments",
+			args: args{
+				r: createRequest("GET", "/api/v2/manifests?keyPath=allowed/../secret", "alice", "default"),
+			},
+			wantCtxs: PolicyResource{},
+			wantErr:  true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -335,3 +433,25 @@ func Test_extractContextsFromRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestEscapeKeyPath(t *testing.T) {
+	tests := []struct {
+		keyPath string
+		want    string
+		wantErr bool
+	}{
+		{keyPath: "some/key", want: "some/key"},
+		{keyPath: "some/key with spaces/_", want: "some/key%20with%20spaces/_"},
+		{keyPath: "some/../key", wantErr: true},
+		{keyPath: "./key", wantErr: true},
+		{keyPath: "some//key", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keyPath, func(t *testing.T) {
+			got, err := EscapeKeyPath(tt.keyPath)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("EscapeKeyPath() = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package security
+
+import (
+	"net/http"
+
+	"tweek-gateway/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// filterResponse serves the request with next, and replaces the body of successful responses with the result of filter,
+// which may also update the headers of the response. Bodies of failed responses can't be filtered, so only their status is returned
+func filterResponse(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc, filter func(body []byte, header http.Header) ([]byte, error)) {
+	// Responses are parsed, so they shouldn't be compressed
+	r.Header.Del("Accept-Encoding")
+
+	buffer := utils.NewResponseBuffer()
+	next(buffer, r)
+
+	if !buffer.Success() {
+		http.Error(rw, http.StatusText(buffer.Code()), buffer.Code())
+		return
+	}
+
+	body, err := filter(buffer.Body(), buffer.Header())
+	if err == errForbidden {
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("path", r.URL.Path).Error("Failed to filter response")
+		http.Error(rw, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	for key, values := range buffer.Header() {
+		rw.Header()[key] = values
+	}
+	rw.Header().Del("Content-Length")
+	rw.WriteHeader(buffer.Code())
+	rw.Write(body)
+}
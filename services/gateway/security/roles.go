@@ -0,0 +1,159 @@
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Role is a named set of grants, which also has the grants of the roles it inherits
+type Role struct {
+	Inherits []string    `json:"inherits"`
+	Grants   []RoleGrant `json:"grants"`
+}
+
+// RoleGrant allows (or denies) an action on an object, like a policy without the subject
+type RoleGrant struct {
+	Object string `json:"object"`
+	Action string `json:"action"`
+	Effect string `json:"effect"`
+	Validity
+}
+
+// Validity bounds a policy or a grant in time, by RFC3339 timestamps
+type Validity struct {
+	NotBefore string `json:"notBefore"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+func (v *Validity) validate() error {
+	var notBefore, expiresAt time.Time
+	var err error
+	if len(v.NotBefore) > 0 {
+		if notBefore, err = time.Parse(time.RFC3339, v.NotBefore); err != nil {
+			return fmt.Errorf("invalid notBefore %q", v.NotBefore)
+		}
+	}
+	if len(v.ExpiresAt) > 0 {
+		if expiresAt, err = time.Parse(time.RFC3339, v.ExpiresAt); err != nil {
+			return fmt.Errorf("invalid expiresAt %q", v.ExpiresAt)
+		}
+	}
+	if !notBefore.IsZero() && !expiresAt.IsZero() && !notBefore.Before(expiresAt) {
+		return fmt.Errorf("notBefore %q must be before expiresAt %q", v.NotBefore, v.ExpiresAt)
+	}
+	return nil
+}
+
+// RoleBinding binds the users and groups which match it to a role
+type RoleBinding struct {
+	User  string `json:"user"`
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+type rolesData struct {
+	Policies []Validity      `json:"policies"`
+	Roles    map[string]Role `json:"roles"`
+	Bindings []RoleBinding   `json:"bindings"`
+}
+
+// ValidatePolicy checks the roles and bindings of the policy data: grants must have an object and an action,
+// inherited and bound roles must exist, and roles must not inherit themselves.
+// The validity of policies and grants must be valid timestamps
+func ValidatePolicy(data []byte) error {
+	var policy rolesData
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("Invalid policy: %v", err)
+	}
+
+	for i, validity := range policy.Policies {
+		if err := validity.validate(); err != nil {
+			return fmt.Errorf("policies[%d]: %v", i, err)
+		}
+	}
+
+	names := make([]string, 0, len(policy.Roles))
+	for name := range policy.Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		role := policy.Roles[name]
+		for i, grant := range role.Grants {
+			if len(grant.Object) == 0 || len(grant.Action) == 0 {
+				return fmt.Errorf("Role %s: grants[%d] requires object and action", name, i)
+			}
+			if len(grant.Effect) > 0 && grant.Effect != "allow" && grant.Effect != "deny" {
+				return fmt.Errorf("Role %s: grants[%d] has unknown effect %q", name, i, grant.Effect)
+			}
+			if err := grant.validate(); err != nil {
+				return fmt.Errorf("Role %s: grants[%d]: %v", name, i, err)
+			}
+		}
+		for _, inherited := range role.Inherits {
+			if _, ok := policy.Roles[inherited]; !ok {
+				return fmt.Errorf("Role %s inherits unknown role %s", name, inherited)
+			}
+		}
+	}
+
+	for i, binding := range policy.Bindings {
+		if _, ok := policy.Roles[binding.Role]; !ok {
+			return fmt.Errorf("bindings[%d] binds unknown role %q", i, binding.Role)
+		}
+		if len(binding.User) == 0 && len(binding.Group) == 0 {
+			return fmt.Errorf("bindings[%d] requires user or group", i)
+		}
+	}
+
+	if cycle := findRoleCycle(policy.Roles, names); cycle != nil {
+		return fmt.Errorf("Roles inherit in a cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// findRoleCycle returns the roles of an inheritance cycle, starting and ending with the same role, or nil if there is none
+func findRoleCycle(roles map[string]Role, names []string) []string {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, role := range path {
+				if role == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, inherited := range roles[name].Inherits {
+			if cycle := visit(inherited); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
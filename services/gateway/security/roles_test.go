@@ -0,0 +1,88 @@
+package security
+
+import (
+	"testing"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "No roles",
+			data: `{"policies":[]}`,
+		},
+		{
+			name: "Valid roles",
+			data: `{
+				"roles": {
+					"reader": {"grants": [{"object": "repo", "action": "read"}]},
+					"editor": {"inherits": ["reader"], "grants": [{"object": "repo/keys/*", "action": "write"}]},
+					"lead": {"inherits": ["editor", "reader"]}
+				},
+				"bindings": [{"group": "editors", "role": "editor"}]
+			}`,
+		},
+		{
+			name:    "Cycle",
+			data:    `{"roles": {"a": {"inherits": ["b"]}, "b": {"inherits": ["c"]}, "c": {"inherits": ["a"]}, "d": {"inherits": ["a"]}}}`,
+			wantErr: "Roles inherit in a cycle: a -> b -> c -> a",
+		},
+		{
+			name:    "Self inheritance",
+			data:    `{"roles": {"a": {"inherits": ["a"]}}}`,
+			wantErr: "Roles inherit in a cycle: a -> a",
+		},
+		{
+			name:    "Unknown inherited role",
+			data:    `{"roles": {"a": {"inherits": ["b"]}}}`,
+			wantErr: "Role a inherits unknown role b",
+		},
+		{
+			name:    "Unknown bound role",
+			data:    `{"roles": {}, "bindings": [{"user": "alice", "role": "admin"}]}`,
+			wantErr: `bindings[0] binds unknown role "admin"`,
+		},
+		{
+			name:    "Binding without subject",
+			data:    `{"roles": {"a": {}}, "bindings": [{"role": "a"}]}`,
+			wantErr: "bindings[0] requires user or group",
+		},
+		{
+			name: "Valid validity",
+			data: `{"policies": [{"notBefore": "2021-06-01T00:00:00Z", "expiresAt": "2021-07-01T00:00:00+03:00"}, {}]}`,
+		},
+		{
+			name:    "Invalid policy validity",
+			data:    `{"policies": [{}, {"expiresAt": "tomorrow"}]}`,
+			wantErr: `policies[1]: invalid expiresAt "tomorrow"`,
+		},
+		{
+			name:    "Expiring before valid",
+			data:    `{"roles": {"a": {"grants": [{"object": "repo", "action": "read", "notBefore": "2021-07-01T00:00:00Z", "expiresAt": "2021-06-01T00:00:00Z"}]}}}`,
+			wantErr: `Role a: grants[0]: notBefore "2021-07-01T00:00:00Z" must be before expiresAt "2021-06-01T00:00:00Z"`,
+		},
+		{
+			name:    "Grant without action",
+			data:    `{"roles": {"a": {"grants": [{"object": "repo"}]}}}`,
+			wantErr: "Role a: grants[0] requires object and action",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePolicy([]byte(tt.data))
+			if got := errorString(err); got != tt.wantErr {
+				t.Errorf("ValidatePolicy() error = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
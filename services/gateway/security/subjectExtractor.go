@@ -57,7 +57,8 @@ func NewDefaultSubjectExtractor(rules, pkg, query string) *DefaultSubjectExtract
 	}
 }
 
-// ExtractSubject extracts user and group from JWT claims in the form of `group:user`
+// ExtractSubject extracts user and group from JWT claims in the form of `group:user`.
+// The rules may produce a list of `groups` instead of or in addition to the `group`, which is then the primary group
 func (e *DefaultSubjectExtractor) ExtractSubject(ctx context.Context, claims jwt.MapClaims) (*Subject, error) {
 	rego := e.partialResult.Rego(
 		rego.Input(claims),
@@ -72,19 +73,99 @@ func (e *DefaultSubjectExtractor) ExtractSubject(ctx context.Context, claims jwt
 
 	value := result[0].Expressions[0].Value.(map[string]interface{})
 
-	group, ok := value["group"]
-	if !ok {
-		return &Subject{}, fmt.Errorf("Expected rego rules to produce group, but got %v", value)
+	groups, err := extractGroups(value)
+	if err != nil {
+		return &Subject{}, err
 	}
 	user, ok := value["user"]
 	if !ok {
 		return &Subject{}, fmt.Errorf("Expected rego rules to produce user, but got %v", value)
 	}
-	if group == nil || user == nil {
+	if len(groups) == 0 || user == nil {
 		return &Subject{}, fmt.Errorf("Expected rego rules to produce non nil user and group")
 	}
 
-	return &Subject{User: user.(string), Group: group.(string)}, nil
+	return &Subject{User: user.(string), Group: groups[0], Groups: groups}, nil
+}
+
+// extractGroups returns the group and the groups produced by the rules, without duplicates
+func extractGroups(value map[string]interface{}) ([]string, error) {
+	group, hasGroup := value["group"]
+	list, hasGroups := value["groups"]
+	if !hasGroup && !hasGroups {
+		return nil, fmt.Errorf("Expected rego rules to produce group, but got %v", value)
+	}
+
+	var groups []string
+	add := func(item interface{}) error {
+		name, ok := item.(string)
+		if !ok {
+			return fmt.Errorf("Expected rego rules to produce string groups, but got %v", item)
+		}
+		for _, existing := range groups {
+			if existing == name {
+				return nil
+			}
+		}
+		groups = append(groups, name)
+		return nil
+	}
+
+	if group != nil {
+		if err := add(group); err != nil {
+			return nil, err
+		}
+	}
+	if list != nil {
+		items, ok := list.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Expected rego rules to produce a list of groups, but got %v", list)
+		}
+		for _, item := range items {
+			if err := add(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return groups, nil
+}
+
+// IssuerSubjectExtractor extracts subjects with the rules of the token's issuer, falling back to the global rules
+type IssuerSubjectExtractor struct {
+	fallback SubjectExtractor
+	issuers  map[string]SubjectExtractor
+}
+
+// NewIssuerSubjectExtractor creates an extractor, which dispatches to the extractors of issuers by the verified `iss` claim
+func NewIssuerSubjectExtractor(fallback SubjectExtractor, issuers map[string]SubjectExtractor) *IssuerSubjectExtractor {
+	return &IssuerSubjectExtractor{
+		fallback: fallback,
+		issuers:  issuers,
+	}
+}
+
+// ExtractSubject implements extraction for IssuerSubjectExtractor
+func (e *IssuerSubjectExtractor) ExtractSubject(ctx context.Context, claims jwt.MapClaims) (*Subject, error) {
+	if issuer, ok := claims["iss"].(string); ok {
+		if extractor, ok := e.issuers[issuer]; ok {
+			return extractor.ExtractSubject(ctx, claims)
+		}
+	}
+	return e.fallback.ExtractSubject(ctx, claims)
+}
+
+// Fallback returns the extractor of the global rules
+func (e *IssuerSubjectExtractor) Fallback() SubjectExtractor {
+	return e.fallback
+}
+
+// ForIssuer returns the extractor of the issuer's own rules
+func (e *IssuerSubjectExtractor) ForIssuer(issuer string) (SubjectExtractor, bool) {
+	if e == nil {
+		return nil, false
+	}
+	extractor, ok := e.issuers[issuer]
+	return extractor, ok
 }
 
 // NewSynchronizedSubjectExtractor creates new synchronized user and group extractor
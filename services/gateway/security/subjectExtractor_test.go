@@ -3,6 +3,7 @@ package security
 import (
 	"context"
 	"io/ioutil"
+	"reflect"
 	"testing"
 
 	jwt "github.com/dgrijalva/jwt-go"
@@ -26,7 +27,7 @@ func TestDefaultSubjectExtractor_ExtractSubject(t *testing.T) {
 					"sub": "test",
 				},
 			},
-			want:    &Subject{User: "test", Group: "google"},
+			want:    &Subject{User: "test", Group: "google", Groups: []string{"google"}},
 			wantErr: false,
 		},
 		{
@@ -37,9 +38,45 @@ func TestDefaultSubjectExtractor_ExtractSubject(t *testing.T) {
 					"sub": "test",
 				},
 			},
-			want:    &Subject{User: "test", Group: "azure"},
+			want:    &Subject{User: "test", Group: "azure", Groups: []string{"azure"}},
 			wantErr: false,
 		},
+		{
+			name: "Groups",
+			args: args{
+				claims: jwt.MapClaims{
+					"iss":    "https://idp.example.com",
+					"sub":    "test",
+					"groups": []interface{}{"editors", "readers"},
+				},
+			},
+			want:    &Subject{User: "test", Group: "editors", Groups: []string{"editors", "readers"}},
+			wantErr: false,
+		},
+		{
+			name: "Group and roles",
+			args: args{
+				claims: jwt.MapClaims{
+					"iss":   "https://roles.example.com",
+					"sub":   "test",
+					"roles": []interface{}{"admin", "employees"},
+				},
+			},
+			want:    &Subject{User: "test", Group: "employees", Groups: []string{"employees", "admin"}},
+			wantErr: false,
+		},
+		{
+			name: "No groups",
+			args: args{
+				claims: jwt.MapClaims{
+					"iss":    "https://idp.example.com",
+					"sub":    "test",
+					"groups": []interface{}{},
+				},
+			},
+			want:    &Subject{},
+			wantErr: true,
+		},
 		{
 			name: "Nothing",
 			args: args{
@@ -63,9 +100,59 @@ func TestDefaultSubjectExtractor_ExtractSubject(t *testing.T) {
 				t.Errorf("DefaultSubjectExtractor.ExtractSubject() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if *got != *tt.want {
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("DefaultSubjectExtractor.ExtractSubject() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestIssuerSubjectExtractor_ExtractSubject(t *testing.T) {
+	rules, err := ioutil.ReadFile("./testdata/subject_extraction_rules.rego")
+	if err != nil {
+		t.Fatal("Unable to read rules file")
+	}
+	providerRules := `package rules
+
+subject = { "user": input.oid, "group": "partners" } {
+    input.tid = "partner-tenant"
+}`
+	extractor := NewIssuerSubjectExtractor(
+		NewDefaultSubjectExtractor(string(rules), "rules", "subject"),
+		map[string]SubjectExtractor{"https://partners.example.com": NewDefaultSubjectExtractor(providerRules, "rules", "subject")},
+	)
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		want    *Subject
+		wantErr bool
+	}{
+		{
+			name:   "Provider rules",
+			claims: jwt.MapClaims{"iss": "https://partners.example.com", "oid": "test", "tid": "partner-tenant"},
+			want:   &Subject{User: "test", Group: "partners", Groups: []string{"partners"}},
+		},
+		{
+			name:    "Provider rules don't match",
+			claims:  jwt.MapClaims{"iss": "https://partners.example.com", "sub": "test"},
+			wantErr: true,
+		},
+		{
+			name:   "Global rules",
+			claims: jwt.MapClaims{"iss": "https://accounts.google.com", "sub": "test"},
+			want:   &Subject{User: "test", Group: "google", Groups: []string{"google"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractor.ExtractSubject(context.Background(), tt.claims)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IssuerSubjectExtractor.ExtractSubject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IssuerSubjectExtractor.ExtractSubject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,4 +6,8 @@ subject = { "user": input.sub, "group": "google" } {
     input.iss = "https://accounts.google.com"
 } else = { "user": input.sub, "group": "azure" } {
     input.iss = "https://login.microsoftonline.com/11111111-1111-1111-1111-111111111111"
-} 
+} else = { "user": input.sub, "groups": input.groups } {
+    input.iss = "https://idp.example.com"
+} else = { "user": input.sub, "group": "employees", "groups": input.roles } {
+    input.iss = "https://roles.example.com"
+}
@@ -19,10 +19,11 @@ func NewUserInfoHandler(configuration *appConfig.Security, extractor SubjectExtr
 		}
 
 		jsonUserInfo, err := json.Marshal(map[string]interface{}{
-			"User":  userInfo.Sub().User,
-			"Group": userInfo.Sub().Group,
-			"Email": userInfo.Email(),
-			"Name":  userInfo.Name(),
+			"User":   userInfo.Sub().User,
+			"Group":  userInfo.Sub().Group,
+			"Groups": userInfo.Sub().AllGroups(),
+			"Email":  userInfo.Email(),
+			"Name":   userInfo.Name(),
 		})
 
 		if err != nil {
@@ -0,0 +1,177 @@
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"tweek-gateway/audit"
+
+	"github.com/urfave/negroni"
+)
+
+const valuesPathPrefix = "/api/v2/values/"
+
+// errorCountHeader holds the number of keys of a values response which failed to calculate
+const errorCountHeader = "X-Error-Count"
+
+// ValuesFilterMiddleware removes the keys of folder values responses, which the subject isn't allowed to read.
+// Folder requests are sent to the api flattened, and the response is reshaped as requested after filtering,
+// with the error count of the filtered response
+func ValuesFilterMiddleware(authorizer Authorizer, auditor audit.Auditor) negroni.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		if !shouldFilterValues(r) {
+			next(rw, r)
+			return
+		}
+
+		original := r.Clone(r.Context())
+		upstreamRequest := r.Clone(r.Context())
+		upstreamRequest.URL.RawQuery = FlattenValuesQuery(r.URL.Query()).Encode()
+		filterResponse(rw, upstreamRequest, next, func(body []byte, header http.Header) ([]byte, error) {
+			filtered, errorCount, err := filterValues(authorizer, auditor, original, body)
+			if err == nil {
+				header.Set(errorCountHeader, strconv.Itoa(errorCount))
+			}
+			return filtered, err
+		})
+	}
+}
+
+// IsFolderValuesRequest returns true for values requests of all the keys in a folder
+func IsFolderValuesRequest(r *http.Request) bool {
+	_, ok := valuesFolder(r)
+	return ok
+}
+
+// FlattenValuesQuery returns a copy of the query of a values request, which gets flat results from the api, along with their errors
+func FlattenValuesQuery(query url.Values) url.Values {
+	result := url.Values{}
+	for key, values := range query {
+		result[key] = values
+	}
+	result.Set("$flatten", "true")
+	result.Set("$includeErrors", "true")
+	return result
+}
+
+// FilterValues removes the keys the subject of a folder values request isn't allowed to read, from the flat response of the api
+// to the query of FlattenValuesQuery. The result is shaped as the request asked, flat or as a tree, with errors if it asked for them
+func FilterValues(authorizer Authorizer, auditor audit.Auditor, r *http.Request, body []byte) ([]byte, error) {
+	filtered, _, err := filterValues(authorizer, auditor, r, body)
+	return filtered, err
+}
+
+// filterValues filters the values response like FilterValues, and returns the number of errors the subject may read
+func filterValues(authorizer Authorizer, auditor audit.Auditor, r *http.Request, body []byte) ([]byte, int, error) {
+	folder, ok := valuesFolder(r)
+	user, hasUser := r.Context().Value(UserInfoKey).(UserInfo)
+	if !ok || !hasUser {
+		return nil, 0, fmt.Errorf("Not a folder values request %s", r.URL.Path)
+	}
+	auditor = requestAuditor(r.Context(), auditor)
+
+	resource, err := extractContextsFromValuesRequest(r, user)
+	if err != nil {
+		return nil, 0, err
+	}
+	isAllowed := func(keyPath string) bool {
+		if user.Issuer() == "tweek" {
+			return true
+		}
+		escaped, err := EscapeKeyPath(keyPath)
+		if err != nil {
+			return false
+		}
+		object := PolicyResource{Item: "values/" + escaped, Contexts: resource.Contexts}
+		allowed, err := authorizer.Authorize(r.Context(), user.Sub(), object, "read")
+		if err != nil {
+			auditor.AuthorizerError(user.Sub().String(), fmt.Sprintf("%q", object), "read", err)
+			return false
+		}
+		return allowed
+	}
+
+	query := r.URL.Query()
+	flatten, _ := strconv.ParseBool(query.Get("$flatten"))
+	includeErrors, _ := strconv.ParseBool(query.Get("$includeErrors"))
+
+	var response struct {
+		Data   map[string]json.RawMessage `json:"data"`
+		Errors map[string]string          `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, 0, fmt.Errorf("Invalid values response: %v", err)
+	}
+
+	filtered := 0
+	for key := range response.Data {
+		if !isAllowed(folder + key) {
+			delete(response.Data, key)
+			filtered++
+		}
+	}
+	for key := range response.Errors {
+		if !isAllowed(key) {
+			delete(response.Errors, key)
+			filtered++
+		}
+	}
+	if filtered > 0 {
+		auditor.Filtered(user.Sub().String(), fmt.Sprintf("%q", resource), "read", filtered)
+	}
+
+	var data interface{} = response.Data
+	if !flatten {
+		data = valuesTree(response.Data)
+	}
+	if includeErrors {
+		data = map[string]interface{}{"data": data, "errors": response.Errors}
+	}
+	result, err := json.Marshal(data)
+	return result, len(response.Errors), err
+}
+
+// shouldFilterValues returns true for folder values requests of subjects, whose policies are enforced
+func shouldFilterValues(r *http.Request) bool {
+	if r.Method != http.MethodGet || !IsFolderValuesRequest(r) {
+		return false
+	}
+	user, ok := r.Context().Value(UserInfoKey).(UserInfo)
+	return ok && user.Issuer() != "tweek"
+}
+
+// valuesFolder returns the folder of a values request, with a trailing slash, or an empty string for the whole repository
+func valuesFolder(r *http.Request) (string, bool) {
+	path, err := url.PathUnescape(r.URL.EscapedPath())
+	if err != nil || !strings.HasPrefix(path, valuesPathPrefix) {
+		return "", false
+	}
+	keyPath := strings.TrimPrefix(path, valuesPathPrefix)
+	if keyPath != "_" && !strings.HasSuffix(keyPath, "/_") {
+		return "", false
+	}
+	return strings.TrimSuffix(keyPath, "_"), true
+}
+
+// valuesTree nests flat values by the segments of their key paths, like the api does
+func valuesTree(values map[string]json.RawMessage) map[string]interface{} {
+	tree := map[string]interface{}{}
+	for keyPath, value := range values {
+		node := tree
+		segments := strings.Split(keyPath, "/")
+		for _, segment := range segments[:len(segments)-1] {
+			child, ok := node[segment].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				node[segment] = child
+			}
+			node = child
+		}
+		node[segments[len(segments)-1]] = value
+	}
+	return tree
+}
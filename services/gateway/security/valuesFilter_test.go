@@ -0,0 +1,147 @@
+package security
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type funcAuthorizer func(object PolicyResource) bool
+
+func (f funcAuthorizer) Authorize(ctx context.Context, subject *Subject, object PolicyResource, action string) (bool, error) {
+	return f(object), nil
+}
+
+type countingAuditor struct {
+	emptyAuditor
+	filtered int
+	denied   bool
+}
+
+func (a *countingAuditor) Denied(subject, object, action string) {
+	a.denied = true
+}
+
+func (a *countingAuditor) Filtered(subject, object, action string, count int) {
+	a.filtered += count
+}
+
+func TestValuesFilterMiddleware(t *testing.T) {
+	authorizer := funcAuthorizer(func(object PolicyResource) bool {
+		return !strings.HasSuffix(object.Item, "/secret") && object.Contexts["user"][0] == "self"
+	})
+	var flattened bool
+	upstream := func(rw http.ResponseWriter, r *http.Request) {
+		flattened = r.URL.Query().Get("$flatten") == "true"
+		rw.Header().Set("Content-Length", "1000")
+		rw.Header().Set("X-Error-Count", "2")
+		data := `{"a/key":1,"a/secret":2,"b/c/key":{"x":"y"},"secret":3}`
+		if r.URL.Query().Get("$includeErrors") == "true" {
+			rw.Write([]byte(`{"data":` + data + `,"errors":{"folder/b/secret":"failed","folder/b/key":"failed"}}`))
+			return
+		}
+		rw.Write([]byte(data))
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		issuer         string
+		want           string
+		wantFiltered   int
+		wantFlatten    bool
+		wantErrorCount string
+	}{
+		{
+			name:           "Tree",
+			path:           "/api/v2/values/folder/_?user=alice",
+			want:           `{"a":{"key":1},"b":{"c":{"key":{"x":"y"}}}}`,
+			wantFiltered:   3,
+			wantFlatten:    true,
+			wantErrorCount: "1",
+		},
+		{
+			name:           "Flatten",
+			path:           "/api/v2/values/folder/_?user=alice&$flatten=true",
+			want:           `{"a/key":1,"b/c/key":{"x":"y"}}`,
+			wantFiltered:   3,
+			wantFlatten:    true,
+			wantErrorCount: "1",
+		},
+		{
+			name:           "Include errors",
+			path:           "/api/v2/values/folder/_?user=alice&$flatten=true&$includeErrors=true",
+			want:           `{"data":{"a/key":1,"b/c/key":{"x":"y"}},"errors":{"folder/b/key":"failed"}}`,
+			wantFiltered:   3,
+			wantFlatten:    true,
+			wantErrorCount: "1",
+		},
+		{
+			name:           "Not allowed context",
+			path:           "/api/v2/values/_?user=bob",
+			want:           `{}`,
+			wantFiltered:   6,
+			wantFlatten:    true,
+			wantErrorCount: "0",
+		},
+		{
+			name:           "Tweek issuer isn't filtered",
+			path:           "/api/v2/values/folder/_?user=alice",
+			issuer:         "tweek",
+			want:           `{"a/key":1,"a/secret":2,"b/c/key":{"x":"y"},"secret":3}`,
+			wantErrorCount: "2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor := &countingAuditor{}
+			r := httptest.NewRequest("GET", tt.path, nil)
+			info := &userInfo{sub: &Subject{User: "alice", Group: "default"}, issuer: tt.issuer}
+			r = r.WithContext(context.WithValue(r.Context(), UserInfoKey, info))
+			recorder := httptest.NewRecorder()
+
+			ValuesFilterMiddleware(authorizer, auditor)(recorder, r, upstream)
+
+			if flattened != tt.wantFlatten {
+				t.Errorf("Upstream flattened = %v, want %v", flattened, tt.wantFlatten)
+			}
+			if got := recorder.Body.String(); got != tt.want {
+				t.Errorf("Body = %v, want %v", got, tt.want)
+			}
+			if length := recorder.Header().Get("Content-Length"); tt.wantFlatten && length != "" {
+				t.Errorf("Content-Length = %v, want none", length)
+			}
+			if count := recorder.Header().Get("X-Error-Count"); count != tt.wantErrorCount {
+				t.Errorf("X-Error-Count = %v, want %v", count, tt.wantErrorCount)
+			}
+			if auditor.filtered != tt.wantFiltered {
+				t.Errorf("Filtered = %v, want %v", auditor.filtered, tt.wantFiltered)
+			}
+		})
+	}
+}
+
+func TestIsFolderValuesRequest(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/api/v2/values/_", want: true},
+		{path: "/api/v2/values/some/folder/_?user=alice", want: true},
+		{path: "/api/v2/values/some/key", want: false},
+		{path: "/api/v2/values/some/key_", want: false},
+		{path: "/api/v2/context/user/_", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := &http.Request{URL: &url.URL{}}
+			r.URL, _ = url.Parse(tt.path)
+			if got := IsFolderValuesRequest(r); got != tt.want {
+				t.Errorf("IsFolderValuesRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,160 +1,329 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
-	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"tweek-gateway/appConfig"
+	"tweek-gateway/revisionWatcher"
 	"tweek-gateway/security"
+	"tweek-gateway/snapshot"
 
 	minio "github.com/minio/minio-go"
 	nats "github.com/nats-io/nats.go"
 	"github.com/sirupsen/logrus"
 )
 
-type authorizerInitializer func(*appConfig.Security) (security.Authorizer, error)
+const (
+	policyObject                 = "security/policy.json"
+	subjectExtractionRulesObject = "security/subject_extraction_rules.rego"
+)
 
-func initAuthorizer(cfg *appConfig.Security) (security.Authorizer, error) {
-	initial, err := setupAuthorizer(cfg)
-	if err != nil {
-		return nil, err
-	}
+// objectLoader loads an object from the policy storage, or from its snapshot
+type objectLoader func(name string) ([]byte, error)
 
-	synchronized := security.NewSynchronizedAuthorizer(initial)
-	nc, err := nats.Connect(cfg.PolicyStorage.NatsEndpoint)
-	if err != nil {
-		return nil, err
-	}
-	subscription, err := nc.Subscribe("version", refreshAuthorizer(cfg, synchronized))
-	if err != nil {
-		return nil, err
-	}
-	runtime.SetFinalizer(synchronized, func(s interface{}) {
-		if subscription != nil && subscription.IsValid() {
-			subscription.Unsubscribe()
+func remoteLoader(policyStorage *appConfig.PolicyStorage) objectLoader {
+	return func(name string) ([]byte, error) {
+		client, err := minio.New(policyStorage.MinioEndpoint, policyStorage.MinioAccessKey, policyStorage.MinioSecretKey, policyStorage.MinioUseSSL)
+		if err != nil {
+			return nil, err
+		}
+
+		reader, err := client.GetObject(policyStorage.MinioBucketName, name, minio.GetObjectOptions{})
+		if err != nil {
+			return nil, err
 		}
+
+		defer reader.Close()
+
+		return ioutil.ReadAll(reader)
+	}
+}
+
+func initAuthorizer(cfg *appConfig.Security, watcher *revisionWatcher.Watcher, snapshots *snapshot.Store) (security.Authorizer, error) {
+	load := remoteLoader(&cfg.PolicyStorage)
+
+	var initial security.Authorizer
+	err := withRetry(3, time.Second*5, func() (err error) {
+		initial, err = setupAuthorizer(load, snapshots)
+		return
 	})
 
+	var synchronized *security.SynchronizedAuthorizer
+	if err == nil {
+		synchronized = security.NewSynchronizedAuthorizer(initial)
+	} else {
+		initial, snapshotErr := setupAuthorizer(snapshots.Load, nil)
+		if snapshotErr != nil {
+			return nil, err
+		}
+		synchronized = security.NewSynchronizedAuthorizer(initial)
+		snapshots.SetDegraded(policyObject, err)
+		snapshots.Recover(policyObject, updateAuthorizer(load, synchronized, snapshots))
+	}
+
+	watcher.Subscribe(refreshAuthorizer(load, synchronized, snapshots))
+
 	return synchronized, nil
 }
 
-func setupAuthorizer(cfg *appConfig.Security) (security.Authorizer, error) {
-	policyStorage := cfg.PolicyStorage
-	client, err := minio.New(policyStorage.MinioEndpoint, policyStorage.MinioAccessKey, policyStorage.MinioSecretKey, policyStorage.MinioUseSSL)
-	if err != nil {
-		return nil, err
-	}
+// setupAuthorizer creates an authorizer from the loaded policy, and saves a snapshot of it to snapshots (if not nil)
+func setupAuthorizer(load objectLoader, snapshots *snapshot.Store) (authorizer security.Authorizer, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Invalid authorization policy: %v", r)
+		}
+	}()
 
 	rules, err := ioutil.ReadFile("./authorization.rego")
 	if err != nil {
 		return nil, err
 	}
 
-	reader, err := client.GetObject(policyStorage.MinioBucketName, "security/policy.json", minio.GetObjectOptions{})
+	data, err := load(policyObject)
 	if err != nil {
 		return nil, err
 	}
 
-	defer reader.Close()
+	authorizer = security.NewDefaultAuthorizer(string(rules), string(data), "authorization", "authorize")
+	snapshots.Save(policyObject, data)
+	return authorizer, nil
+}
 
-	data, err := ioutil.ReadAll(reader)
-	if err != nil {
-		return nil, err
+func updateAuthorizer(load objectLoader, authorizer *security.SynchronizedAuthorizer, snapshots *snapshot.Store) func() error {
+	return func() error {
+		newAuthorizer, err := setupAuthorizer(load, snapshots)
+		if err != nil {
+			return err
+		}
+		authorizer.Update(newAuthorizer)
+		return nil
 	}
-	return security.NewDefaultAuthorizer(string(rules), string(data), "authorization", "authorize"), nil
 }
 
-func refreshAuthorizer(cfg *appConfig.Security, authorizer *security.SynchronizedAuthorizer) nats.MsgHandler {
+func refreshAuthorizer(load objectLoader, authorizer *security.SynchronizedAuthorizer, snapshots *snapshot.Store) nats.MsgHandler {
+	update := updateAuthorizer(load, authorizer, snapshots)
 	return nats.MsgHandler(func(msg *nats.Msg) {
-		defer func() {
-			if r := recover(); r != nil {
-				logrus.WithField(logrus.ErrorKey, r).Warning("Failed to refresh authorizer")
-			}
-		}()
-
-		newAuthorizer, err := setupAuthorizer(cfg)
-		if err == nil {
-			authorizer.Update(newAuthorizer)
+		if err := update(); err == nil {
+			snapshots.ClearDegraded(policyObject)
 		} else {
 			logrus.WithError(err).Error("Error updating authorizer")
 		}
 	})
 }
 
-func withRetry(times int, sleepDuration time.Duration, action authorizerInitializer, arg *appConfig.Security) (security.Authorizer, error) {
-	var res security.Authorizer
+func withRetry(times int, sleepDuration time.Duration, action func() error) error {
 	var err error
 	for i := 0; i < times; i++ {
-		res, err = action(arg)
+		err = action()
 		if err == nil {
-			return res, nil
+			return nil
 		}
-		logrus.WithError(err).Error("Error creating authorizer, retrying...")
+		logrus.WithError(err).Error("Error loading from policy storage, retrying...")
 		time.Sleep(sleepDuration)
 	}
-	return nil, err
+	return err
 }
 
-func setupSubjectExtractorWithRefresh(config appConfig.Security) (security.SubjectExtractor, error) {
-	initial, err := setupSubjectExtractor(config)
-	if err != nil {
-		return nil, err
-	}
-
-	synchronized := security.NewSynchronizedSubjectExtractor(initial)
+func setupSubjectExtractorWithRefresh(config appConfig.Security, watcher *revisionWatcher.Watcher, snapshots *snapshot.Store) (security.SubjectExtractor, error) {
+	load := remoteLoader(&config.PolicyStorage)
+	providers := config.Auth.Providers
 
-	nc, err := nats.Connect(config.PolicyStorage.NatsEndpoint)
-	if err != nil {
-		return nil, err
+	var synchronized *security.SynchronizedSubjectExtractor
+	initial, err := setupSubjectExtractor(load, snapshots, providers, nil)
+	if err == nil {
+		synchronized = security.NewSynchronizedSubjectExtractor(initial)
+	} else {
+		var snapshotErr error
+		initial, snapshotErr = setupSubjectExtractor(snapshots.Load, nil, providers, nil)
+		if snapshotErr != nil {
+			return nil, err
+		}
+		synchronized = security.NewSynchronizedSubjectExtractor(initial)
 	}
-	subscription, err := nc.Subscribe("version", refreshExtractor(config, synchronized))
+
+	update := updateExtractor(load, synchronized, snapshots, providers, initial)
 	if err != nil {
-		return nil, err
+		snapshots.SetDegraded(subjectExtractionRulesObject, err)
+		snapshots.Recover(subjectExtractionRulesObject, update)
 	}
-	runtime.SetFinalizer(synchronized, func(s interface{}) {
-		if subscription != nil && subscription.IsValid() {
-			subscription.Unsubscribe()
+
+	for _, provider := range providers {
+		if len(provider.SubjectExtractionRules) > 0 {
+			watcher.Watch(provider.SubjectExtractionRules)
 		}
-	})
+	}
+	watcher.Subscribe(refreshExtractor(update, snapshots))
 
 	return synchronized, nil
 }
 
-func refreshExtractor(cfg appConfig.Security, extractor *security.SynchronizedSubjectExtractor) nats.MsgHandler {
-	return nats.MsgHandler(func(msg *nats.Msg) {
-		defer func() {
-			if r := recover(); r != nil {
-				logrus.WithField(logrus.ErrorKey, r).Error("Failed to refresh user info extractor")
-			}
-		}()
+// updateExtractor returns a function, which loads the rules again and updates the extractor.
+// Rules which fail to load keep their previous version, and the error is returned after updating the others
+func updateExtractor(load objectLoader, extractor *security.SynchronizedSubjectExtractor, snapshots *snapshot.Store, providers map[string]appConfig.AuthProvider, current *security.IssuerSubjectExtractor) func() error {
+	var lock sync.Mutex
+	return func() error {
+		lock.Lock()
+		defer lock.Unlock()
 
-		newExtractor, err := setupSubjectExtractor(cfg)
-		if err == nil {
+		newExtractor, err := setupSubjectExtractor(load, snapshots, providers, current)
+		if newExtractor != nil {
+			current = newExtractor
 			extractor.UpdateExtractor(newExtractor)
+		}
+		return err
+	}
+}
+
+func refreshExtractor(update func() error, snapshots *snapshot.Store) nats.MsgHandler {
+	return nats.MsgHandler(func(msg *nats.Msg) {
+		if err := update(); err == nil {
+			snapshots.ClearDegraded(subjectExtractionRulesObject)
 		} else {
 			logrus.WithError(err).Error("Error updating user info extractor")
 		}
 	})
 }
 
-func setupSubjectExtractor(cfg appConfig.Security) (security.SubjectExtractor, error) {
-	policyStorage := cfg.PolicyStorage
-	client, err := minio.New(policyStorage.MinioEndpoint, policyStorage.MinioAccessKey, policyStorage.MinioSecretKey, policyStorage.MinioUseSSL)
+// setupSubjectExtractor creates an extractor from the global rules and the rules of each provider, which are compiled independently.
+// Rules which fail to load are taken from previous (if not nil), and the extractor is returned with the error
+func setupSubjectExtractor(load objectLoader, snapshots *snapshot.Store, providers map[string]appConfig.AuthProvider, previous *security.IssuerSubjectExtractor) (*security.IssuerSubjectExtractor, error) {
+	var errs []string
+
+	fallback, err := loadSubjectExtractor(load, subjectExtractionRulesObject, snapshots)
 	if err != nil {
-		return nil, err
+		if previous == nil {
+			return nil, err
+		}
+		fallback = previous.Fallback()
+		errs = append(errs, err.Error())
 	}
 
-	reader, err := client.GetObject(policyStorage.MinioBucketName, "security/subject_extraction_rules.rego", minio.GetObjectOptions{})
-	if err != nil {
-		return nil, err
+	keys := make([]string, 0, len(providers))
+	for key := range providers {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+
+	issuers := map[string]security.SubjectExtractor{}
+	for _, key := range keys {
+		provider := providers[key]
+		if len(provider.SubjectExtractionRules) == 0 {
+			continue
+		}
 
-	defer reader.Close()
+		extractor, err := loadSubjectExtractor(load, provider.SubjectExtractionRules, snapshots)
+		if err != nil {
+			err = fmt.Errorf("Provider %s: %v", key, err)
+			current, ok := previous.ForIssuer(provider.Issuer)
+			if !ok {
+				return nil, err
+			}
+			extractor = current
+			errs = append(errs, err.Error())
+		}
+		issuers[provider.Issuer] = extractor
+	}
+
+	extractor := security.NewIssuerSubjectExtractor(fallback, issuers)
+	if len(errs) > 0 {
+		return extractor, errors.New(strings.Join(errs, "; "))
+	}
+	return extractor, nil
+}
+
+// loadSubjectExtractor creates an extractor from the loaded rules object, and saves a snapshot of it to snapshots (if not nil)
+func loadSubjectExtractor(load objectLoader, name string, snapshots *snapshot.Store) (extractor security.SubjectExtractor, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Invalid subject extraction rules %s: %v", name, r)
+		}
+	}()
 
-	data, err := ioutil.ReadAll(reader)
+	data, err := load(name)
 	if err != nil {
 		return nil, err
 	}
-	return security.NewDefaultSubjectExtractor(string(data), "rules", "subject"), nil
+	extractor = security.NewDefaultSubjectExtractor(string(data), "rules", "subject")
+	snapshots.Save(name, data)
+	return extractor, nil
+}
+
+const (
+	defaultEnrichmentTimeout  = 5 * time.Second
+	defaultEnrichmentCacheTTL = 5 * time.Minute
+)
+
+// setupSubjectEnrichment wraps the extractor with the configured directory, or returns it as is when enrichment is disabled
+func setupSubjectEnrichment(config appConfig.Security, extractor security.SubjectExtractor, watcher *revisionWatcher.Watcher, snapshots *snapshot.Store) (security.SubjectExtractor, error) {
+	enrichment := config.Enrichment
+	var directory security.Directory
+	switch {
+	case len(enrichment.URL) > 0:
+		timeout, err := durationOrDefault(enrichment.Timeout, defaultEnrichmentTimeout)
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := durationOrDefault(enrichment.CacheTTL, defaultEnrichmentCacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		directory = security.NewCachedDirectory(security.NewHTTPDirectory(enrichment.URL, timeout), ttl)
+	case len(enrichment.MappingObject) > 0:
+		mapping, err := setupMappingDirectory(remoteLoader(&config.PolicyStorage), enrichment.MappingObject, watcher, snapshots)
+		if err != nil {
+			return nil, err
+		}
+		directory = mapping
+	default:
+		return extractor, nil
+	}
+	return security.NewEnrichingSubjectExtractor(extractor, directory, enrichment.FallbackToToken), nil
+}
+
+// setupMappingDirectory loads the mapping object, falling back to its snapshot, and updates it on every new revision
+func setupMappingDirectory(load objectLoader, name string, watcher *revisionWatcher.Watcher, snapshots *snapshot.Store) (*security.MappingDirectory, error) {
+	mapping := security.NewMappingDirectory()
+	update := func() error {
+		data, err := load(name)
+		if err != nil {
+			return err
+		}
+		if err := mapping.Update(name, data); err != nil {
+			return err
+		}
+		snapshots.Save(name, data)
+		return nil
+	}
+
+	if err := update(); err != nil {
+		data, snapshotErr := snapshots.Load(name)
+		if snapshotErr != nil || mapping.Update(name, data) != nil {
+			return nil, err
+		}
+		snapshots.SetDegraded(name, err)
+		snapshots.Recover(name, update)
+	}
+
+	watcher.Watch(name)
+	watcher.Subscribe(nats.MsgHandler(func(msg *nats.Msg) {
+		if err := update(); err == nil {
+			snapshots.ClearDegraded(name)
+		} else {
+			logrus.WithError(err).Error("Error updating subject enrichment mapping")
+		}
+	}))
+	return mapping, nil
+}
+
+func durationOrDefault(value string, defaultValue time.Duration) (time.Duration, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(value)
 }
@@ -0,0 +1,142 @@
+package snapshot
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRetryDelay limits the delay between background reload attempts
+const maxRetryDelay = time.Minute
+
+// ErrDisabled is returned when loading from a store without a snapshot directory
+var ErrDisabled = errors.New("Snapshots are disabled")
+
+// Store keeps the last known good copy of remotely loaded objects on local disk, and tracks
+// which of them are currently served from the snapshot (degraded mode)
+type Store struct {
+	dir      string
+	lock     sync.RWMutex
+	degraded map[string]string
+}
+
+// New creates a snapshot store in the given directory. Snapshots are disabled if dir is empty
+func New(dir string) *Store {
+	return &Store{
+		dir:      dir,
+		degraded: map[string]string{},
+	}
+}
+
+// Enabled returns true if the store has a snapshot directory
+func (s *Store) Enabled() bool {
+	return s != nil && len(s.dir) > 0
+}
+
+// Save writes the object to the snapshot directory. Failures are logged, as snapshots are best effort
+func (s *Store) Save(name string, data []byte) {
+	if !s.Enabled() {
+		return
+	}
+
+	path := s.path(name)
+	if err := writeFileAtomic(path, data); err != nil {
+		logrus.WithError(err).WithField("snapshot", path).Warn("Failed to save snapshot")
+	}
+}
+
+// Load reads the object from the snapshot directory
+func (s *Store) Load(name string) ([]byte, error) {
+	if !s.Enabled() {
+		return nil, ErrDisabled
+	}
+	return ioutil.ReadFile(s.path(name))
+}
+
+// SetDegraded marks the object as served from its snapshot because of err
+func (s *Store) SetDegraded(name string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.degraded[name] = err.Error()
+	logrus.WithError(err).WithField("object", name).Warn("Serving from last known good snapshot")
+}
+
+// ClearDegraded marks the object as loaded from its remote source
+func (s *Store) ClearDegraded(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.degraded[name]; ok {
+		delete(s.degraded, name)
+		logrus.WithField("object", name).Info("Recovered from last known good snapshot")
+	}
+}
+
+// Degraded returns the objects currently served from snapshots, with the error that caused it
+func (s *Store) Degraded() map[string]string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make(map[string]string, len(s.degraded))
+	for name, reason := range s.degraded {
+		result[name] = reason
+	}
+	return result
+}
+
+func (s *Store) isDegraded(name string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	_, ok := s.degraded[name]
+	return ok
+}
+
+// Recover retries load in the background with exponential backoff, until it succeeds and the object is no longer degraded
+func (s *Store) Recover(name string, load func() error) {
+	go func() {
+		delay := time.Second
+		for {
+			<-time.After(delay)
+			if !s.isDegraded(name) {
+				return
+			}
+			err := load()
+			if err == nil {
+				s.ClearDegraded(name)
+				return
+			}
+			logrus.WithError(err).WithField("object", name).Debug("Still unable to load object")
+			if delay *= 2; delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+		}
+	}()
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,48 @@
+package snapshot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStore_SaveAndLoad(t *testing.T) {
+	store := New(t.TempDir())
+
+	store.Save("security/policy.json", []byte(`{"policies":[]}`))
+	store.Save("security/policy.json", []byte(`{"policies":[{}]}`))
+
+	data, err := store.Load("security/policy.json")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if string(data) != `{"policies":[{}]}` {
+		t.Errorf("Load() = %s, want the last saved snapshot", data)
+	}
+
+	if _, err := store.Load("external_apps.json"); err == nil {
+		t.Error("Load() should fail for missing snapshots")
+	}
+}
+
+func TestStore_Disabled(t *testing.T) {
+	store := New("")
+	store.Save("security/policy.json", []byte(`{}`))
+
+	if _, err := store.Load("security/policy.json"); err != ErrDisabled {
+		t.Errorf("Load() error = %v, want %v", err, ErrDisabled)
+	}
+}
+
+func TestStore_Degraded(t *testing.T) {
+	store := New(t.TempDir())
+
+	store.SetDegraded("external_apps.json", errors.New("minio is down"))
+	if reason := store.Degraded()["external_apps.json"]; reason != "minio is down" {
+		t.Errorf("Degraded() = %v, want reason for external_apps.json", store.Degraded())
+	}
+
+	store.ClearDegraded("external_apps.json")
+	if len(store.Degraded()) != 0 {
+		t.Errorf("Degraded() = %v, want empty", store.Degraded())
+	}
+}
@@ -24,7 +24,7 @@ test_dont_authorize_denied_key {
     not authorize with input as {
         "user": "00000000-0000-0000-0000-000000000000",
         "group": "default",
-        "contexts": { "user": "tester" },
+        "contexts": { "user": ["tester"] },
         "object": "keys.denied/key",
         "action": "read"
     }
@@ -34,7 +34,7 @@ test_authorize_allow_self_context_property {
     authorize with input as {
         "user": "00000000-0000-0000-0000-000000000000",
         "group": "default",
-        "contexts": {"user": "self"},
+        "contexts": {"user": ["self"]},
         "object": "user.name",
         "action": "write"
     }
@@ -54,7 +54,7 @@ test_authorize_deny_non_self_context_property {
     not authorize with input as {
         "user": "00000000-0000-0000-0000-000000000000",
         "group": "default",
-        "contexts": {"device": "testdevice"},
+        "contexts": {"device": ["testdevice"]},
         "object": "device.isTest",
         "action": "write"
     }
@@ -64,7 +64,7 @@ test_authorize_deny_unallowed_action {
     not authorize with input as {
         "user": "00000000-0000-0000-0000-000000000000",
         "group": "default",
-        "contexts": {"user": "self", "device": "testdevice"},
+        "contexts": {"user": ["self"], "device": ["testdevice"]},
         "object": "keys.test/key",
         "action": "write"
     }
@@ -74,7 +74,7 @@ test_authorize_allow_allowed_action {
     authorize with input as {
         "user": "00000000-0000-0000-0000-000000000000",
         "group": "default",
-        "contexts": {"user": "self", "device": "testdevice"},
+        "contexts": {"user": ["self"], "device": ["testdevice"]},
         "object": "keys.test/key",
         "action": "read"
     }
@@ -84,7 +84,7 @@ test_authorize_deny_mismatching_contexts {
     not authorize with input as {
         "user": "00000000-0000-0000-0000-000000000000",
         "group": "default",
-        "contexts": {"user": "tester", "device": "testdevice"},
+        "contexts": {"user": ["tester"], "device": ["testdevice"]},
         "object": "keys.test/key",
         "action": "read"
     }
@@ -94,7 +94,7 @@ test_authorize_deny_extra_context {
     not authorize with input as {
         "user": "00000000-0000-0000-0000-000000000000",
         "group": "default",
-        "contexts": {"user": "self", "device": "testdevice", "extra": "extra"},
+        "contexts": {"user": ["self"], "device": ["testdevice"], "extra": ["extra"]},
         "object": "keys.test/key",
         "action": "read"
     }
@@ -104,7 +104,7 @@ test_authorize_allow_wildcard_context {
     authorize with input as {
         "user": "00000000-0000-0000-0000-000000000000",
         "group": "default",
-        "contexts": {"user": "self", "device": "testdevice", "extra": "extra"},
+        "contexts": {"user": ["self"], "device": ["testdevice"], "extra": ["extra"]},
         "object": "keys.test/key_with_wildcard_context",
         "action": "read"
     }
@@ -129,3 +129,548 @@ test_authorize_deny_scoped_bulk_keys_upload {
         "action": "write"
     }
 }
+
+test_authorize_allow_multiple_context_values {
+    authorize with input as {
+        "user": "00000000-0000-0000-0000-000000000000",
+        "group": "default",
+        "contexts": {"user": ["self", "tester"], "device": ["testdevice"]},
+        "object": "keys.test/key_with_wildcard_context",
+        "action": "read"
+    }
+}
+
+test_authorize_deny_unmatched_context_value {
+    not authorize with input as {
+        "user": "00000000-0000-0000-0000-000000000000",
+        "group": "default",
+        "contexts": {"user": ["self", "tester"], "device": ["testdevice"]},
+        "object": "keys.test/key",
+        "action": "read"
+    }
+}
+
+test_authorize_deny_denied_context_value {
+    not authorize with input as {
+        "user": "00000000-0000-0000-0000-000000000000",
+        "group": "default",
+        "contexts": {"user": ["self", "blocked"]},
+        "object": "keys.test/key_with_wildcard_context",
+        "action": "read"
+    }
+}
+
+test_authorize_allow_team_key_folder_read {
+    authorize with input as {
+        "user": "team-reader",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/team/some_key",
+        "action": "read"
+    }
+}
+
+test_authorize_deny_other_key_folder_read {
+    not authorize with input as {
+        "user": "team-reader",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/other/some_key",
+        "action": "read"
+    }
+}
+
+test_authorize_allow_key_read_by_repo_policy {
+    authorize with input as {
+        "user": "repo-reader",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/other/some_key",
+        "action": "read"
+    }
+}
+
+test_authorize_deny_key_write_by_repo_policy {
+    not authorize with input as {
+        "user": "repo-reader",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/other/some_key",
+        "action": "write"
+    }
+}
+
+test_authorize_allow_key_read_by_repo_policy_with_other_key_read_policies {
+    authorize with input as {
+        "user": "repo-reader",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/private/some_key",
+        "action": "read"
+    }
+}
+
+test_authorize_deny_key_read_by_repo_deny_policy {
+    not authorize with input as {
+        "user": "carol",
+        "group": "contractors",
+        "contexts": {},
+        "object": "repo/keys/public/some_key",
+        "action": "read"
+    }
+}
+
+test_authorize_allow_public_key_read {
+    authorize with input as {
+        "user": "carol",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/public/some_key",
+        "action": "read"
+    }
+}
+
+test_authorize_allow_repo_read_for_scoped_subject {
+    authorize with input as {
+        "user": "team-reader",
+        "group": "default",
+        "contexts": {},
+        "object": "repo",
+        "action": "read"
+    }
+}
+
+# Monday 2021-06-07 08:30 UTC, 09:30 in London
+test_authorize_conditions_office_hours {
+    authorize with input as {
+        "user": "office-editor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write",
+        "source_ip": "10.1.2.3",
+        "time": 1623054600000000000
+    }
+}
+
+test_dont_authorize_conditions_outside_network {
+    not authorize with input as {
+        "user": "office-editor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write",
+        "source_ip": "172.16.0.1",
+        "time": 1623054600000000000
+    }
+}
+
+test_dont_authorize_conditions_without_source_ip {
+    not authorize with input as {
+        "user": "office-editor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write",
+        "time": 1623054600000000000
+    }
+}
+
+# Monday 2021-06-07 20:00 UTC
+test_dont_authorize_conditions_after_hours {
+    not authorize with input as {
+        "user": "office-editor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write",
+        "source_ip": "10.1.2.3",
+        "time": 1623096000000000000
+    }
+}
+
+# Sunday 2021-06-06 10:00 UTC
+test_dont_authorize_conditions_weekend {
+    not authorize with input as {
+        "user": "office-editor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write",
+        "source_ip": "10.1.2.3",
+        "time": 1622973600000000000
+    }
+}
+
+test_dont_authorize_conditions_denied_network {
+    not authorize with input as {
+        "user": "office-editor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write",
+        "source_ip": "10.66.0.7",
+        "time": 1623054600000000000
+    }
+}
+
+# Monday 2021-06-07 23:30 UTC
+test_authorize_conditions_hours_across_midnight {
+    authorize with input as {
+        "user": "on-call",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write",
+        "time": 1623108600000000000
+    }
+}
+
+test_dont_authorize_conditions_hours_across_midnight {
+    not authorize with input as {
+        "user": "on-call",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write",
+        "time": 1623060000000000000
+    }
+}
+
+test_authorize_any_group {
+    authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "groups": ["employees", "release-managers"],
+        "contexts": {},
+        "object": "repo/keys/release/version",
+        "action": "write"
+    }
+}
+
+test_dont_authorize_denied_group {
+    not authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "groups": ["employees", "release-managers", "contractors"],
+        "contexts": {},
+        "object": "repo/keys/release/version",
+        "action": "write"
+    }
+}
+
+test_dont_authorize_unmatched_groups {
+    not authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "groups": ["employees", "readers"],
+        "contexts": {},
+        "object": "repo/keys/release/version",
+        "action": "write"
+    }
+}
+
+test_authorize_single_group_input {
+    authorize with input as {
+        "user": "alice",
+        "group": "release-managers",
+        "contexts": {},
+        "object": "repo/keys/release/version",
+        "action": "write"
+    }
+}
+
+test_authorize_role_binding_of_group {
+    authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "groups": ["employees", "shared-editors"],
+        "contexts": {},
+        "object": "repo/keys/shared/key",
+        "action": "write"
+    }
+}
+
+test_authorize_inherited_role {
+    authorize with input as {
+        "user": "alice",
+        "group": "shared-editors",
+        "contexts": {},
+        "object": "repo/keys/shared/key",
+        "action": "read"
+    }
+}
+
+test_dont_authorize_outside_role_grants {
+    not authorize with input as {
+        "user": "alice",
+        "group": "shared-editors",
+        "contexts": {},
+        "object": "repo/keys/other/key",
+        "action": "write"
+    }
+}
+
+test_authorize_role_binding_of_user {
+    authorize with input as {
+        "user": "lead",
+        "group": "default",
+        "contexts": {},
+        "object": "repo.tags",
+        "action": "write"
+    }
+}
+
+test_authorize_transitively_inherited_role {
+    authorize with input as {
+        "user": "lead",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/shared/key",
+        "action": "read"
+    }
+}
+
+test_dont_authorize_role_binding_of_other_group {
+    not authorize with input as {
+        "user": "lead",
+        "group": "employees",
+        "contexts": {},
+        "object": "repo.tags",
+        "action": "write"
+    }
+}
+
+test_dont_authorize_denying_role {
+    not authorize with input as {
+        "user": "frozen-editor",
+        "group": "shared-editors",
+        "contexts": {},
+        "object": "repo/keys/shared/key",
+        "action": "write"
+    }
+}
+
+test_authorize_user_placeholder {
+    authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "contexts": {},
+        "object": "repo/keys/personal/alice/key",
+        "action": "write"
+    }
+}
+
+test_dont_authorize_user_placeholder_of_other_user {
+    not authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "contexts": {},
+        "object": "repo/keys/personal/bob/key",
+        "action": "write"
+    }
+}
+
+test_dont_resolve_placeholder_with_wildcard {
+    not authorize with input as {
+        "user": "*",
+        "group": "employees",
+        "contexts": {},
+        "object": "repo/keys/personal/bob/key",
+        "action": "write"
+    }
+}
+
+test_authorize_claim_placeholder {
+    authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "claims": {"team": "payments"},
+        "contexts": {},
+        "object": "repo/keys/teams/payments/key",
+        "action": "write"
+    }
+}
+
+test_dont_authorize_claim_placeholder_of_other_team {
+    not authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "claims": {"team": "payments"},
+        "contexts": {},
+        "object": "repo/keys/teams/search/key",
+        "action": "write"
+    }
+}
+
+test_dont_authorize_unresolved_placeholder {
+    not authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "contexts": {},
+        "object": "repo/keys/teams/${claim.team}/key",
+        "action": "write"
+    }
+}
+
+test_authorize_outside_denied_claim_placeholder {
+    authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "claims": {"team": "payments"},
+        "contexts": {},
+        "object": "repo/keys/projects/search/release/key",
+        "action": "write"
+    }
+}
+
+test_dont_authorize_denied_claim_placeholder {
+    not authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "claims": {"team": "payments"},
+        "contexts": {},
+        "object": "repo/keys/projects/payments/release/key",
+        "action": "write"
+    }
+}
+
+test_dont_authorize_unresolved_denied_placeholder {
+    not authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "contexts": {},
+        "object": "repo/keys/projects/search/release/key",
+        "action": "write"
+    }
+}
+
+test_authorize_group_placeholder_of_any_group {
+    authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "groups": ["employees", "platform"],
+        "contexts": {},
+        "object": "repo/keys/groups/platform/key",
+        "action": "write"
+    }
+}
+
+test_authorize_attribute_placeholder {
+    authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "attributes": {"department": "engineering"},
+        "contexts": {},
+        "object": "repo/keys/departments/engineering/key",
+        "action": "write"
+    }
+}
+
+test_authorize_user_placeholder_in_contexts {
+    authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "contexts": {"user": ["self"]},
+        "object": "values/personal/key",
+        "action": "read"
+    }
+}
+
+test_dont_authorize_user_placeholder_in_contexts_of_other_user {
+    not authorize with input as {
+        "user": "alice",
+        "group": "employees",
+        "contexts": {"user": ["bob"]},
+        "object": "values/personal/key",
+        "action": "read"
+    }
+}
+
+# Monday 2021-06-07 08:30 UTC
+test_authorize_within_validity {
+    authorize with input as {
+        "user": "contractor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/contract/key",
+        "action": "write",
+        "time": 1623054600000000000
+    }
+}
+
+# 2021-05-31 12:00 UTC
+test_dont_authorize_before_validity {
+    not authorize with input as {
+        "user": "contractor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/contract/key",
+        "action": "write",
+        "time": 1622462400000000000
+    }
+}
+
+# 2021-07-01 00:00 UTC
+test_dont_authorize_expired {
+    not authorize with input as {
+        "user": "contractor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/contract/key",
+        "action": "write",
+        "time": 1625097600000000000
+    }
+}
+
+test_dont_authorize_time_bounded_without_time {
+    not authorize with input as {
+        "user": "contractor",
+        "group": "default",
+        "contexts": {},
+        "object": "repo/keys/contract/key",
+        "action": "write"
+    }
+}
+
+test_authorize_break_glass_request {
+    authorize with input as {
+        "user": "responder",
+        "group": "oncall",
+        "contexts": {},
+        "object": "break-glass/incident-responder",
+        "action": "write"
+    }
+}
+
+test_authorize_break_glass_role {
+    authorize with input as {
+        "user": "responder",
+        "group": "oncall",
+        "break_glass_roles": ["incident-responder"],
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write"
+    }
+}
+
+test_authorize_inherited_break_glass_role {
+    authorize with input as {
+        "user": "responder",
+        "group": "oncall",
+        "break_glass_roles": ["incident-responder"],
+        "contexts": {},
+        "object": "repo/keys/shared/key",
+        "action": "read"
+    }
+}
+
+test_dont_authorize_without_break_glass_role {
+    not authorize with input as {
+        "user": "responder",
+        "group": "oncall",
+        "contexts": {},
+        "object": "repo/keys/some/key",
+        "action": "write"
+    }
+}
@@ -5,19 +5,16 @@ import (
 	"github.com/urfave/negroni"
 	"io"
 	"net/http"
-	"tweek-gateway/appConfig"
 	"tweek-gateway/proxy"
 	"tweek-gateway/security"
+	"tweek-gateway/upstream"
 )
 
 // NewHealthHandler return /health endpoint handler
-func NewHealthHandler(upstreams *appConfig.Upstreams, token security.JWTToken, middleware *negroni.Negroni) http.Handler {
-	api := parseUpstreamOrPanic(upstreams.API)
-	authoring := parseUpstreamOrPanic(upstreams.Authoring)
-
+func NewHealthHandler(pools upstream.Pools, token security.JWTToken, middleware *negroni.Negroni) http.Handler {
 	// Proxy forwarders
-	apiForwarder := middleware.With(proxy.New(api, token))
-	authoringForwarder := middleware.With(proxy.New(authoring, token))
+	apiForwarder := middleware.With(proxy.New(pools["api"], token))
+	authoringForwarder := middleware.With(proxy.New(pools["authoring"], token))
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		logrus.Info("Health check")
 		switch r.Host {
@@ -6,11 +6,15 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"reflect"
 	"regexp"
+	"strings"
 	"tweek-gateway/appConfig"
+	"tweek-gateway/circuitBreaker"
 	"tweek-gateway/metrics"
 	"tweek-gateway/proxy"
 	"tweek-gateway/security"
+	"tweek-gateway/upstream"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -18,28 +22,44 @@ import (
 )
 
 // Mount - mounts the request transformation handlers and middleware
-func Mount(upstreamConfig *appConfig.Upstreams, routesConfig []appConfig.V2Route, token security.JWTToken, middleware *negroni.Negroni, router *mux.Router) {
+func Mount(pools upstream.Pools, routesConfig []appConfig.V2Route, token security.JWTToken, middleware *negroni.Negroni, metricsVar *metrics.Metrics, router *mux.Router) {
 	// URLs
 	upstreams := map[string]*url.URL{
-		"api":       parseUpstreamOrPanic(upstreamConfig.API),
-		"authoring": parseUpstreamOrPanic(upstreamConfig.Authoring),
+		"api":       pools["api"].URL(),
+		"authoring": pools["authoring"].URL(),
 	}
 
 	// Proxy forwarders
 	forwarders := map[string]negroni.HandlerFunc{
-		"api":       proxy.New(upstreams["api"], token),
-		"authoring": proxy.New(upstreams["authoring"], token),
+		"api":       proxy.New(pools["api"], token),
+		"authoring": proxy.New(pools["authoring"], token),
 	}
 
-	metricsVar := metrics.NewMetricsVar("gateway")
-
 	// Mounting handlers
 	router.Methods("OPTIONS").Handler(middleware)
 	for _, routeConfig := range routesConfig {
-		mountRouteTransform(router, middleware, routeConfig, upstreams, forwarders, metricsVar)
+		routeForwarders := forwarders
+		if hasProxyOptions(routeConfig) {
+			routeForwarders = map[string]negroni.HandlerFunc{
+				routeConfig.Service: proxy.WithOptions(pools[routeConfig.Service], token, proxy.Options{Timeouts: routeConfig.Timeouts, Retry: routeConfig.Retry, Body: routeConfig.Body}),
+			}
+		}
+		routeMiddleware := negroni.New(security.MaxRequestBytesMiddleware(maxRequestBytes(pools, routeConfig))).With(middleware.Handlers()...)
+		mountRouteTransform(router, routeMiddleware, routeConfig, upstreams, routeForwarders, metricsVar)
 	}
 }
 
+// maxRequestBytes returns the request body limit of the route, which overrides the limit of its upstream
+func maxRequestBytes(pools upstream.Pools, routeConfig appConfig.V2Route) int64 {
+	if routeConfig.Body.MaxRequestBytes > 0 {
+		return routeConfig.Body.MaxRequestBytes
+	}
+	if pool := pools[routeConfig.Service]; pool != nil {
+		return pool.Options().Body.MaxRequestBytes
+	}
+	return 0
+}
+
 func mountRouteTransform(router *mux.Router, middleware *negroni.Negroni, routeConfig appConfig.V2Route, upstreams map[string]*url.URL, forwarders map[string]negroni.HandlerFunc, metricsVar *metrics.Metrics) {
 	var handlers = []negroni.Handler{}
 
@@ -48,6 +68,15 @@ func mountRouteTransform(router *mux.Router, middleware *negroni.Negroni, routeC
 		handlers = append(handlers, metricHandlers[i])
 	}
 	handlers = append(handlers, createTransformMiddleware(routeConfig, upstreams))
+
+	breakerName := fmt.Sprintf("route:%s%s:%s", routeConfig.Service, routeConfig.RoutePathPrefix, strings.Join(routeConfig.Methods, ","))
+	breaker, err := circuitBreaker.New(breakerName, routeConfig.CircuitBreaker)
+	if err != nil {
+		logrus.WithError(err).Panic("Invalid route circuit breaker")
+	}
+	if breaker != nil {
+		handlers = append(handlers, breaker.Middleware())
+	}
 	handlers = append(handlers, forwarders[routeConfig.Service])
 
 	handlerFunc := middleware.With(handlers...)
@@ -57,6 +86,11 @@ func mountRouteTransform(router *mux.Router, middleware *negroni.Negroni, routeC
 	router.Methods(routeConfig.Methods...).PathPrefix(routeConfig.RoutePathPrefix).Handler(handlerFunc)
 }
 
+// hasProxyOptions returns true if the route overrides the proxy options of its upstream
+func hasProxyOptions(routeConfig appConfig.V2Route) bool {
+	return routeConfig.Timeouts != (appConfig.Timeouts{}) || routeConfig.Body != (appConfig.Body{}) || !reflect.DeepEqual(routeConfig.Retry, appConfig.Retry{})
+}
+
 func createRewriteKeyPathMiddleware() negroni.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 		u := r.URL
@@ -80,14 +114,6 @@ func createTransformMiddleware(routeConfig appConfig.V2Route, upstreams map[stri
 	}
 }
 
-func parseUpstreamOrPanic(u string) *url.URL {
-	result, err := url.Parse(u)
-	if err != nil {
-		logrus.WithError(err).WithField("upstream", u).Panic("Invalid upstream")
-	}
-	return result
-}
-
 func getURLForUpstream(upstream *url.URL, req *http.Request, urlRegexp *regexp.Regexp, upstreamRoute string, keyPath bool) *url.URL {
 	newURL := urlRegexp.ReplaceAllString(req.URL.String(), fmt.Sprintf("%v%v", upstream.String(), upstreamRoute))
 	result, err := url.Parse(newURL)
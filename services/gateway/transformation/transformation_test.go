@@ -12,6 +12,7 @@ import (
 	"tweek-gateway/appConfig"
 	"tweek-gateway/metrics"
 	"tweek-gateway/security"
+	"tweek-gateway/upstream"
 
 	"github.com/gorilla/mux"
 	"github.com/urfave/negroni"
@@ -19,11 +20,12 @@ import (
 
 func TestMount(t *testing.T) {
 	type args struct {
-		upstreamConfig *appConfig.Upstreams
-		routesConfig   []appConfig.V2Route
-		token          security.JWTToken
-		middleware     *negroni.Negroni
-		router         *mux.Router
+		pools        upstream.Pools
+		routesConfig []appConfig.V2Route
+		token        security.JWTToken
+		middleware   *negroni.Negroni
+		metricsVar   *metrics.Metrics
+		router       *mux.Router
 	}
 	tests := []struct {
 		name string
@@ -33,7 +35,7 @@ func TestMount(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			Mount(tt.args.upstreamConfig, tt.args.routesConfig, tt.args.token, tt.args.middleware, tt.args.router)
+			Mount(tt.args.pools, tt.args.routesConfig, tt.args.token, tt.args.middleware, tt.args.metricsVar, tt.args.router)
 		})
 	}
 }
@@ -81,26 +83,6 @@ func Test_createTransformMiddleware(t *testing.T) {
 	}
 }
 
-func Test_parseUpstreamOrPanic(t *testing.T) {
-	type args struct {
-		u string
-	}
-	tests := []struct {
-		name string
-		args args
-		want *url.URL
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := parseUpstreamOrPanic(tt.args.u); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseUpstreamOrPanic() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func Test_getURLForUpstream(t *testing.T) {
 	authoringURL, _ := url.Parse("http://authoring")
 
@@ -0,0 +1,432 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tweek-gateway/appConfig"
+	"tweek-gateway/circuitBreaker"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Balancers
+const (
+	RoundRobin       = "round-robin"
+	LeastConnections = "least-connections"
+)
+
+const (
+	defaultResolveInterval    = 30 * time.Second
+	defaultHealthCheckPath    = "/health"
+	defaultHealthCheckTimeout = 2 * time.Second
+	defaultUnhealthyThreshold = 2
+	defaultHealthyThreshold   = 1
+	defaultMaxFailures        = 5
+	defaultEjectionDuration   = 30 * time.Second
+)
+
+// lookupHost is used to resolve instances, replaced in tests
+var (
+	defaultLookupHost = net.DefaultResolver.LookupHost
+	lookupHost        = defaultLookupHost
+)
+
+type healthCheck struct {
+	path               string
+	interval           time.Duration
+	timeout            time.Duration
+	unhealthyThreshold int
+	healthyThreshold   int
+}
+
+type passiveHealthCheck struct {
+	maxFailures      int
+	ejectionDuration time.Duration
+}
+
+// Pool balances requests between the instances of an upstream service
+type Pool struct {
+	name            string
+	url             *url.URL
+	balancer        string
+	resolve         bool
+	resolveInterval time.Duration
+	check           healthCheck
+	passive         passiveHealthCheck
+	client          *http.Client
+	tlsConfig       *tls.Config
+	transport       http.RoundTripper
+	breaker         *circuitBreaker.Breaker
+	options         appConfig.UpstreamOptions
+
+	lock    sync.RWMutex
+	targets []*Target
+	next    uint32
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+}
+
+// NewPool creates a pool for the upstream URL. Unless targets or resolving are configured, the pool has a single instance
+func NewPool(name, rawURL string, options appConfig.UpstreamOptions) (*Pool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid upstream %s: %v", name, err)
+	}
+
+	p := &Pool{
+		name:     name,
+		url:      u,
+		balancer: options.Balancer,
+		resolve:  options.Resolve,
+		options:  options,
+		stop:     make(chan struct{}),
+	}
+	if len(p.balancer) == 0 {
+		p.balancer = RoundRobin
+	}
+	if p.balancer != RoundRobin && p.balancer != LeastConnections {
+		return nil, fmt.Errorf("Unknown balancer %q for upstream %s", p.balancer, name)
+	}
+
+	durations := []struct {
+		value        string
+		defaultValue time.Duration
+		target       *time.Duration
+	}{
+		{options.ResolveInterval, defaultResolveInterval, &p.resolveInterval},
+		{options.HealthCheck.Interval, 0, &p.check.interval},
+		{options.HealthCheck.Timeout, defaultHealthCheckTimeout, &p.check.timeout},
+		{options.PassiveHealthCheck.EjectionDuration, defaultEjectionDuration, &p.passive.ejectionDuration},
+	}
+	for _, d := range durations {
+		if *d.target, err = parseDuration(d.value, d.defaultValue); err != nil {
+			return nil, fmt.Errorf("Invalid options for upstream %s: %v", name, err)
+		}
+	}
+
+	p.check.path = withDefault(options.HealthCheck.Path, defaultHealthCheckPath)
+	p.check.unhealthyThreshold = positiveOrDefault(options.HealthCheck.UnhealthyThreshold, defaultUnhealthyThreshold)
+	p.check.healthyThreshold = positiveOrDefault(options.HealthCheck.HealthyThreshold, defaultHealthyThreshold)
+	p.passive.maxFailures = positiveOrDefault(options.PassiveHealthCheck.MaxFailures, defaultMaxFailures)
+
+	if p.tlsConfig, err = appConfig.LoadTLSConfig(&options.TLS); err != nil {
+		return nil, fmt.Errorf("Invalid TLS options for upstream %s: %v", name, err)
+	}
+	p.transport = http.DefaultTransport
+	if p.tlsConfig != nil {
+		if len(p.tlsConfig.ServerName) == 0 && p.resolve {
+			p.tlsConfig.ServerName = u.Hostname()
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = p.tlsConfig
+		p.transport = t
+	}
+	p.client = &http.Client{Timeout: p.check.timeout, Transport: p.transport}
+
+	if p.breaker, err = circuitBreaker.New("upstream:"+name, options.CircuitBreaker); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(options.Targets) > 0:
+		for _, target := range options.Targets {
+			targetURL, err := url.Parse(target)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid target for upstream %s: %v", name, err)
+			}
+			p.targets = append(p.targets, newTarget(targetURL, targetURL.Host))
+		}
+	case p.resolve:
+		if err := p.resolveTargets(); err != nil {
+			logrus.WithError(err).WithField("upstream", name).Error("Failed to resolve upstream instances, using the upstream host")
+			p.targets = []*Target{newTarget(u, u.Host)}
+		}
+	default:
+		p.targets = []*Target{newTarget(u, u.Host)}
+	}
+
+	return p, nil
+}
+
+// Static creates a pool with a single instance and the default options
+func Static(u *url.URL) *Pool {
+	p, err := NewPool(u.Host, u.String(), appConfig.UpstreamOptions{})
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Name returns the name of the upstream service
+func (p *Pool) Name() string {
+	return p.name
+}
+
+// URL returns the configured upstream URL
+func (p *Pool) URL() *url.URL {
+	return p.url
+}
+
+// Options returns the options the pool was created with
+func (p *Pool) Options() appConfig.UpstreamOptions {
+	return p.options
+}
+
+// Breaker returns the circuit breaker of the upstream, nil if disabled
+func (p *Pool) Breaker() *circuitBreaker.Breaker {
+	return p.breaker
+}
+
+// TLSConfig returns the TLS configuration of the connections to the instances, nil if not configured
+func (p *Pool) TLSConfig() *tls.Config {
+	return p.tlsConfig
+}
+
+// Transport returns the transport for requests to the instances which don't need other options, like status checks
+func (p *Pool) Transport() http.RoundTripper {
+	return p.transport
+}
+
+// Hosts returns the hosts the upstream is reachable at, which are the upstream URL's host and the targets' hosts
+func (p *Pool) Hosts() []string {
+	hosts := []string{p.url.Host}
+	for _, target := range p.options.Targets {
+		if targetURL, err := url.Parse(target); err == nil && targetURL.Host != p.url.Host {
+			hosts = append(hosts, targetURL.Host)
+		}
+	}
+	return hosts
+}
+
+// Targets returns the current instances of the pool
+func (p *Pool) Targets() []*Target {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.targets
+}
+
+// Endpoint returns the base URL of an available instance, for requests which are not balanced, like status checks
+func (p *Pool) Endpoint() *url.URL {
+	targets := p.Targets()
+	target := targets[0]
+	for _, t := range targets {
+		if t.Available() {
+			target = t
+			break
+		}
+	}
+
+	endpoint := *p.url
+	endpoint.Scheme = target.URL.Scheme
+	endpoint.Host = target.URL.Host
+	return &endpoint
+}
+
+// Pick selects the instance for the next request, and counts it as an active connection until Release is called.
+// When no instance is available, all of them are considered
+func (p *Pool) Pick() *Target {
+	targets := p.Targets()
+
+	candidates := make([]*Target, 0, len(targets))
+	for _, t := range targets {
+		if t.Available() {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = targets
+	}
+
+	start := int(atomic.AddUint32(&p.next, 1)-1) % len(candidates)
+	picked := candidates[start]
+	if p.balancer == LeastConnections {
+		for i := 1; i < len(candidates); i++ {
+			candidate := candidates[(start+i)%len(candidates)]
+			if candidate.ActiveConnections() < picked.ActiveConnections() {
+				picked = candidate
+			}
+		}
+	}
+
+	picked.acquire()
+	return picked
+}
+
+// Release completes a request forwarded to the target. Gateway errors count as failures for passive health checks
+func (p *Pool) Release(t *Target, statusCode int) {
+	failed := statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+	t.release(failed, fmt.Sprintf("Request failed with status %d", statusCode), &p.passive)
+}
+
+// Status returns the health of all the instances
+func (p *Pool) Status() []TargetStatus {
+	targets := p.Targets()
+	result := make([]TargetStatus, len(targets))
+	for i, t := range targets {
+		result[i] = t.Status()
+	}
+	return result
+}
+
+// Healthy returns true if at least one of the instances is available
+func (p *Pool) Healthy() bool {
+	for _, t := range p.Targets() {
+		if t.Available() {
+			return true
+		}
+	}
+	return false
+}
+
+// Start starts the active health checks and resolving of instances, if enabled
+func (p *Pool) Start() {
+	p.startOnce.Do(func() {
+		if p.check.interval > 0 {
+			go p.every(p.check.interval, p.checkTargets)
+		}
+		if p.resolve {
+			go p.every(p.resolveInterval, func() {
+				if err := p.resolveTargets(); err != nil {
+					logrus.WithError(err).WithField("upstream", p.name).Error("Failed to resolve upstream instances")
+				}
+			})
+		}
+	})
+}
+
+// Stop stops the background work of the pool
+func (p *Pool) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+func (p *Pool) every(interval time.Duration, action func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	action()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			action()
+		}
+	}
+}
+
+func (p *Pool) checkTargets() {
+	var wg sync.WaitGroup
+	for _, t := range p.Targets() {
+		wg.Add(1)
+		go func(t *Target) {
+			defer wg.Done()
+			t.checked(p.checkTarget(t), &p.check)
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) checkTarget(t *Target) error {
+	checkURL := *t.URL
+	checkURL.Path = p.check.path
+
+	req, err := http.NewRequest(http.MethodGet, checkURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Host = t.Host
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Health check failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// resolveTargets replaces the instances with the addresses of the upstream host, keeping the state of existing ones
+func (p *Pool) resolveTargets() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.resolveInterval)
+	defer cancel()
+
+	addresses, err := lookupHost(ctx, p.url.Hostname())
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("No addresses found for %s", p.url.Hostname())
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	existing := map[string]*Target{}
+	for _, t := range p.targets {
+		existing[t.URL.Host] = t
+	}
+
+	targets := make([]*Target, 0, len(addresses))
+	for _, address := range addresses {
+		host := address
+		if port := p.url.Port(); len(port) > 0 {
+			host = net.JoinHostPort(address, port)
+		} else if net.ParseIP(address).To4() == nil {
+			host = "[" + address + "]"
+		}
+
+		if t, ok := existing[host]; ok {
+			targets = append(targets, t)
+			continue
+		}
+		targetURL := *p.url
+		targetURL.Host = host
+		targets = append(targets, newTarget(&targetURL, p.url.Host))
+	}
+
+	p.targets = targets
+	return nil
+}
+
+func parseDuration(value string, defaultValue time.Duration) (time.Duration, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", value)
+	}
+	return d, nil
+}
+
+func withDefault(value, defaultValue string) string {
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func positiveOrDefault(value, defaultValue int) int {
+	if value <= 0 {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,210 @@
+package upstream
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tweek-gateway/appConfig"
+)
+
+func TestPool_Pick(t *testing.T) {
+	tests := []struct {
+		name     string
+		balancer string
+		active   map[string]int
+		want     []string
+	}{
+		{
+			name:     "Round robin",
+			balancer: RoundRobin,
+			want:     []string{"api-1", "api-2", "api-3", "api-1"},
+		},
+		{
+			name:     "Least connections",
+			balancer: LeastConnections,
+			active:   map[string]int{"api-1": 2, "api-3": 1},
+			want:     []string{"api-2", "api-2", "api-3", "api-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewPool("api", "http://api", appConfig.UpstreamOptions{
+				Targets:  []string{"http://api-1", "http://api-2", "http://api-3"},
+				Balancer: tt.balancer,
+			})
+			if err != nil {
+				t.Fatalf("NewPool() error = %v", err)
+			}
+			for _, target := range pool.Targets() {
+				for i := 0; i < tt.active[target.URL.Host]; i++ {
+					target.acquire()
+				}
+			}
+
+			for i, want := range tt.want {
+				if got := pool.Pick().URL.Host; got != want {
+					t.Errorf("Pick() #%d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPool_PassiveHealthCheck(t *testing.T) {
+	pool, err := NewPool("api", "http://api", appConfig.UpstreamOptions{
+		Targets:            []string{"http://api-1", "http://api-2"},
+		PassiveHealthCheck: appConfig.PassiveHealthCheck{MaxFailures: 2, EjectionDuration: "1m"},
+	})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		target := pool.Pick()
+		if target.URL.Host == "api-1" {
+			pool.Release(target, http.StatusBadGateway)
+		} else {
+			pool.Release(target, http.StatusOK)
+		}
+		pool.Release(pool.Pick(), http.StatusOK)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := pool.Pick().URL.Host; got != "api-2" {
+			t.Errorf("Pick() = %v, want the ejected api-1 to be skipped", got)
+		}
+	}
+
+	status := pool.Status()
+	if !status[0].Ejected || status[1].Ejected {
+		t.Errorf("Status() = %+v, want only api-1 to be ejected", status)
+	}
+}
+
+func TestPool_AllTargetsUnavailable(t *testing.T) {
+	pool, err := NewPool("api", "http://api", appConfig.UpstreamOptions{
+		Targets:            []string{"http://api-1"},
+		PassiveHealthCheck: appConfig.PassiveHealthCheck{MaxFailures: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	pool.Release(pool.Pick(), http.StatusGatewayTimeout)
+	if pool.Healthy() {
+		t.Error("Healthy() = true, want false after ejecting the only instance")
+	}
+	if got := pool.Pick().URL.Host; got != "api-1" {
+		t.Errorf("Pick() = %v, want to fall back to all instances", got)
+	}
+}
+
+func TestPool_ActiveHealthCheck(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("Health check path = %v, want /health", r.URL.Path)
+		}
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer unhealthy.Close()
+
+	pool, err := NewPool("api", "http://api", appConfig.UpstreamOptions{
+		Targets:     []string{healthy.URL, unhealthy.URL},
+		HealthCheck: appConfig.HealthCheck{Interval: "1h", UnhealthyThreshold: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	pool.checkTargets()
+
+	status := pool.Status()
+	if !status[0].Healthy || status[1].Healthy {
+		t.Errorf("Status() = %+v, want only the first instance to be healthy", status)
+	}
+	if endpoint := pool.Endpoint().String(); endpoint != healthy.URL {
+		t.Errorf("Endpoint() = %v, want %v", endpoint, healthy.URL)
+	}
+}
+
+func TestPool_Resolve(t *testing.T) {
+	addresses := []string{"10.0.0.1", "10.0.0.2"}
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return addresses, nil
+	}
+	defer func() { lookupHost = defaultLookupHost }()
+
+	pool, err := NewPool("api", "http://api:8080/base", appConfig.UpstreamOptions{Resolve: true})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	targets := pool.Targets()
+	if len(targets) != 2 || targets[0].URL.String() != "http://10.0.0.1:8080/base" || targets[0].Host != "api:8080" {
+		t.Fatalf("Targets() = %v, want the resolved addresses", targets)
+	}
+	targets[1].ejectedUntil = time.Now().Add(time.Minute)
+
+	addresses = []string{"10.0.0.2", "10.0.0.3"}
+	if err := pool.resolveTargets(); err != nil {
+		t.Fatalf("resolveTargets() error = %v", err)
+	}
+
+	targets = pool.Targets()
+	if len(targets) != 2 || targets[0].URL.Host != "10.0.0.2:8080" || targets[1].URL.Host != "10.0.0.3:8080" {
+		t.Fatalf("Targets() = %v, want the new addresses", targets)
+	}
+	if targets[0].Available() {
+		t.Error("The state of existing instances should be kept after resolving")
+	}
+}
+
+func TestPool_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	tests := []struct {
+		name          string
+		tls           appConfig.TLS
+		wantErr       bool
+		wantTransport bool
+	}{
+		{
+			name:    "System certificate authorities",
+			wantErr: true,
+		},
+		{
+			name:          "Custom certificate authority",
+			tls:           appConfig.TLS{CA: appConfig.EnvInlineOrPath{Inline: base64.StdEncoding.EncodeToString(ca)}, MinVersion: "1.2"},
+			wantTransport: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewPool("api", server.URL, appConfig.UpstreamOptions{TLS: tt.tls})
+			if err != nil {
+				t.Fatalf("NewPool() error = %v", err)
+			}
+
+			client := &http.Client{Transport: pool.Transport()}
+			_, err = client.Get(server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			pools := Pools{"api": pool}
+			if got := pools.TransportFor(pool.URL()) != nil; got != tt.wantTransport {
+				t.Errorf("TransportFor() found = %v, want %v", got, tt.wantTransport)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package upstream
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Target is a single instance of an upstream service
+type Target struct {
+	URL *url.URL
+	// Host is sent as the Host header, it's the service's host name for resolved instances
+	Host string
+
+	active int64
+
+	lock                sync.Mutex
+	unhealthy           bool
+	checkFailures       int
+	checkSuccesses      int
+	consecutiveFailures int
+	ejectedUntil        time.Time
+	lastError           string
+}
+
+// TargetStatus describes the health of a Target
+type TargetStatus struct {
+	URL               string     `json:"url"`
+	Healthy           bool       `json:"healthy"`
+	Ejected           bool       `json:"ejected"`
+	EjectedUntil      *time.Time `json:"ejectedUntil,omitempty"`
+	ActiveConnections int64      `json:"activeConnections"`
+	LastError         string     `json:"lastError,omitempty"`
+}
+
+func newTarget(u *url.URL, host string) *Target {
+	return &Target{URL: u, Host: host}
+}
+
+// Available returns true if the target passes the health checks and is not ejected
+func (t *Target) Available() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return !t.unhealthy && time.Now().After(t.ejectedUntil)
+}
+
+// ActiveConnections returns the number of requests currently forwarded to the target
+func (t *Target) ActiveConnections() int64 {
+	return atomic.LoadInt64(&t.active)
+}
+
+func (t *Target) acquire() {
+	atomic.AddInt64(&t.active, 1)
+}
+
+// release is called when a request forwarded to the target completes.
+// Failures are counted for passive health checks, and eject the target when maxFailures is reached
+func (t *Target) release(failed bool, reason string, passive *passiveHealthCheck) {
+	atomic.AddInt64(&t.active, -1)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !failed {
+		t.consecutiveFailures = 0
+		return
+	}
+
+	t.lastError = reason
+	t.consecutiveFailures++
+	if passive.maxFailures > 0 && t.consecutiveFailures >= passive.maxFailures {
+		t.consecutiveFailures = 0
+		t.ejectedUntil = time.Now().Add(passive.ejectionDuration)
+		logrus.WithField("target", t.URL.String()).WithField("ejectedUntil", t.ejectedUntil).Warn("Upstream instance ejected after consecutive failures")
+	}
+}
+
+// checked records the result of an active health check
+func (t *Target) checked(err error, check *healthCheck) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err == nil {
+		t.checkFailures = 0
+		t.checkSuccesses++
+		if t.unhealthy && t.checkSuccesses >= check.healthyThreshold {
+			t.unhealthy = false
+			logrus.WithField("target", t.URL.String()).Info("Upstream instance is healthy")
+		}
+		return
+	}
+
+	t.lastError = err.Error()
+	t.checkSuccesses = 0
+	t.checkFailures++
+	if !t.unhealthy && t.checkFailures >= check.unhealthyThreshold {
+		t.unhealthy = true
+		logrus.WithError(err).WithField("target", t.URL.String()).Warn("Upstream instance is unhealthy")
+	}
+}
+
+// Status returns the current health of the target
+func (t *Target) Status() TargetStatus {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	status := TargetStatus{
+		URL:               t.URL.String(),
+		Healthy:           !t.unhealthy,
+		ActiveConnections: t.ActiveConnections(),
+		LastError:         t.lastError,
+	}
+	if time.Now().Before(t.ejectedUntil) {
+		ejectedUntil := t.ejectedUntil
+		status.Ejected = true
+		status.EjectedUntil = &ejectedUntil
+	}
+	return status
+}
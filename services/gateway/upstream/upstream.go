@@ -0,0 +1,63 @@
+package upstream
+
+import (
+	"net/http"
+	"net/url"
+
+	"tweek-gateway/appConfig"
+)
+
+// Pools holds the pool of each upstream service, keyed by the service name
+type Pools map[string]*Pool
+
+// NewPools creates the pools of all the configured upstream services
+func NewPools(cfg *appConfig.Upstreams) (Pools, error) {
+	services := map[string]string{
+		"api":        cfg.API,
+		"authoring":  cfg.Authoring,
+		"publishing": cfg.Publishing,
+		"editor":     cfg.Editor,
+	}
+
+	pools := Pools{}
+	for name, rawURL := range services {
+		if len(rawURL) == 0 {
+			continue
+		}
+		pool, err := NewPool(name, rawURL, cfg.Options[name])
+		if err != nil {
+			return nil, err
+		}
+		pools[name] = pool
+	}
+	return pools, nil
+}
+
+// Start starts the background work of all the pools
+func (p Pools) Start() {
+	for _, pool := range p {
+		pool.Start()
+	}
+}
+
+// Stop stops the background work of all the pools
+func (p Pools) Stop() {
+	for _, pool := range p {
+		pool.Stop()
+	}
+}
+
+// TransportFor returns the transport of the upstream with TLS options that serves the URL, or nil if there is none
+func (p Pools) TransportFor(u *url.URL) http.RoundTripper {
+	for _, pool := range p {
+		if pool.TLSConfig() == nil {
+			continue
+		}
+		for _, host := range pool.Hosts() {
+			if host == u.Host {
+				return pool.Transport()
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// ResponseBuffer is a http.ResponseWriter which keeps the response in memory
+type ResponseBuffer struct {
+	header      http.Header
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+// NewResponseBuffer creates an empty ResponseBuffer
+func NewResponseBuffer() *ResponseBuffer {
+	return &ResponseBuffer{header: http.Header{}, code: http.StatusOK}
+}
+
+// Header returns the response headers
+func (b *ResponseBuffer) Header() http.Header {
+	return b.header
+}
+
+// WriteHeader keeps the first status code written
+func (b *ResponseBuffer) WriteHeader(code int) {
+	if b.wroteHeader {
+		return
+	}
+	b.wroteHeader = true
+	b.code = code
+}
+
+func (b *ResponseBuffer) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(data)
+}
+
+// Code returns the status code of the response
+func (b *ResponseBuffer) Code() int {
+	return b.code
+}
+
+// Body returns the response body
+func (b *ResponseBuffer) Body() []byte {
+	return b.body.Bytes()
+}
+
+// Success returns true if the status code is 2xx
+func (b *ResponseBuffer) Success() bool {
+	return b.code >= 200 && b.code <= 299
+}
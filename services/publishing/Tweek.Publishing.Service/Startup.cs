@@ -105,6 +105,11 @@ namespace Tweek.Publishing.Service
                     new ExternalAppsConverter(key),
                     new PolicyConverter(),
                     new SubjectExtractionRulesConverter(),
+                },
+                FilesConverters =
+                {
+                    new FilesConverter(Patterns.ProviderSubjectExtractionRules),
+                    new FilesConverter(Patterns.EnrichmentMapping),
                 }
             };
             return storageSynchronizer;
@@ -168,7 +173,9 @@ namespace Tweek.Publishing.Service
                     (Patterns.Manifests, new NestedKeysValidator()),
                     (Patterns.JPad, new CompileJPadValidator()),
                     (Patterns.SubjectExtractionRules, new SubjectExtractionValidator()),
+                    (Patterns.ProviderSubjectExtractionRules, new SubjectExtractionValidator()),
                     (Patterns.Policy, new PolicyValidator()),
+                    (Patterns.EnrichmentMapping, new EnrichmentMappingValidator()),
                 }
             };
 
@@ -0,0 +1,47 @@
+using System;
+using System.Collections.Generic;
+using System.IO;
+using System.Linq;
+using System.Text.RegularExpressions;
+
+namespace Tweek.Publishing.Service.Sync.Converters
+{
+    // Publishes each file matching the pattern as is, under its own name
+    public class FilesConverter : IFilesConverter
+    {
+        private static readonly Dictionary<string, string> mimeTypes = new Dictionary<string, string>
+        {
+            [".json"] = "application/json",
+            [".csv"] = "text/csv",
+        };
+
+        private readonly Regex _filesRegex;
+
+        public FilesConverter(string pattern)
+        {
+            _filesRegex = new Regex(pattern, RegexOptions.Compiled);
+        }
+
+        public IEnumerable<(string, string, string)> Convert(string commitId, ICollection<string> files, Func<string, string> readFn)
+        {
+            return files
+                .Where(x => _filesRegex.IsMatch(x))
+                .Select(x =>
+                {
+                    try
+                    {
+                        return (x, readFn(x), MimeType(x));
+                    }
+                    catch (Exception ex)
+                    {
+                        ex.Data["key"] = x;
+                        throw;
+                    }
+                })
+                .ToList();
+        }
+
+        private static string MimeType(string fileName) =>
+            mimeTypes.TryGetValue(Path.GetExtension(fileName), out var mimeType) ? mimeType : "text/plain";
+    }
+}
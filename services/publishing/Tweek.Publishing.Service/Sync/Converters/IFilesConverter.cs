@@ -0,0 +1,10 @@
+using System;
+using System.Collections.Generic;
+
+namespace Tweek.Publishing.Service.Sync.Converters
+{
+    public interface IFilesConverter
+    {
+        IEnumerable<(string fileName, string fileContent, string fileMimeType)> Convert(string commitId, ICollection<string> files, Func<string, string> readFn);
+    }
+}
@@ -23,6 +23,7 @@ namespace Tweek.Publishing.Service.Sync
         private readonly ShellHelper.ShellExecutor _shellExecutor;
 
         public List<IConverter> Converters = new List<IConverter>();
+        public List<IFilesConverter> FilesConverters = new List<IFilesConverter>();
         private readonly IMetrics _metrics;
         private readonly CounterOptions _staleRevision = new CounterOptions{Context = "publishing", Name = "stale_revision"};
         private readonly CounterOptions _badRevision = new CounterOptions{Context = "publishing", Name = "bad_revision"};
@@ -100,6 +101,15 @@ namespace Tweek.Publishing.Service.Sync
                         await _client.PutString(fileName, fileContent, fileMimeType);
                         _metrics.Measure.Counter.Increment(_fileUpload, new MetricTags("FileName", fileName));
                     }
+
+                    foreach(var Converter in FilesConverters)
+                    {
+                        foreach(var (fileName, fileContent, fileMimeType) in Converter.Convert(commitId, files, readFn))
+                        {
+                            await _client.PutString(fileName, fileContent, fileMimeType);
+                            _metrics.Measure.Counter.Increment(_fileUpload, new MetricTags("FileName", fileName));
+                        }
+                    }
                 }
             }
 
@@ -0,0 +1,12 @@
+using System;
+
+namespace Tweek.Publishing.Service.Validation
+{
+    public class EnrichmentMappingValidationException : Exception
+    {
+        public EnrichmentMappingValidationException(Exception originalException) : base("enrichment mapping is invalid")
+        {
+            this.Data["Original Exception"] = originalException;
+        }
+    }
+}
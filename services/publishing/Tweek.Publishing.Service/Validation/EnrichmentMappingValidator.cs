@@ -0,0 +1,36 @@
+using System;
+using System.Linq;
+using System.Threading.Tasks;
+using Newtonsoft.Json.Linq;
+
+namespace Tweek.Publishing.Service.Validation
+{
+    // Validates the mapping of users to groups and attributes, which is a JSON object keyed by users,
+    // or a CSV with a user column
+    public class EnrichmentMappingValidator : IValidator
+    {
+        public async Task Validate(string fileName, Func<string, Task<string>> reader)
+        {
+            try
+            {
+                var mapping = await reader(fileName);
+                if (fileName.EndsWith(".csv"))
+                {
+                    var header = mapping.Split('\n').First().Split(',').Select(x => x.Trim());
+                    if (!header.Contains("user"))
+                    {
+                        throw new Exception("missing user column");
+                    }
+                }
+                else if (JToken.Parse(mapping).Type != JTokenType.Object)
+                {
+                    throw new Exception("invalid json");
+                }
+            }
+            catch (Exception e)
+            {
+                throw new EnrichmentMappingValidationException(e);
+            }
+        }
+    }
+}
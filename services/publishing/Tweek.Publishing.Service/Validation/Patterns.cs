@@ -7,5 +7,7 @@ namespace Tweek.Publishing.Service.Validation
         public static readonly string ExternalApp = "^external_apps/(.+)\\.json$";
         public static readonly string Policy = "^security/policy.json$";
         public static readonly string SubjectExtractionRules = "^security/subject_extraction_rules.rego$";
+        public static readonly string ProviderSubjectExtractionRules = "^security/subject_extraction_rules/.+\\.rego$";
+        public static readonly string EnrichmentMapping = "^security/enrichment/.+\\.(json|csv)$";
     }
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+using System.Collections.Generic;
+using System.Linq;
+using Tweek.Publishing.Service.Sync.Converters;
+using Tweek.Publishing.Service.Validation;
+using Xunit;
+
+namespace Tweek.Publishing.Tests
+{
+    public class FilesConverterTests
+    {
+        [Fact]
+        public void ConvertProviderSubjectExtractionRules()
+        {
+            var files = new Dictionary<string, string>
+            {
+                ["security/subject_extraction_rules.rego"] = "package rules",
+                ["security/subject_extraction_rules/azure.rego"] = "package rules\nsubject = { \"user\": input.oid }",
+                ["security/subject_extraction_rules/okta.rego"] = "package rules\nsubject = { \"user\": input.sub }",
+                ["security/policy.json"] = "{}",
+            };
+            var converter = new FilesConverter(Patterns.ProviderSubjectExtractionRules);
+
+            var result = converter.Convert("commit", files.Keys, x => files[x]).ToList();
+
+            Assert.Equal(new[]
+            {
+                ("security/subject_extraction_rules/azure.rego", files["security/subject_extraction_rules/azure.rego"], "text/plain"),
+                ("security/subject_extraction_rules/okta.rego", files["security/subject_extraction_rules/okta.rego"], "text/plain"),
+            }, result);
+        }
+
+        [Fact]
+        public void ConvertEnrichmentMappings()
+        {
+            var files = new Dictionary<string, string>
+            {
+                ["security/enrichment/directory.json"] = "{}",
+                ["security/enrichment/directory.csv"] = "user,group",
+                ["security/enrichment/README.md"] = "mappings",
+            };
+            var converter = new FilesConverter(Patterns.EnrichmentMapping);
+
+            var result = converter.Convert("commit", files.Keys, x => files[x]).ToList();
+
+            Assert.Equal(new[]
+            {
+                ("security/enrichment/directory.json", "{}", "application/json"),
+                ("security/enrichment/directory.csv", "user,group", "text/csv"),
+            }, result);
+        }
+    }
+}
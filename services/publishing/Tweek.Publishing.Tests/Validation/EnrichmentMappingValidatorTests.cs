@@ -0,0 +1,31 @@
+using System.Collections.Generic;
+using System.Threading.Tasks;
+using Tweek.Publishing.Service.Validation;
+using Xunit;
+
+namespace Tweek.Publishing.Tests.Validation
+{
+    public class EnrichmentMappingValidatorTests
+    {
+        [Theory]
+        [InlineData("security/enrichment/directory.json", @"{""alice"": {""groups"": [""editors""], ""attributes"": {""department"": ""engineering""}}}")]
+        [InlineData("security/enrichment/directory.csv", "user,group,department\nalice,editors,engineering\n")]
+        public async Task ValidatePassWhenValidMapping(string fileName, string mapping)
+        {
+            var validator = new EnrichmentMappingValidator();
+            var files = new Dictionary<string, string> { [fileName] = mapping };
+            await validator.Validate(fileName, async x => files[x]);
+        }
+
+        [Theory]
+        [InlineData("security/enrichment/directory.json", @"[""alice""]")]
+        [InlineData("security/enrichment/directory.json", @"{""alice"": ")]
+        [InlineData("security/enrichment/directory.csv", "name,group\nalice,editors\n")]
+        public async Task ValidateFailsWhenInvalidMapping(string fileName, string mapping)
+        {
+            var validator = new EnrichmentMappingValidator();
+            var files = new Dictionary<string, string> { [fileName] = mapping };
+            await Assert.ThrowsAsync<EnrichmentMappingValidationException>(() => validator.Validate(fileName, async x => files[x]));
+        }
+    }
+}